@@ -0,0 +1,58 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// abRun alternates runs of two commands under one acquisition of the
+// lock, for a paired comparison.
+type abRun struct {
+	cmds  [2][]string
+	count int
+}
+
+// parseAB parses args of the form "ab -- cmdA... -- cmdB...". It
+// returns nil if args isn't an ab command.
+func parseAB(args []string, count int) (*abRun, error) {
+	if len(args) < 2 || args[0] != "ab" || args[1] != "--" {
+		return nil, nil
+	}
+	i := slices.Index(args[2:], "--")
+	if i < 1 || i+3 == len(args) {
+		return nil, fmt.Errorf("usage: perflock [flags] ab -- commandA... -- commandB...")
+	}
+	return &abRun{cmds: [2][]string{args[2 : i+2], args[i+3:]}, count: count}, nil
+}
+
+// run runs each command r.count times, in the order ABBA ABBA ..., so
+// neither command always runs first or after the other. Before each
+// run, it prints the benchfmt configuration line "ab: A" or "ab: B" to
+// stdout, so benchstat -col ab compares the results of the commands.
+// It stops at the first run that fails and returns its exit status.
+// The commands run with environment env, as with the run function.
+func (r *abRun) run(env []string, grace, killAfter time.Duration, rusage string) int {
+	for i := 0; i < r.count; i++ {
+		order := []int{0, 1}
+		if i%2 == 1 {
+			order = []int{1, 0}
+		}
+		for _, c := range order {
+			fmt.Printf("ab: %c\n", 'A'+c)
+			status, usage := run(r.cmds[c], env, grace, killAfter)
+			if rusage != "" && usage != nil {
+				writeUsage(os.Stderr, rusage, usage)
+			}
+			if status != 0 {
+				return status
+			}
+		}
+	}
+	return 0
+}
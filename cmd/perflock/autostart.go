@@ -0,0 +1,94 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// autoStartTimeout bounds how long startDaemon waits for a new daemon
+// to listen on its socket.
+const autoStartTimeout = 10 * time.Second
+
+// startDaemon starts a daemon listening on socket and connects to it.
+// If perflock is running as root, it starts a system-wide daemon, and
+// otherwise a per-user one, like -unprivileged. The daemon runs in its
+// own session, so it outlives this client, and logs to perflock.log
+// next to socket.
+//
+// A lock file next to socket keeps concurrent clients from starting
+// more than one daemon: whoever gets the lock first starts it, and
+// the others find it running once they get the lock.
+func startDaemon(socket string) (*Client, error) {
+	if strings.HasPrefix(socket, "@") {
+		return nil, fmt.Errorf("cannot start a perflock daemon on abstract socket %s", socket)
+	}
+	dir := filepath.Dir(socket)
+	if !dirWritable(dir) {
+		return nil, fmt.Errorf("cannot start a perflock daemon on %s: %s isn't writable (set XDG_RUNTIME_DIR to use a per-user daemon)", socket, dir)
+	}
+	lock, err := openFlockLock(socket + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.f.Close()
+	if _, err := lock.Lock(false, time.Time{}); err != nil {
+		return nil, err
+	}
+	if c, err := net.Dial("unix", socket); err == nil {
+		// Another client started it while we waited for the lock.
+		c.Close()
+		return NewClient(socket)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-daemon", "-socket", socket}
+	if os.Geteuid() != 0 {
+		args = append(args, "-unprivileged")
+	}
+	logPath := filepath.Join(dir, "perflock.log")
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = "/"
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting perflock daemon: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Started perflock daemon (pid %d) on %s; logging to %s\n", cmd.Process.Pid, socket, logPath)
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	timeout := time.After(autoStartTimeout)
+	for {
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("perflock daemon exited (%v); see %s", err, logPath)
+		case <-timeout:
+			return nil, fmt.Errorf("timed out waiting for perflock daemon to listen on %s; see %s", socket, logPath)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if c, err := net.Dial("unix", socket); err == nil {
+			c.Close()
+			return NewClient(socket)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aclements/perflock/internal/cgroup"
+)
+
+// cgroupPrefix begins the name of the group the daemon creates for
+// each command it confines.
+const cgroupPrefix = "perflock-"
+
+// commandCgroupName matches the names of the groups the daemon creates.
+var commandCgroupName = regexp.MustCompile(`^` + cgroupPrefix + `[0-9]+$`)
+
+// theCgroups tracks the cgroup hierarchy the daemon creates groups in.
+var theCgroups struct {
+	sync.Mutex
+
+	// h is the cgroup v2 hierarchy, or nil if there is none.
+	h      *cgroup.Hierarchy
+	nextID int
+}
+
+// maxLockedMemory is the most memory -mlock protects, from
+// theConfig.MaxLockedMemory. ActionReload may change it.
+var maxLockedMemory atomic.Int64
+
+// errLockMemoryDisabled is the error for a LockMemory acquire when
+// maxLockedMemory is zero.
+var errLockMemoryDisabled = errors.New("locking memory is disabled; the daemon configuration must set maxLockedMemory")
+
+// commandCgroup is a cgroup containing one command.
+type commandCgroup struct {
+	name string
+}
+
+// setupCgroups opens the cgroup v2 hierarchy, if any, and removes any
+// groups left over from a previous daemon.
+func setupCgroups() {
+	h, err := cgroup.Open()
+	if err != nil {
+		slog.Info("cgroups are unavailable", "err", err)
+		return
+	}
+	removeStaleCgroups(h, "")
+	theCgroups.h = h
+}
+
+// removeStaleCgroups removes the command groups under group.
+func removeStaleCgroups(h *cgroup.Hierarchy, group string) {
+	groups, _ := h.Groups(group)
+	for _, g := range groups {
+		if !commandCgroupName.MatchString(path.Base(g)) {
+			removeStaleCgroups(h, g)
+		} else if err := h.Remove(g); err != nil {
+			slog.Warn("removing stale cgroup", "group", g, "err", err)
+		}
+	}
+}
+
+// newCgroup creates a cgroup with the given control file settings and
+// moves process pid, and so any children it starts later, into it.
+//
+// The new group is a sibling of pid's current group, so it stays in
+// the same systemd slice, and so under the limits and accounting of
+// the user or service that started it. pid's current group can't be
+// the parent, because a group that contains processes can't enable
+// controllers for its children.
+func newCgroup(pid int, settings map[string]string) (*commandCgroup, error) {
+	c := &theCgroups
+	c.Lock()
+	defer c.Unlock()
+	if theConfig.Unprivileged {
+		return nil, fmt.Errorf("cgroups are disabled for unprivileged daemons")
+	}
+	if c.h == nil {
+		return nil, fmt.Errorf("cgroup v2 is not available")
+	}
+	if pid <= 0 {
+		return nil, fmt.Errorf("client process ID is unknown")
+	}
+	cur, err := cgroup.ProcessGroup(pid)
+	if err != nil {
+		return nil, err
+	}
+	parent := path.Dir(cur)
+	if parent == "." {
+		parent = ""
+	}
+	var controllers []string
+	for file := range settings {
+		ctl, _, _ := strings.Cut(file, ".")
+		controllers = append(controllers, ctl)
+	}
+	if err := c.h.Enable(parent, controllers...); err != nil {
+		return nil, err
+	}
+	c.nextID++
+	g := &commandCgroup{path.Join(parent, fmt.Sprint(cgroupPrefix, c.nextID))}
+	if err := c.h.Create(g.name, settings); err != nil {
+		return nil, err
+	}
+	if err := c.h.AddProcess(g.name, pid); err != nil {
+		c.h.Remove(g.name)
+		return nil, err
+	}
+	return g, nil
+}
+
+// release removes g once the processes in it have exited or moved to
+// another group, which may take a while: the client may close its
+// connection just before it exits, and with -count it stays in g until
+// it acquires the lock again.
+func (g *commandCgroup) release() {
+	go func() {
+		h := theCgroups.h
+		populated, err := h.Populated(g.name)
+		for err == nil && populated {
+			time.Sleep(time.Second)
+			populated, err = h.Populated(g.name)
+		}
+		if err == nil {
+			err = h.Remove(g.name)
+		}
+		if err != nil {
+			slog.Error("removing cgroup", "group", g.name, "err", err)
+		}
+	}()
+}
+
+// cpuMaxPeriod is the period of cpu.max quotas, in microseconds.
+const cpuMaxPeriod = 100000
+
+// confine moves process pid into a cgroup that locks its memory or
+// limits its memory and CPU use, as requested by s's acquire. Its
+// children started later run in the same cgroup.
+func (s *Server) confine(pid int) error {
+	a := s.acquire
+	settings := make(map[string]string)
+	if a.LockMemory {
+		// mlockall doesn't survive exec, so instead the group's
+		// memory.min protects up to maxLockedMemory of the
+		// command's memory from being reclaimed or swapped out.
+		// A group's protection is also limited by its ancestors',
+		// so this only protects as much as the enclosing slice is
+		// given, for example with systemd's MemoryMin.
+		max := maxLockedMemory.Load()
+		if max == 0 {
+			// The limit was lowered since the acquire was queued.
+			return errLockMemoryDisabled
+		}
+		settings["memory.min"] = fmt.Sprint(max)
+	}
+	if a.MemoryMax > 0 {
+		// Past the limit, the kernel reclaims the command's own
+		// memory, including the page cache it filled, rather than
+		// other commands'.
+		settings["memory.max"] = fmt.Sprint(a.MemoryMax)
+	}
+	if a.CPUMax > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d %d", a.CPUMax*cpuMaxPeriod/100, cpuMaxPeriod)
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+	g, err := newCgroup(pid, settings)
+	if err != nil {
+		return fmt.Errorf("confining command to a cgroup: %w", err)
+	}
+	s.cgroup = g
+	return nil
+}
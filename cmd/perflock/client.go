@@ -6,11 +6,16 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"syscall"
+	"time"
 )
 
+// Client is a connection to the perflock daemon. Its methods return
+// errors rather than exiting, so it can be used by other tools.
 type Client struct {
 	c net.Conn
 
@@ -18,53 +23,306 @@ type Client struct {
 	gw *gob.Decoder
 }
 
-func NewClient(socketPath string) *Client {
+// dialBackoff is how long NewClient waits before each retry when
+// connecting to the daemon fails transiently, such as while the daemon
+// is restarting.
+var dialBackoff = []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}
+
+// NewClient connects to the daemon listening on socketPath.
+func NewClient(socketPath string) (*Client, error) {
 	c, err := net.Dial("unix", socketPath)
+	for _, d := range dialBackoff {
+		if err == nil || !transientDialError(err) {
+			break
+		}
+		time.Sleep(d)
+		c, err = net.Dial("unix", socketPath)
+	}
 	if err != nil {
-		log.Print(err)
-		log.Fatal("Is the perflock daemon running?")
+		return nil, fmt.Errorf("connecting to perflock daemon: %w", err)
 	}
 
 	// Send credentials.
 	err = writeCredentials(c.(*net.UnixConn))
 	if err != nil {
-		log.Fatal("failed to send credentials: ", err)
+		c.Close()
+		return nil, fmt.Errorf("sending credentials to perflock daemon: %w", err)
 	}
 
 	gr, gw := gob.NewEncoder(c), gob.NewDecoder(c)
 
-	return &Client{c, gr, gw}
+	return &Client{c, gr, gw}, nil
 }
 
-func (c *Client) do(action PerfLockAction, response interface{}) {
-	err := c.gr.Encode(action)
-	if err != nil {
-		log.Fatal(err)
+// transientDialError reports whether err may be because the daemon is
+// starting or restarting, or is too busy to accept the connection.
+func transientDialError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EAGAIN)
+}
+
+// Close closes the connection to the daemon, releasing the lock if
+// c holds it.
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+func (c *Client) do(action PerfLockAction, response interface{}) error {
+	if err := c.gr.Encode(action); err != nil {
+		return fmt.Errorf("sending request to perflock daemon: %w", err)
 	}
+	return c.read(response)
+}
 
-	err = c.gw.Decode(response)
-	if err != nil {
-		log.Fatal(err)
+// read reads the next response from the daemon into response.
+func (c *Client) read(response interface{}) error {
+	if err := c.gw.Decode(response); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("reading response from perflock daemon: %w", err)
+	}
+	return nil
+}
+
+// errCancelled is returned by Acquire if the acquire was cancelled.
+var errCancelled = errors.New("acquire cancelled")
+
+// errQueueFull is returned, wrapped, by Acquire and Submit if the
+// daemon refused the request because too many acquisitions are
+// already waiting.
+var errQueueFull = errors.New("queue full")
+
+// queueFullError is a daemon error that wraps errQueueFull.
+type queueFullError string
+
+func (e queueFullError) Error() string { return string(e) }
+
+func (e queueFullError) Is(target error) bool { return target == errQueueFull }
+
+// Acquire performs acquire a. If a requests progress updates, Acquire
+// calls progress with each update before returning the final
+// response.
+func (c *Client) Acquire(a ActionAcquire, progress func(ActionAcquireResponse)) (ActionAcquireResponse, error) {
+	var resp ActionAcquireResponse
+	if err := c.do(PerfLockAction{a}, &resp); err != nil {
+		return resp, err
+	}
+	for resp.Waiting {
+		if progress != nil {
+			progress(resp)
+		}
+		resp = ActionAcquireResponse{}
+		if err := c.read(&resp); err != nil {
+			return resp, err
+		}
+	}
+	if resp.QueueFull {
+		return resp, queueFullError(resp.Err)
+	}
+	if resp.Err != "" {
+		return resp, fmt.Errorf("%s", resp.Err)
+	}
+	if resp.Cancelled {
+		return resp, errCancelled
+	}
+	return resp, nil
+}
+
+// Cancel cancels a pending Acquire, which then returns errCancelled.
+// Unlike other methods, Cancel may be called concurrently with
+// Acquire. If the lock was acquired concurrently, Acquire returns
+// successfully, and closing the connection releases it.
+func (c *Client) Cancel() error {
+	return c.gr.Encode(PerfLockAction{ActionCancel{}})
+}
+
+func (c *Client) Reserve(r ActionReserve) (int, error) {
+	var resp ActionReserveResponse
+	if err := c.do(PerfLockAction{r}, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Err != "" {
+		return 0, fmt.Errorf("%s", resp.Err)
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) Submit(a ActionSubmit) (ActionSubmitResponse, error) {
+	var resp ActionSubmitResponse
+	if err := c.do(PerfLockAction{a}, &resp); err != nil {
+		return resp, err
+	}
+	if resp.QueueFull {
+		return resp, queueFullError(resp.Err)
+	}
+	if resp.Err != "" {
+		return resp, fmt.Errorf("%s", resp.Err)
+	}
+	return resp, nil
+}
+
+func (c *Client) Jobs() ([]JobInfo, error) {
+	var jobs []JobInfo
+	err := c.do(PerfLockAction{ActionJobs{}}, &jobs)
+	return jobs, err
+}
+
+func (c *Client) History() ([]HistoryEntry, error) {
+	var hist []HistoryEntry
+	err := c.do(PerfLockAction{ActionHistory{}}, &hist)
+	return hist, err
+}
+
+func (c *Client) CancelJob(id int) error {
+	var errString string
+	if err := c.do(PerfLockAction{ActionCancelJob{ID: id}}, &errString); err != nil {
+		return err
+	}
+	if errString == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", errString)
+}
+
+func (c *Client) Evict(id int) error {
+	var errString string
+	if err := c.do(PerfLockAction{ActionEvict{ID: id}}, &errString); err != nil {
+		return err
+	}
+	if errString == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", errString)
+}
+
+func (c *Client) Pause(paused bool) error {
+	var errString string
+	if err := c.do(PerfLockAction{ActionPause{Paused: paused}}, &errString); err != nil {
+		return err
+	}
+	if errString == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", errString)
+}
+
+func (c *Client) Reload() error {
+	var errString string
+	if err := c.do(PerfLockAction{ActionReload{}}, &errString); err != nil {
+		return err
+	}
+	if errString == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", errString)
+}
+
+func (c *Client) SetLogLevel(level string) error {
+	var errString string
+	if err := c.do(PerfLockAction{ActionSetLogLevel{Level: level}}, &errString); err != nil {
+		return err
+	}
+	if errString == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", errString)
+}
+
+// Dump returns the daemon's internal state as JSON.
+func (c *Client) Dump() ([]byte, error) {
+	var resp ActionDumpResponse
+	if err := c.do(PerfLockAction{ActionDump{}}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Err != "" {
+		return nil, fmt.Errorf("%s", resp.Err)
+	}
+	return resp.JSON, nil
+}
+
+func (c *Client) WaitJob(id int) (JobInfo, error) {
+	var resp ActionWaitJobResponse
+	if err := c.do(PerfLockAction{ActionWaitJob{ID: id}}, &resp); err != nil {
+		return resp.Job, err
+	}
+	if resp.Err != "" {
+		return resp.Job, fmt.Errorf("%s", resp.Err)
 	}
+	return resp.Job, nil
 }
 
-func (c *Client) Acquire(shared, nonblocking bool, msg string) bool {
-	var ok bool
-	c.do(PerfLockAction{ActionAcquire{Shared: shared, NonBlocking: nonblocking, Msg: msg}}, &ok)
-	return ok
+func (c *Client) List() ([]ListEntry, error) {
+	var list []ListEntry
+	err := c.do(PerfLockAction{ActionList{}}, &list)
+	return list, err
 }
 
-func (c *Client) List() []string {
-	var list []string
-	c.do(PerfLockAction{ActionList{}}, &list)
-	return list
+// Snapshot returns the current state of the lock, as the first
+// update of Watch. c can't be used for anything else afterwards.
+func (c *Client) Snapshot() (ActionWatchResponse, error) {
+	var snap ActionWatchResponse
+	err := c.Watch(func(resp ActionWatchResponse) bool {
+		snap = resp
+		return false
+	})
+	return snap, err
+}
+
+// Watch streams the state of the lock, calling update with the
+// current state and again each time the lock queue changes, until
+// update returns false or reading from the daemon fails. c can't be
+// used for anything else afterwards.
+func (c *Client) Watch(update func(ActionWatchResponse) bool) error {
+	if err := c.gr.Encode(PerfLockAction{ActionWatch{}}); err != nil {
+		return fmt.Errorf("sending request to perflock daemon: %w", err)
+	}
+	for {
+		var resp ActionWatchResponse
+		if err := c.read(&resp); err != nil {
+			return err
+		}
+		if !update(resp) {
+			return nil
+		}
+	}
+}
+
+func (c *Client) Plan(a ActionAcquire) (ActionPlanResponse, error) {
+	var resp ActionPlanResponse
+	err := c.do(PerfLockAction{ActionPlan{a}}, &resp)
+	return resp, err
+}
+
+func (c *Client) QueryPower() (ActionQueryPowerResponse, error) {
+	var resp ActionQueryPowerResponse
+	err := c.do(PerfLockAction{ActionQueryPower{}}, &resp)
+	return resp, err
+}
+
+func (c *Client) Position(id int) (ActionPositionResponse, error) {
+	var resp ActionPositionResponse
+	if err := c.do(PerfLockAction{ActionPosition{ID: id}}, &resp); err != nil {
+		return resp, err
+	}
+	if resp.Err != "" {
+		return resp, fmt.Errorf("%s", resp.Err)
+	}
+	return resp, nil
+}
+
+func (c *Client) Stat() (ActionStatResponse, error) {
+	var resp ActionStatResponse
+	err := c.do(PerfLockAction{ActionStat{}}, &resp)
+	return resp, err
 }
 
 func (c *Client) SetGovernor(percent int) error {
-	var err string
-	c.do(PerfLockAction{ActionSetGovernor{Percent: percent}}, &err)
-	if err == "" {
+	var errString string
+	if err := c.do(PerfLockAction{ActionSetGovernor{Percent: percent}}, &errString); err != nil {
+		return err
+	}
+	if errString == "" {
 		return nil
 	}
-	return fmt.Errorf("%s", err)
+	return fmt.Errorf("%s", errString)
 }
@@ -0,0 +1,92 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientNoDaemon(t *testing.T) {
+	defer func(old []time.Duration) { dialBackoff = old }(dialBackoff)
+	dialBackoff = []time.Duration{time.Millisecond}
+
+	if _, err := NewClient(socketName(t)); err == nil {
+		t.Fatal("connecting without a daemon succeeded")
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	socket := socketName(t)
+
+	// Start listening only after the client's first attempt.
+	listening := make(chan net.Listener, 1)
+	time.AfterFunc(150*time.Millisecond, func() {
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Error(err)
+		}
+		listening <- l
+	})
+	c, err := NewClient(socket)
+	if l := <-listening; l != nil {
+		defer l.Close()
+	}
+	if err != nil {
+		t.Fatalf("connecting while the daemon starts: %v", err)
+	}
+	c.Close()
+}
+
+func TestClientDaemonExit(t *testing.T) {
+	socket := socketName(t)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// Hang up on the first connection.
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	c, err := NewClient(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.List(); err == nil {
+		t.Errorf("List after the daemon hung up succeeded")
+	}
+}
+
+func TestDefaultSocket(t *testing.T) {
+	if daemonListening(systemSocket) {
+		t.Skip("a system daemon is running")
+	}
+	dir := t.TempDir()
+	t.Setenv("PERFLOCK_SOCKET", "")
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	user := userSocket()
+
+	// A client uses a per-user daemon if there's no system daemon.
+	l, err := net.Listen("unix", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := defaultSocket(false, false); got != user {
+		t.Errorf("with a per-user daemon, got socket %s, want %s", got, user)
+	}
+
+	// But not a stale socket a per-user daemon left behind.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if got := defaultSocket(false, false); got != systemSocket {
+		t.Errorf("with a stale per-user socket, got socket %s, want %s", got, systemSocket)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultConfig is the default path of the daemon configuration
+// file. It is not an error for it to be missing.
+const defaultConfig = "/etc/perflock.json"
+
+// theConfig is the configuration of the running daemon.
+var theConfig daemonConfig
+
+// thePolicy is the policy in effect. It starts as theConfig.Policy,
+// but ActionReload may replace it while clients are being served.
+var thePolicy atomic.Pointer[policy]
+
+// daemonConfig is the daemon configuration. Fields without a JSON
+// name are set from command-line flags. The rest are read from the
+// configuration file.
+type daemonConfig struct {
+	// Socket is the path of the UNIX domain socket to listen on.
+	Socket string `json:"-"`
+
+	// GRPC, if non-empty, is the address to serve the gRPC API on.
+	GRPC string `json:"-"`
+
+	// Unprivileged indicates that the daemon runs as a normal user
+	// on behalf of only that user. It only accepts connections from
+	// its own user and does not modify system settings.
+	Unprivileged bool `json:"-"`
+
+	// DropPrivileges, if non-empty, is the user to serve clients as
+	// after starting up. Writes to system files are performed by a
+	// separate privileged helper process.
+	DropPrivileges string `json:"-"`
+
+	// Path is the configuration file, which ActionReload rereads.
+	// If it is defaultConfig, it need not exist.
+	Path string `json:"-"`
+
+	// Log configures where and what the daemon logs.
+	Log logConfig `json:"log"`
+
+	// Policy controls which users may perform which actions.
+	Policy policy `json:"policy"`
+
+	// Housekeeping lists the CPUs that are never reserved with
+	// -cores, in the Linux list format (for example, "0-1"). These
+	// are left for the kernel, the daemon itself, and other tasks.
+	// The default is CPU 0, unless that is the only CPU.
+	Housekeeping *string `json:"housekeeping"`
+
+	// IsolatedOnly restricts -cores to reserving CPUs the kernel
+	// has isolated with isolcpus or nohz_full. By default, isolated
+	// CPUs are reserved first, but other CPUs are used as well.
+	IsolatedOnly bool `json:"isolatedOnly"`
+
+	// Backfill lets a shared acquire whose -cores request fits in
+	// the free cores start ahead of earlier acquires that are
+	// waiting for more cores.
+	Backfill bool `json:"backfill"`
+
+	// BackfillMaxWait limits backfilling: once an acquire has
+	// waited this long for cores, later acquires may no longer
+	// start ahead of it. The default is 10 minutes.
+	BackfillMaxWait duration `json:"backfillMaxWait"`
+
+	// MaxQueue, if non-zero, limits the number of acquisitions that
+	// may be waiting for the lock. Further acquisitions that would
+	// have to wait are refused with a "queue full" error.
+	MaxQueue int `json:"maxQueue"`
+
+	// MaxQueuePerUser, if non-zero, limits the number of
+	// acquisitions each user may have waiting for the lock.
+	MaxQueuePerUser int `json:"maxQueuePerUser"`
+
+	// MaxShared, if non-zero, limits the number of shared
+	// acquisitions that may hold the lock at once, regardless of
+	// cores. Further shared acquisitions wait, as do any behind
+	// them.
+	MaxShared int `json:"maxShared"`
+
+	// MaxHugePages limits the number of huge pages an exclusive
+	// acquisition may add to the pool with -hugepages. The default,
+	// zero, disables huge page reservations, since the pages are
+	// taken from the memory available to everything else.
+	MaxHugePages int `json:"maxHugePages"`
+
+	// MaxLockedMemory limits how much of an exclusive command's
+	// memory -mlock protects from being reclaimed or swapped out, as
+	// a size such as "8G". The default, zero, disables -mlock, since
+	// protected memory can't be used by anything else under memory
+	// pressure.
+	MaxLockedMemory size `json:"maxLockedMemory"`
+
+	// GovernorHold is how long CPU frequency settings are kept after
+	// the exclusive lock holder that set them releases the lock, so
+	// a following job that requests the same settings doesn't have
+	// to wait for the CPUs to settle again. Meanwhile, commands that
+	// don't set the governor, such as shared commands, run with the
+	// held settings. Zero, the default, restores the settings
+	// immediately.
+	GovernorHold duration `json:"governorHold"`
+
+	// TelemetryInterval is how often the daemon samples the
+	// frequency of the CPUs an acquisition holds and the package
+	// temperature while it holds the lock. perflock -history reports
+	// a summary for each acquisition. If nil, it defaults to
+	// defaultTelemetryInterval. Zero disables sampling.
+	TelemetryInterval *duration `json:"telemetryInterval"`
+
+	// LoadGate, if set, delays granting exclusive locks until the
+	// load left on the host by commands outside perflock drops.
+	LoadGate *loadGateConfig `json:"loadGate"`
+
+	// Resctrl, if set, dedicates part of the L3 cache and memory
+	// bandwidth to each command that reserves cores, using Intel
+	// RDT or AMD PQoS through /sys/fs/resctrl.
+	Resctrl *resctrlConfig `json:"resctrl"`
+
+	// Hooks are shell commands run around exclusive acquisitions.
+	Hooks hooks `json:"hooks"`
+
+	// QuiesceUnits lists systemd units to stop while an exclusive
+	// lock is held, such as services that periodically wake up.
+	// Only units that were active are restarted afterwards.
+	QuiesceUnits []string `json:"quiesceUnits"`
+
+	// JobDir is the directory batch job output is written to. The
+	// default is /var/lib/perflock/jobs, or a directory in the
+	// user's cache directory for unprivileged daemons.
+	JobDir string `json:"jobDir"`
+
+	// DebugAddr, if non-empty, is a loopback address, such as
+	// "localhost:6060", to serve net/http/pprof profiles and expvar
+	// variables on, for diagnosing the running daemon.
+	DebugAddr string `json:"debugAddr"`
+
+	// AdminSocket, if non-empty, is the path of a second UNIX domain
+	// socket that only the daemon's user (usually root) may connect
+	// to. Clients connected to it may perform administrative
+	// actions, such as -dump, -log-level, and cancelling other
+	// users' jobs, and clients connected to Socket may not,
+	// regardless of Policy.Admin.
+	AdminSocket string `json:"adminSocket"`
+
+	// Webhook, if non-empty, is a URL the daemon posts a JSON
+	// webhookEvent to whenever the lock is acquired or released.
+	Webhook string `json:"webhook"`
+}
+
+// duration is a time.Duration that is represented in JSON as a
+// string such as "10m".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// size is a number of bytes that is represented in JSON as a string
+// such as "8G".
+type size int64
+
+func (sz *size) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := parseSize(s)
+	if err != nil {
+		return err
+	}
+	*sz = size(v)
+	return nil
+}
+
+// readConfig reads the configuration file at path into cfg. If
+// optional is set, it is not an error for path not to exist.
+func readConfig(path string, optional bool, cfg *daemonConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// policy is an authorization policy. Each field is a list of user
+// names, group names prefixed with "@", or "*" for everyone. A nil
+// list takes its default.
+type policy struct {
+	// Exclusive lists who may acquire the lock in exclusive mode.
+	// Everyone who may acquire it in exclusive mode may also
+	// acquire it in shared mode. The default is everyone.
+	Exclusive []string `json:"exclusive"`
+
+	// Shared lists who may acquire the lock in shared mode. The
+	// default is everyone.
+	Shared []string `json:"shared"`
+
+	// Admin lists who may perform administrative actions. The
+	// default is root.
+	Admin []string `json:"admin"`
+}
+
+// identity is the identity of a connected client.
+type identity struct {
+	uid, gid uint32
+	userName string
+}
+
+// canAcquire returns an error if id may not acquire the lock in the
+// given mode.
+func (p *policy) canAcquire(id identity, shared bool) error {
+	if p.matches(p.Exclusive, id, true) {
+		return nil
+	}
+	if shared && p.matches(p.Shared, id, true) {
+		return nil
+	}
+	if p.matches(p.Shared, id, true) {
+		return policyError(fmt.Sprintf("user %s may only acquire the lock in shared mode", id.userName))
+	}
+	return policyError(fmt.Sprintf("user %s may not acquire the lock", id.userName))
+}
+
+// policyError is an error for an action the policy doesn't allow.
+type policyError string
+
+func (e policyError) Error() string { return string(e) }
+
+// isAdmin returns whether id may perform administrative actions.
+func (p *policy) isAdmin(id identity) bool {
+	if p.Admin == nil {
+		return id.uid == 0
+	}
+	return p.matches(p.Admin, id, false)
+}
+
+func (p *policy) matches(list []string, id identity, def bool) bool {
+	if list == nil {
+		return def
+	}
+	var groups map[string]bool
+	for _, entry := range list {
+		if entry == "*" || entry == id.userName {
+			return true
+		}
+		if name, ok := strings.CutPrefix(entry, "@"); ok {
+			if groups == nil {
+				groups = groupNames(id)
+			}
+			if groups[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// groupNames returns the names of the groups id belongs to.
+func groupNames(id identity) map[string]bool {
+	gids := []string{fmt.Sprint(id.gid)}
+	if u, err := user.LookupId(fmt.Sprint(id.uid)); err == nil {
+		if more, err := u.GroupIds(); err == nil {
+			gids = append(gids, more...)
+		}
+	}
+	names := make(map[string]bool)
+	for _, gid := range gids {
+		if g, err := user.LookupGroupId(gid); err == nil {
+			names[g.Name] = true
+		}
+	}
+	return names
+}
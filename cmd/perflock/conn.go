@@ -0,0 +1,157 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// The daemon's socket is world-writable, so it must not trust
+// clients to be well-behaved. A client may stay connected for as long
+// as it holds the lock, but it must send its first message promptly,
+// finish each message it starts, and read the daemon's responses.
+var (
+	// handshakeTimeout bounds how long a new connection may take to
+	// send its first message.
+	handshakeTimeout = 10 * time.Second
+
+	// messageTimeout bounds how long a client may take to send the
+	// rest of a message once it has started it.
+	messageTimeout = 10 * time.Second
+
+	// writeTimeout bounds how long a response may take to send.
+	writeTimeout = 10 * time.Second
+)
+
+// maxMessageSize bounds the size of each gob message a client may
+// send. Requests are small, except for batch jobs, which include the
+// submitter's environment.
+const maxMessageSize = 1 << 20
+
+// msgReader reads gob messages from a client connection, enforcing
+// maxMessageSize and the read timeouts. It implements io.ByteReader
+// so gob doesn't buffer it, which means it sees exactly where each
+// message starts.
+//
+// Each gob message is a length followed by that many bytes. The
+// length is a gob unsigned integer: a single byte if it's less than
+// 128, or otherwise a byte holding the negated number of bytes that
+// follow, big-endian.
+type msgReader struct {
+	c net.Conn
+
+	// idleDeadline is the read deadline before a message starts.
+	idleDeadline time.Time
+
+	// started indicates that the current decode has read part of
+	// a message.
+	started bool
+
+	// lenBytes is the number of length bytes left to read, and n is
+	// the length read so far.
+	lenBytes int
+	n        uint64
+
+	// body is the number of bytes left in the current message.
+	body uint64
+}
+
+func newMsgReader(c net.Conn) *msgReader {
+	return &msgReader{c: c, idleDeadline: time.Now().Add(handshakeTimeout)}
+}
+
+// next prepares r to read the next request. Until it starts, the
+// client may be idle.
+func (r *msgReader) next() {
+	r.started = false
+	r.idleDeadline = time.Time{}
+}
+
+func (r *msgReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	deadline := r.idleDeadline
+	if r.started {
+		deadline = time.Now().Add(messageTimeout)
+	}
+	if err := r.c.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	if r.body > 0 {
+		if uint64(len(p)) > r.body {
+			p = p[:r.body]
+		}
+		n, err := r.c.Read(p)
+		r.body -= uint64(n)
+		if n > 0 {
+			r.started = true
+		}
+		return n, err
+	}
+
+	// Read the length a byte at a time.
+	n, err := r.c.Read(p[:1])
+	if n == 0 {
+		return n, err
+	}
+	r.started = true
+	b := p[0]
+	switch {
+	case r.lenBytes > 0:
+		r.n = r.n<<8 | uint64(b)
+		r.lenBytes--
+		if r.lenBytes == 0 {
+			if err := r.setBody(r.n); err != nil {
+				return 0, err
+			}
+		}
+	case b < 0x80:
+		r.setBody(uint64(b))
+	default:
+		r.lenBytes, r.n = int(-int8(b)), 0
+		if r.lenBytes > 8 {
+			return 0, fmt.Errorf("malformed message length")
+		}
+	}
+	return n, err
+}
+
+func (r *msgReader) setBody(n uint64) error {
+	if n > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds limit of %d", n, maxMessageSize)
+	}
+	r.body = n
+	return nil
+}
+
+func (r *msgReader) ReadByte() (byte, error) {
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// deadlineWriter writes responses to a client connection, giving up
+// if a write takes longer than writeTimeout.
+type deadlineWriter struct {
+	c net.Conn
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	if err := w.c.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return 0, err
+	}
+	return w.c.Write(p)
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// netPipe returns the ends of a connection that are closed when t
+// finishes.
+func netPipe(t *testing.T) (client, server net.Conn) {
+	client, server = net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestMsgReader(t *testing.T) {
+	client, server := netPipe(t)
+	go func() {
+		gw := gob.NewEncoder(client)
+		gw.Encode(PerfLockAction{ActionAcquire{Msg: "a"}})
+		gw.Encode(PerfLockAction{ActionList{}})
+	}()
+
+	r := newMsgReader(server)
+	gr := gob.NewDecoder(r)
+	for _, want := range []string{"main.ActionAcquire", "main.ActionList"} {
+		var msg PerfLockAction
+		if err := gr.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		r.next()
+		if got := fmt.Sprintf("%T", msg.Action); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestMsgReaderTooBig(t *testing.T) {
+	client, server := netPipe(t)
+	go gob.NewEncoder(client).Encode(PerfLockAction{ActionAcquire{Msg: strings.Repeat("x", maxMessageSize)}})
+
+	var msg PerfLockAction
+	err := gob.NewDecoder(newMsgReader(server)).Decode(&msg)
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("decoding oversized message: got %v, want size error", err)
+	}
+}
+
+func TestMsgReaderTimeout(t *testing.T) {
+	defer func(h, m time.Duration) { handshakeTimeout, messageTimeout = h, m }(handshakeTimeout, messageTimeout)
+	handshakeTimeout, messageTimeout = 50*time.Millisecond, 50*time.Millisecond
+
+	// A client that never sends anything is dropped.
+	_, server := netPipe(t)
+	var msg PerfLockAction
+	err := gob.NewDecoder(newMsgReader(server)).Decode(&msg)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("idle new connection: got %v, want deadline exceeded", err)
+	}
+
+	// So is one that stops in the middle of a message.
+	client, server := netPipe(t)
+	r := newMsgReader(server)
+	r.next()
+	go client.Write([]byte{0x10, 0x01})
+	err = gob.NewDecoder(r).Decode(&msg)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("partial message: got %v, want deadline exceeded", err)
+	}
+}
+
+// errListener is a net.Listener whose Accept returns errs in turn.
+type errListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *errListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, err
+}
+
+func TestAcceptConnsRetry(t *testing.T) {
+	// Running out of file descriptors doesn't stop the daemon from
+	// accepting connections, but closing the listener does.
+	l := &errListener{errs: []error{syscall.EMFILE, syscall.ENFILE, net.ErrClosed}}
+	done := make(chan struct{})
+	go func() {
+		acceptConns(l, false)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("acceptConns didn't return after the listener was closed")
+	}
+	if len(l.errs) != 0 {
+		t.Errorf("acceptConns returned with errors %v left", l.errs)
+	}
+}
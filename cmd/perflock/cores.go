@@ -0,0 +1,172 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/cputopology"
+)
+
+// coresPollInterval is how often the daemon checks whether the
+// online CPUs have changed.
+const coresPollInterval = 5 * time.Second
+
+// allowedCores is the set of CPUs the daemon was allowed to run on
+// when it started, or nil if it could run on every online CPU.
+var allowedCores *cpuset.Set
+
+// setupCores determines which cores can be reserved with -cores and
+// configures theLock accordingly.
+func setupCores(cfg *daemonConfig) error {
+	// Cores can be reserved from the CPUs the daemon may run on.
+	// If that's every online CPU, follow the online CPUs as they
+	// change.
+	affinity, err := cpuset.GetAffinity(0)
+	if errors.Is(err, errors.ErrUnsupported) {
+		slog.Info("CPU affinity isn't supported; core reservations are disabled")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	online, err := onlineCores()
+	if err != nil {
+		online = affinity
+	}
+	if extra := cpuset.Difference(&online, &affinity); extra.Count() > 0 {
+		allowedCores = &affinity
+	}
+	return configureCores(cfg, online)
+}
+
+// watchCores polls for changes to the online CPUs, such as from CPU
+// hotplug or toggling SMT, and reconfigures theLock when they change.
+func watchCores(cfg *daemonConfig) {
+	last, err := onlineCores()
+	if err != nil {
+		slog.Warn("not watching for CPU changes", "err", err)
+		return
+	}
+	for range time.Tick(coresPollInterval) {
+		online, err := onlineCores()
+		if err != nil || cpuset.Equal(&online, &last) {
+			continue
+		}
+		slog.Info("online CPUs changed", "from", cpuset.String(&last), "to", cpuset.String(&online))
+		last = online
+		if err := configureCores(cfg, online); err != nil {
+			slog.Error("reconfiguring cores", "err", err)
+		}
+	}
+}
+
+// onlineCores returns the set of online CPUs.
+func onlineCores() (cpuset.Set, error) {
+	data, err := ioutil.ReadFile("/sys/devices/system/cpu/online")
+	if err != nil {
+		return cpuset.Set{}, err
+	}
+	return cpuset.Parse(string(data))
+}
+
+// configureCores configures theLock to reserve cores from online,
+// the set of online CPUs.
+func configureCores(cfg *daemonConfig, online cpuset.Set) error {
+	allCores := online
+	if allowedCores != nil {
+		allCores = cpuset.Intersect(&online, allowedCores)
+	}
+
+	// Keep the housekeeping cores for everything else.
+	var housekeeping cpuset.Set
+	if cfg.Housekeeping != nil {
+		var err error
+		housekeeping, err = cpuset.Parse(*cfg.Housekeeping)
+		if err != nil {
+			return fmt.Errorf("housekeeping: %w", err)
+		}
+	} else if cpus := cpuset.ToSlice(&allCores); len(cpus) > 1 {
+		housekeeping.Set(cpus[0])
+	}
+	cores := cpuset.Difference(&allCores, &housekeeping)
+	if housekeeping.Count() > 0 {
+		// Keep the daemon itself off the reservable cores.
+		hk := cpuset.Intersect(&allCores, &housekeeping)
+		if err := setProcessAffinity(&hk); err != nil {
+			slog.Warn("restricting daemon to housekeeping cores", "err", err)
+		}
+	}
+
+	topo, err := cputopology.Read()
+	if err != nil {
+		slog.Warn("reading CPU topology; topology constraints are disabled", "err", err)
+	} else if cfg.IsolatedOnly {
+		// Only reserve cores the kernel has isolated.
+		cores = cpuset.Intersect(&cores, &topo.Isolated)
+		if cores.Count() == 0 {
+			slog.Warn("isolatedOnly is set, but there are no isolated CPUs")
+		}
+	}
+	theLock.SetCores(allCores, cores, topo)
+	return nil
+}
+
+// setProcessAffinity restricts all threads of this process to the
+// CPUs in set.
+func setProcessAffinity(set *cpuset.Set) error {
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := cpuset.SetAffinity(tid, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// percentOfCores returns pct percent of n cores, rounded down but at
+// least one.
+func percentOfCores(n, pct int) int {
+	return max(n*pct/100, 1)
+}
+
+// resolveCoresPercent replaces a.CoresPercent with the number of
+// cores it amounts to for s's client: a percentage of the reservable
+// cores the client may run on, or of all reservable cores if the
+// client's affinity is unknown.
+func (s *Server) resolveCoresPercent(a *ActionAcquire) error {
+	if a.CoresPercent == 0 {
+		return nil
+	}
+	if a.CoresPercent < 0 || a.CoresPercent > 100 {
+		return fmt.Errorf("cannot reserve %d%% of cores", a.CoresPercent)
+	}
+	if a.Cores != 0 || a.CPUs.Count() > 0 {
+		return fmt.Errorf("cannot combine a percentage of cores with a number of cores or specific CPUs")
+	}
+	avail := theLock.Reservable()
+	if s.pid != 0 {
+		if affinity, err := cpuset.GetAffinity(s.pid); err == nil {
+			avail = cpuset.Intersect(&avail, &affinity)
+		}
+	}
+	if avail.Count() == 0 {
+		return fmt.Errorf("no reservable cores are available to reserve %d%% of", a.CoresPercent)
+	}
+	a.Cores, a.CoresPercent = percentOfCores(avail.Count(), a.CoresPercent), 0
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || freebsd
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// The BSDs can't send credentials as a control message the way Linux
+// does, so the client sends a plain byte to keep the same framing and
+// the daemon asks the kernel for the peer's credentials instead.
+
+func writeCredentials(c *net.UnixConn) error {
+	n, err := c.Write([]byte("x"))
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("short send (%d bytes)", n)
+	}
+	return nil
+}
+
+func readCredentials(c *net.UnixConn) (*ucred, error) {
+	buf := make([]byte, 1)
+	n, err := c.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("expected 1 byte, got %d", n)
+	}
+	return readPeerCredentials(c)
+}
+
+// readPeerCredentials returns the credentials of the process that
+// connected c, as recorded by the kernel at connect time. Pid is not
+// reported.
+func readPeerCredentials(c *net.UnixConn) (*ucred, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *unix.Xucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	if cred.Ngroups < 1 {
+		return nil, fmt.Errorf("peer credentials have no group")
+	}
+	// The first group is the effective group ID.
+	return &ucred{Uid: cred.Uid, Gid: cred.Groups[0]}, nil
+}
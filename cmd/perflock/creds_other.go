@@ -0,0 +1,27 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// The daemon identifies clients by their socket credentials, which
+// are only implemented on Linux, macOS, and FreeBSD.
+
+func writeCredentials(c *net.UnixConn) error {
+	return nil
+}
+
+func readCredentials(c *net.UnixConn) (*ucred, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func readPeerCredentials(c *net.UnixConn) (*ucred, error) {
+	return nil, errors.ErrUnsupported
+}
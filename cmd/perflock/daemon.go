@@ -6,67 +6,284 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/user"
-	"runtime"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aclements/perflock/internal/cpupower"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 var theLock PerfLock
 
-func doDaemon(path string) {
+// progressInterval is how often the daemon sends progress updates to
+// waiting clients that requested them, if their position doesn't
+// change.
+const progressInterval = 30 * time.Second
+
+func doDaemon(cfg daemonConfig) {
 	// TODO: Don't start if another daemon is already running.
 
-	// Linux supports an abstract namespace for UNIX domain sockets (see unix(7)).
-	// These do not involve the filesystem, and are world-connectable.
-	isAbstractSocket := runtime.GOOS == "linux" && len(path) > 1 && path[0] == '@'
-	if !isAbstractSocket {
-		os.Remove(path)
+	theConfig = cfg
+	path, grpcAddr := cfg.Socket, cfg.GRPC
+	if err := setupLogging(cfg.Log); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Unprivileged {
+		slog.Info("running unprivileged; CPU governor control is disabled")
+	}
+
+	if err := setupCores(&cfg); err != nil {
+		log.Fatal(err)
 	}
-	l, err := net.Listen("unix", path)
+	go watchCores(&cfg)
+	if cfg.Resctrl != nil {
+		if cfg.Unprivileged {
+			slog.Info("running unprivileged; cache partitioning is disabled")
+		} else if err := setupResctrl(*cfg.Resctrl); err != nil {
+			slog.Warn("setting up resctrl; cache partitioning is disabled", "err", err)
+		}
+	}
+	if !cfg.Unprivileged {
+		setupCgroups()
+	}
+	if cfg.TelemetryInterval != nil {
+		telemetryInterval = time.Duration(*cfg.TelemetryInterval)
+	}
+	applyConfig(&cfg)
+
+	l, err := listenSocket(path)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer l.Close()
-	if !isAbstractSocket {
-		err = os.Chmod(path, 0777)
+
+	var grpcL net.Listener
+	var grpcCreds credentials.TransportCredentials
+	if grpcAddr != "" {
+		grpcL, grpcCreds, err = listenGRPC(grpcAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var adminL net.Listener
+	if cfg.AdminSocket != "" {
+		adminL, err = listenAdmin(cfg.AdminSocket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer adminL.Close()
+	}
+
+	var debugL net.Listener
+	if cfg.DebugAddr != "" {
+		debugL, err = listenDebug(cfg.DebugAddr)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
+	if cfg.DropPrivileges != "" {
+		if err := startHelper(helperConfig{Hooks: cfg.Hooks, Units: cfg.QuiesceUnits}); err != nil {
+			log.Fatal("starting privileged helper: ", err)
+		}
+		if err := dropPrivileges(cfg.DropPrivileges); err != nil {
+			log.Fatal("dropping privileges: ", err)
+		}
+	}
+
+	var grpcSrv *grpc.Server
+	if grpcL != nil {
+		grpcSrv = newGRPCServer(grpcCreds)
+		go func() {
+			log.Fatal(grpcSrv.Serve(grpcL))
+		}()
+	}
+	if debugL != nil {
+		go func() {
+			log.Fatal(serveDebug(debugL))
+		}()
+	}
+
 	// Receive connections.
+	go acceptConns(l, false)
+	if adminL != nil {
+		go acceptConns(adminL, true)
+	}
+
+	sig := waitForShutdown()
+	slog.Info("shutting down", "signal", sig)
+	close(shutdownC)
+	l.Close()
+	removeSocket(path)
+	if adminL != nil {
+		adminL.Close()
+		os.Remove(cfg.AdminSocket)
+	}
+	if grpcSrv != nil {
+		grpcSrv.Stop()
+		if path, ok := strings.CutPrefix(grpcAddr, "unix:"); ok {
+			removeSocket(path)
+		}
+	}
+	shutdown()
+	slog.Info("shut down")
+}
+
+// applyConfig applies the settings in cfg that may change while the
+// daemon is running: the policy, the queue, huge page, and locked
+// memory limits, backfilling, and the governor hold time.
+func applyConfig(cfg *daemonConfig) {
+	p := cfg.Policy
+	thePolicy.Store(&p)
+	maxHugePages.Store(int64(cfg.MaxHugePages))
+	maxLockedMemory.Store(int64(cfg.MaxLockedMemory))
+	theGovernor.Lock()
+	theGovernor.hold = time.Duration(cfg.GovernorHold)
+	theGovernor.Unlock()
+	var backfillMaxWait time.Duration
+	if cfg.Backfill {
+		backfillMaxWait = 10 * time.Minute
+		if cfg.BackfillMaxWait != 0 {
+			backfillMaxWait = time.Duration(cfg.BackfillMaxWait)
+		}
+	}
+	theLock.SetLimits(cfg.MaxQueue, cfg.MaxQueuePerUser, cfg.MaxShared, backfillMaxWait)
+}
+
+// reload rereads the configuration file for s and applies the settings
+// that may change while the daemon is running. The others take effect
+// when the daemon restarts.
+func (s *Server) reload() error {
+	if !s.isAdmin() {
+		return fmt.Errorf("only administrators may reload the configuration")
+	}
+	var cfg daemonConfig
+	if err := readConfig(theConfig.Path, theConfig.Path == defaultConfig, &cfg); err != nil {
+		s.log.Warn("reloading configuration", "err", err)
+		return err
+	}
+	applyConfig(&cfg)
+	s.log.Info("reloaded configuration", "path", theConfig.Path)
+	return nil
+}
+
+// pause pauses or resumes granting the lock for s.
+func (s *Server) pause(paused bool) error {
+	if !s.isAdmin() {
+		return fmt.Errorf("only administrators may pause the queue")
+	}
+	theLock.SetPaused(paused)
+	if paused {
+		s.log.Info("paused the queue")
+	} else {
+		s.log.Info("resumed the queue")
+	}
+	return nil
+}
+
+// acceptMaxDelay is the longest acceptConns waits before trying to
+// accept a connection again after an error.
+const acceptMaxDelay = time.Second
+
+// acceptConns serves the connections to l until l is closed. If admin
+// is set, l is the admin socket. Other errors, such as running out of
+// file descriptors, may clear up as clients disconnect, so it keeps
+// trying, backing off up to acceptMaxDelay.
+func acceptConns(l net.Listener, admin bool) {
+	var delay time.Duration
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			log.Fatal(err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			delay = min(max(2*delay, 5*time.Millisecond), acceptMaxDelay)
+			slog.Error("accepting connection", "err", err, "retry", delay)
+			time.Sleep(delay)
+			continue
 		}
+		delay = 0
 
 		go func(c net.Conn) {
 			defer c.Close()
-			NewServer(c).Serve()
+			s := NewServer(c)
+			s.admin = admin
+			s.Serve()
 		}(conn)
 	}
 }
 
 type Server struct {
-	c        net.Conn
-	userName string
+	c  net.Conn
+	id identity
+
+	// admin indicates that the client connected to the admin
+	// socket.
+	admin bool
+
+	// log logs events for this connection.
+	log *slog.Logger
 
 	locker    *Locker
 	acquiring bool
 
-	oldGovernors []*governorSettings
+	// exclusive indicates that s holds an exclusive lock and has
+	// called enterExclusive.
+	exclusive bool
+
+	// reservation is the ID of s's reservation, or 0.
+	reservation int
+
+	// governorSet indicates that s applied CPU governor settings
+	// with setGovernor.
+	governorSet bool
+
+	// resctrl is the resctrl group of s's reserved cores, if any.
+	resctrl *resctrlGroup
+
+	// telemetry samples the CPU frequency and temperature while s
+	// holds the lock, if enabled.
+	telemetry *telemetrySampler
+
+	// pid is the client's process ID, or 0 if it is unknown.
+	pid int
+
+	// acquire is s's acquire request.
+	acquire ActionAcquire
+
+	// hugePages is the huge pages reserved for s, if any.
+	hugePages *hugePages
+
+	// cgroup is the cgroup that locks the memory of s's command or
+	// limits its resources, if any.
+	cgroup *commandCgroup
+
+	// swapDisabled indicates that s called disableSwap.
+	swapDisabled bool
 }
 
 func NewServer(c net.Conn) *Server {
-	return &Server{c: c}
+	return &Server{c: c, log: connLogger()}
+}
+
+// isAdmin returns whether s may perform administrative actions. If
+// the daemon has an admin socket, only its clients may.
+func (s *Server) isAdmin() bool {
+	if theConfig.AdminSocket != "" {
+		return s.admin
+	}
+	return thePolicy.Load().isAdmin(s.id)
 }
 
 func (s *Server) Serve() {
@@ -75,28 +292,44 @@ func (s *Server) Serve() {
 
 	// Get connection credentials.
 	ucred, err := readCredentials(s.c.(*net.UnixConn))
+	if err == io.EOF {
+		// Clients connect and hang up to check that the daemon
+		// is listening.
+		s.log.Debug("closed before sending credentials")
+		return
+	}
 	if err != nil {
-		log.Print("reading credentials: ", err)
+		s.log.Warn("reading credentials", "err", err)
 		return
 	}
 
-	u, err := user.LookupId(fmt.Sprintf("%d", ucred.Uid))
-	s.userName = "???"
-	if err == nil {
-		s.userName = u.Username
+	if theConfig.Unprivileged && int(ucred.Uid) != os.Getuid() {
+		s.log.Warn("rejecting connection", "uid", ucred.Uid)
+		return
 	}
+	if s.admin && int(ucred.Uid) != adminUID && ucred.Uid != 0 {
+		s.log.Warn("rejecting admin connection", "uid", ucred.Uid)
+		return
+	}
+	s.id = identity{ucred.Uid, ucred.Gid, lookupUserName(ucred.Uid)}
+	s.pid = int(ucred.Pid)
+	s.log = s.log.With("user", s.id.userName)
+	s.log.Debug("connected")
+	defer s.log.Debug("disconnected")
 
 	// Receive incoming actions. We do this in a goroutine so the
 	// main handler can select on EOF or lock acquisition.
 	actions := make(chan PerfLockAction)
 	go func() {
-		gr := gob.NewDecoder(s.c)
+		r := newMsgReader(s.c)
+		gr := gob.NewDecoder(r)
 		for {
 			var msg PerfLockAction
 			err := gr.Decode(&msg)
+			r.next()
 			if err != nil {
 				if err != io.EOF {
-					log.Print(err)
+					s.log.Warn("reading request", "err", err)
 				}
 				close(actions)
 				return
@@ -107,156 +340,773 @@ func (s *Server) Serve() {
 
 	// Process incoming actions.
 	var acquireC <-chan bool
-	gw := gob.NewEncoder(s.c)
+	var progress bool
+	var lastPos int
+	var lastSent time.Time
+	var waitJob *job
+	var watching bool
+	// gateC receives the result of the load gate, if s holds the
+	// lock but is waiting for the load to drop. Closing gateStop
+	// stops waiting.
+	var gateC <-chan string
+	var gateStop chan struct{}
+	defer func() {
+		if gateStop != nil {
+			close(gateStop)
+		}
+	}()
+	gw := gob.NewEncoder(deadlineWriter{s.c})
 	for {
+		// If the client wants progress updates, send one when
+		// its position changes and periodically for the ETA,
+		// unless it has already acquired the lock.
+		var changedC <-chan struct{}
+		var progressC <-chan time.Time
+		if s.acquiring && progress && len(acquireC) == 0 && gateC == nil {
+			changedC = theLock.Changed()
+			pos := theLock.Position(s.locker)
+			if pos != lastPos || time.Since(lastSent) >= progressInterval {
+				eta, _ := theLock.ETA(s.locker)
+				if err := gw.Encode(ActionAcquireResponse{Waiting: true, Position: pos, ETA: eta, ID: s.locker.ID()}); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+				lastPos, lastSent = pos, time.Now()
+			}
+			progressC = time.After(progressInterval - time.Since(lastSent))
+		}
+		if watching {
+			changedC = theLock.Changed()
+			resp := ActionWatchResponse{List: queue(), All: theLock.All(), Reservable: theLock.Reservable(), Paused: theLock.Paused()}
+			if err := gw.Encode(resp); err != nil {
+				s.log.Warn("sending response", "err", err)
+				return
+			}
+		}
+		var jobDoneC <-chan struct{}
+		if waitJob != nil {
+			jobDoneC = waitJob.done
+		}
+		var evictedC <-chan struct{}
+		if s.locker != nil {
+			evictedC = s.locker.Evicted()
+		}
+
 		select {
 		case action, ok := <-actions:
 			if !ok {
 				// Connection closed.
 				return
 			}
-			if s.acquiring {
-				log.Printf("protocol error: message while acquiring")
+			if watching {
+				s.log.Warn("protocol error: message while watching", "action", fmt.Sprintf("%T", action.Action))
 				return
 			}
+			if s.acquiring {
+				if _, ok := action.Action.(ActionCancel); !ok {
+					s.log.Warn("protocol error: message while acquiring", "action", fmt.Sprintf("%T", action.Action))
+					return
+				}
+				s.cancel()
+				acquireC = nil
+				if gateStop != nil {
+					close(gateStop)
+					gateC, gateStop = nil, nil
+				}
+				if err := gw.Encode(ActionAcquireResponse{Cancelled: true}); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+				break
+			}
 			switch action := action.Action.(type) {
 			case ActionAcquire:
 				if s.locker != nil {
-					log.Printf("protocol error: acquiring lock twice")
+					s.log.Warn("protocol error: acquiring lock twice")
 					return
 				}
-				msg := fmt.Sprintf("%s\t%s\t%s", s.userName, time.Now().Format(time.Stamp), action.Msg)
-				if action.Shared {
-					msg += " [shared]"
-				}
-				s.locker = theLock.Enqueue(action.Shared, action.NonBlocking, msg)
-				if s.locker != nil {
+				if err := s.enqueue(action); err != nil {
+					resp := ActionAcquireResponse{Err: err.Error(), QueueFull: errors.Is(err, errQueueFull)}
+					if err := gw.Encode(resp); err != nil {
+						s.log.Warn("sending response", "err", err)
+						return
+					}
+				} else if s.locker != nil {
 					// Enqueued. Wait for acquire.
-					s.acquiring = true
 					acquireC = s.locker.C
+					progress, lastPos = action.Progress, -1
 				} else {
 					// Non-blocking acquire failed.
-					if err := gw.Encode(false); err != nil {
-						log.Print(err)
+					if err := gw.Encode(ActionAcquireResponse{Acquired: false}); err != nil {
+						s.log.Warn("sending response", "err", err)
 						return
 					}
 				}
 
+			case ActionReserve:
+				if err := gw.Encode(s.reserve(action)); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionSubmit:
+				if err := gw.Encode(s.submit(action)); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionHistory:
+				if err := gw.Encode(history()); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionJobs:
+				if err := gw.Encode(jobs()); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionWaitJob:
+				if waitJob = findJob(action.ID); waitJob == nil {
+					if err := gw.Encode(ActionWaitJobResponse{Err: fmt.Sprintf("no job %d", action.ID)}); err != nil {
+						s.log.Warn("sending response", "err", err)
+						return
+					}
+				}
+
+			case ActionCancelJob:
+				errString := ""
+				if err := s.cancelJob(action.ID); err != nil {
+					errString = err.Error()
+				}
+				if err := gw.Encode(errString); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionEvict:
+				errString := ""
+				if err := s.evict(action.ID); err != nil {
+					errString = err.Error()
+				}
+				if err := gw.Encode(errString); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionPause:
+				errString := ""
+				if err := s.pause(action.Paused); err != nil {
+					errString = err.Error()
+				}
+				if err := gw.Encode(errString); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionReload:
+				errString := ""
+				if err := s.reload(); err != nil {
+					errString = err.Error()
+				}
+				if err := gw.Encode(errString); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionSetLogLevel:
+				errString := ""
+				if err := s.setLogLevel(action.Level); err != nil {
+					errString = err.Error()
+				}
+				if err := gw.Encode(errString); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionDump:
+				if err := gw.Encode(s.dump()); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionCancel:
+				// The acquire being cancelled
+				// completed first. The client will
+				// release it.
+
 			case ActionList:
-				list := theLock.Queue()
+				list := queue()
 				if err := gw.Encode(list); err != nil {
-					log.Print(err)
+					s.log.Warn("sending response", "err", err)
 					return
 				}
 
 			case ActionSetGovernor:
 				if s.locker == nil {
-					log.Printf("protocol error: setting governor without lock")
+					s.log.Warn("protocol error: setting governor without lock")
 					return
 				}
-				err := s.setGovernor(action.Percent)
+				var err error
+				if s.locker.monitor {
+					err = fmt.Errorf("monitors cannot set the CPU governor")
+				} else {
+					err = s.setGovernor(action.Percent)
+				}
 				errString := ""
 				if err != nil {
 					errString = err.Error()
+					theStats.governorError()
 				}
 				if err := gw.Encode(errString); err != nil {
-					log.Print(err)
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionPlan:
+				if err := gw.Encode(s.plan(action.Acquire)); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionQueryPower:
+				if err := gw.Encode(queryPower()); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionPosition:
+				if err := gw.Encode(position(action.ID)); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+
+			case ActionWatch:
+				// The loop sends the first update.
+				watching = true
+
+			case ActionStat:
+				if err := gw.Encode(theStats.stat()); err != nil {
+					s.log.Warn("sending response", "err", err)
 					return
 				}
 
 			default:
-				log.Printf("unknown message")
+				s.log.Warn("protocol error: unknown message", "action", fmt.Sprintf("%T", action))
 				return
 			}
 
-		case <-acquireC:
-			// Lock acquired.
+		case <-jobDoneC:
+			if err := gw.Encode(ActionWaitJobResponse{Job: waitJob.Info()}); err != nil {
+				s.log.Warn("sending response", "err", err)
+				return
+			}
+			waitJob = nil
+
+		case <-evictedC:
+			s.log.Info("evicted", "id", s.locker.ID())
+			if s.acquiring {
+				s.cancel()
+				acquireC = nil
+				if gateStop != nil {
+					close(gateStop)
+					gateC, gateStop = nil, nil
+				}
+				if err := gw.Encode(ActionAcquireResponse{Err: errEvicted}); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+				break
+			}
+			// Stop the client's command. Returning releases the
+			// lock even if the client ignores the signal.
+			if s.pid != 0 {
+				if err := terminate(s.pid); err != nil {
+					s.log.Warn("terminating evicted client", "pid", s.pid, "err", err)
+				}
+			}
+			return
+
+		case <-changedC:
+		case <-progressC:
+
+		case <-shutdownC:
+			if s.acquiring {
+				if err := gw.Encode(ActionAcquireResponse{Err: errShuttingDown, ShuttingDown: true}); err != nil {
+					s.log.Warn("sending response", "err", err)
+				}
+			}
+			return
+
+		case ok := <-acquireC:
 			s.acquiring, acquireC = false, nil
-			if err := gw.Encode(true); err != nil {
-				log.Print(err)
+			if !ok {
+				// Lock refused. The locker is already
+				// dequeued.
+				err := s.locker.Err()
+				s.locker = nil
+				if err := gw.Encode(ActionAcquireResponse{Err: err.Error()}); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+				break
+			}
+			// Lock acquired.
+			stop := make(chan struct{})
+			if c, max := s.startGate(stop); c != nil {
+				// Hold the lock, but wait for the load to
+				// drop before granting it.
+				if err := gw.Encode(ActionAcquireResponse{Waiting: true, ID: s.locker.ID(), LoadGate: max}); err != nil {
+					s.log.Warn("sending response", "err", err)
+					return
+				}
+				s.acquiring, gateC, gateStop = true, c, stop
+				break
+			}
+			if err := gw.Encode(s.grant("")); err != nil {
+				s.log.Warn("sending response", "err", err)
+				return
+			}
+
+		case warning := <-gateC:
+			s.acquiring, gateC, gateStop = false, nil, nil
+			if err := gw.Encode(s.grant(warning)); err != nil {
+				s.log.Warn("sending response", "err", err)
 				return
 			}
 		}
 	}
 }
 
-func (s *Server) drop() {
-	// Restore the CPU governor before releasing the lock.
-	if s.oldGovernors != nil {
-		s.restoreGovernor()
-		s.oldGovernors = nil
+// errEvicted is the error reported to a client whose waiting
+// acquisition was evicted.
+const errEvicted = "evicted by an administrator"
+
+// evict evicts acquisition id for s.
+func (s *Server) evict(id int) error {
+	if !s.isAdmin() {
+		return fmt.Errorf("only administrators may evict acquisitions")
 	}
-	// Release the lock.
-	if s.locker != nil {
-		theLock.Dequeue(s.locker)
-		s.locker = nil
+	if findJob(id) != nil {
+		return s.cancelJob(id)
+	}
+	if err := theLock.Evict(id); err != nil {
+		return err
 	}
+	s.log.Info("evicting", "id", id)
+	return nil
 }
 
-type governorSettings struct {
-	domain   *cpupower.Domain
-	min, max int
+// terminate sends SIGTERM to process pid.
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGTERM)
 }
 
-func (s *Server) setGovernor(percent int) error {
-	domains, err := cpupower.Domains()
+// enqueue checks acquire a for s and enqueues it. If a is non-blocking
+// and the lock isn't free, s.locker is left nil.
+func (s *Server) enqueue(a ActionAcquire) error {
+	err := s.resolveCoresPercent(&a)
+	if err == nil {
+		err = s.checkAcquire(a)
+	}
 	if err != nil {
+		s.log.Info("refused acquire", "err", err)
 		return err
 	}
-	if len(domains) == 0 {
-		return fmt.Errorf("no power domains")
+	s.acquire = a
+	s.locker, err = theLock.EnqueueAs(a, s.id.userName, s.lockMsg(a), 0)
+	if err != nil {
+		return err
 	}
+	if s.locker != nil {
+		s.log.Debug("enqueued", "id", s.locker.ID(), "shared", a.Shared, "command", a.Msg)
+		s.acquiring = true
+	}
+	return nil
+}
 
-	// Save current frequency settings.
-	old := []*governorSettings{}
-	for _, d := range domains {
-		min, max, err := d.CurrentRange()
+// startGate starts waiting for the host load to drop, if s's acquire
+// is gated, once s holds the lock. It returns a channel that receives
+// a warning, or "", when the gate opens, and the gate's threshold. If
+// the acquire isn't gated, it returns a nil channel. Closing stop
+// stops waiting.
+func (s *Server) startGate(stop <-chan struct{}) (<-chan string, float64) {
+	g := newLoadGate(s.acquire)
+	if g == nil {
+		return nil, 0
+	}
+	id, log := s.locker.ID(), s.log
+	c := make(chan string, 1)
+	go func() {
+		warning, _ := g.wait(log, id, stop)
+		c <- warning
+	}()
+	return c, g.max
+}
+
+// grant prepares the system for s, which holds the lock and has passed
+// the load gate, and returns the response telling the client it
+// acquired the lock, including the gate's warning, if any.
+func (s *Server) grant(gateWarning string) ActionAcquireResponse {
+	if err := s.prepare(); err != nil {
+		return ActionAcquireResponse{Err: err.Error()}
+	}
+	var warnings []string
+	if gateWarning != "" {
+		warnings = append(warnings, gateWarning)
+	}
+	return ActionAcquireResponse{
+		Acquired: true,
+		Cores:    s.locker.Cores(),
+		Topology: theLock.Topology(s.locker),
+		Affinity: s.locker.Affinity(),
+		Warnings: append(warnings, s.acquired()...),
+	}
+}
+
+// maxMsgLen is the longest command description a client may send.
+const maxMsgLen = 4096
+
+// checkAcquire returns an error if s may not perform acquire a.
+func (s *Server) checkAcquire(a ActionAcquire) error {
+	if err := validateAcquire(a); err != nil {
+		return err
+	}
+	// Monitors don't affect others, so they only need permission
+	// to acquire the lock in shared mode.
+	if err := thePolicy.Load().canAcquire(s.id, a.Shared || a.Monitor); err != nil {
+		return err
+	}
+	if a.Reservation != 0 {
+		if a.Shared || a.Reservation != s.reservation || !theLock.hasReservation(a.Reservation) {
+			return fmt.Errorf("no such reservation")
+		}
+	}
+	return theLock.CheckCores(a)
+}
+
+// validateAcquire returns an error if a is malformed.
+func validateAcquire(a ActionAcquire) error {
+	if len(a.Msg) > maxMsgLen {
+		return fmt.Errorf("command description is longer than %d bytes", maxMsgLen)
+	}
+	if a.Cores < 0 {
+		return fmt.Errorf("cannot reserve %d cores", a.Cores)
+	}
+	switch a.Topology {
+	case TopologyAny, TopologySameL3, TopologySameSocket:
+	default:
+		return fmt.Errorf("unknown topology %q", a.Topology)
+	}
+	if a.Reservation < 0 {
+		return fmt.Errorf("no such reservation")
+	}
+	if a.HugePages < 0 {
+		return fmt.Errorf("cannot reserve %d huge pages", a.HugePages)
+	}
+	if a.HugePages > 0 && a.Shared {
+		return fmt.Errorf("reserving huge pages requires an exclusive lock")
+	}
+	if err := checkHugePages(a.HugePages); err != nil {
+		return err
+	}
+	if a.Shared && (a.LockMemory || a.NoSwap) {
+		return fmt.Errorf("locking memory and disabling swap require an exclusive lock")
+	}
+	if a.LockMemory && maxLockedMemory.Load() == 0 {
+		return errLockMemoryDisabled
+	}
+	if a.MemoryMax < 0 {
+		return fmt.Errorf("invalid memory limit %d", a.MemoryMax)
+	}
+	if a.CPUMax < 0 {
+		return fmt.Errorf("invalid CPU limit %d%%", a.CPUMax)
+	}
+	if (a.MemoryMax > 0 || a.CPUMax > 0) && !a.Shared {
+		return fmt.Errorf("memory and CPU limits require a shared lock")
+	}
+	if a.MaxLoad < 0 {
+		return fmt.Errorf("invalid maximum load %g", a.MaxLoad)
+	}
+	if a.MaxLoad > 0 && (a.Shared || a.Monitor) {
+		return fmt.Errorf("a maximum load requires an exclusive lock")
+	}
+	if a.Monitor && (a.Shared || a.Cores > 0 || a.CPUs.Count() > 0 || a.Topology != TopologyAny || a.Reservation != 0 || a.HugePages > 0 || a.LockMemory || a.NoSwap || a.MemoryMax > 0 || a.CPUMax > 0) {
+		return fmt.Errorf("a monitor acquire cannot be shared, reserve cores or huge pages, or change resource settings")
+	}
+	return nil
+}
+
+// reserve performs reservation r for s.
+func (s *Server) reserve(r ActionReserve) ActionReserveResponse {
+	if len(r.Msg) > maxMsgLen {
+		return ActionReserveResponse{Err: fmt.Sprintf("command description is longer than %d bytes", maxMsgLen)}
+	}
+	if err := thePolicy.Load().canAcquire(s.id, false); err != nil {
+		return ActionReserveResponse{Err: err.Error()}
+	}
+	if s.reservation != 0 {
+		return ActionReserveResponse{Err: "already have a reservation"}
+	}
+	id, err := theLock.Reserve(r.Start, r.Duration, s.id.userName, r.Msg)
+	if err != nil {
+		return ActionReserveResponse{Err: err.Error()}
+	}
+	s.reservation = id
+	return ActionReserveResponse{ID: id}
+}
+
+// plan returns what would happen if s performed acquire a now.
+func (s *Server) plan(a ActionAcquire) ActionPlanResponse {
+	if err := s.resolveCoresPercent(&a); err != nil {
+		return ActionPlanResponse{Err: err.Error()}
+	}
+	if err := s.checkAcquire(a); err != nil {
+		return ActionPlanResponse{Err: err.Error()}
+	}
+	locker, ahead := theLock.Plan(a)
+	if locker == nil {
+		return ActionPlanResponse{Ahead: ahead}
+	}
+	return ActionPlanResponse{
+		Acquired: true,
+		Cores:    locker.Cores(),
+		Topology: theLock.Topology(locker),
+		Affinity: locker.Affinity(),
+	}
+}
+
+// lockMsg returns the queue entry for an acquisition by s.
+func (s *Server) lockMsg(a ActionAcquire) string {
+	e := ListEntry{
+		User:     s.id.userName,
+		Command:  a.Msg,
+		Enqueued: time.Now(),
+		Shared:   a.Shared,
+		Monitor:  a.Monitor,
+		Cores:    a.Cores,
+		CPUs:     a.CPUs,
+		Topology: a.Topology,
+	}
+	return e.String()
+}
+
+// queue returns the entries of the lock queue.
+func queue() []ListEntry {
+	list := theLock.Queue()
+	for i := range list {
+		list[i].Job = findJob(list[i].ID) != nil
+	}
+	return list
+}
+
+func lookupUserName(uid uint32) string {
+	u, err := user.LookupId(fmt.Sprintf("%d", uid))
+	if err != nil {
+		return "???"
+	}
+	return u.Username
+}
+
+// webhook posts event for s's acquisition to the configured webhook.
+func (s *Server) webhook(event string) {
+	postWebhook(webhookEvent{Event: event, User: s.id.userName, Command: s.locker.cmd, Shared: s.locker.shared})
+}
+
+// prepare reserves the huge pages, confines the client to a cgroup,
+// and disables swapping as requested by s's acquire, which just
+// succeeded. If any of these fail, it undoes the others and releases
+// the lock. Batch jobs have no client process, so they call confine
+// once they start instead.
+func (s *Server) prepare() error {
+	var err error
+	if n := s.acquire.HugePages; n > 0 {
+		s.hugePages, err = reserveHugePages(n, s.locker.Cores())
+	}
+	if err == nil && s.pid != 0 {
+		err = s.confine(s.pid)
+	}
+	if err == nil && s.acquire.NoSwap {
+		if err = disableSwap(); err == nil {
+			s.swapDisabled = true
+		}
+	}
+	if err != nil {
+		s.log.Info("refused acquire", "err", err)
+		s.releasePrepared()
+		theLock.Dequeue(s.locker)
+		s.locker = nil
+	}
+	return err
+}
+
+// releasePrepared undoes prepare.
+func (s *Server) releasePrepared() {
+	if s.hugePages != nil {
+		s.hugePages.release()
+		s.hugePages = nil
+	}
+	if s.cgroup != nil {
+		s.cgroup.release()
+		s.cgroup = nil
+	}
+	if s.swapDisabled {
+		enableSwap()
+		s.swapDisabled = false
+	}
+}
+
+// acquired records that s acquired the lock and prepares the system
+// for it. It returns any warnings for the client.
+func (s *Server) acquired() []string {
+	s.log.Debug("acquired", "id", s.locker.ID())
+	if s.locker.monitor {
+		// Monitors don't wait for the lock or change the system,
+		// so they aren't reported as acquisitions.
+		return nil
+	}
+	s.webhook("acquired")
+	theStats.acquired(s.locker)
+	if telemetryInterval > 0 {
+		cpus := s.locker.Cores()
+		if cpus.Count() == 0 {
+			cpus = theLock.All()
+		}
+		s.telemetry = startTelemetry(cpus, telemetryInterval)
+	}
+	var warnings []string
+	if cores := s.locker.Cores(); cores.Count() > 0 {
+		g, err := partitionCores(cores)
 		if err != nil {
-			return err
+			s.log.Error("partitioning cache", "err", err)
+			warnings = append(warnings, fmt.Sprintf("partitioning cache and memory bandwidth failed: %v", err))
 		}
-		old = append(old, &governorSettings{d, min, max})
+		s.resctrl = g
+	}
+	if s.locker.shared {
+		return warnings
 	}
-	s.oldGovernors = old
+	s.exclusive = true
+	return append(warnings, enterExclusive()...)
+}
 
-	// Set new settings.
+// cancel withdraws s's pending acquire.
+func (s *Server) cancel() {
+	s.acquiring = false
+	// The acquire may have been refused concurrently, in which
+	// case the locker is already dequeued.
+	select {
+	case ok := <-s.locker.C:
+		if !ok {
+			s.locker = nil
+			return
+		}
+	default:
+	}
+	theLock.Cancel(s.locker)
+	s.locker = nil
+}
+
+func (s *Server) drop() {
+	// Stop sampling before the settings are undone.
+	var tel *Telemetry
+	if s.telemetry != nil {
+		tel = s.telemetry.stop()
+		s.telemetry = nil
+	}
+	// Release the CPU governor settings before releasing the lock.
+	if s.governorSet {
+		releaseGovernor()
+		s.governorSet = false
+	}
+	if s.resctrl != nil {
+		s.resctrl.release()
+		s.resctrl = nil
+	}
+	s.releasePrepared()
+	if s.exclusive {
+		exitExclusive()
+		s.exclusive = false
+	}
+	if s.reservation != 0 {
+		theLock.Unreserve(s.reservation)
+		s.reservation = 0
+	}
+	// Release the lock.
+	if s.locker != nil {
+		if !s.acquiring {
+			s.log.Debug("released", "id", s.locker.ID())
+			if !s.locker.monitor {
+				s.webhook("released")
+				theStats.released(s.locker)
+				s.recordHistory(tel)
+			}
+		}
+		theLock.Dequeue(s.locker)
+		s.locker = nil
+	}
+}
+
+// governorTarget returns the frequency percent of the way between min
+// and max, rounded to the nearest frequency in avail, if any.
+func governorTarget(min, max int, avail []int, percent int) int {
 	abs := func(x int) int {
 		if x < 0 {
 			return -x
 		}
 		return x
 	}
-	for _, d := range domains {
-		min, max, avail := d.AvailableRange()
-		target := (max-min)*percent/100 + min
+	target := (max-min)*percent/100 + min
 
-		// Find the nearest available frequency.
-		if len(avail) != 0 {
-			closest := avail[0]
-			for _, a := range avail {
-				if abs(target-a) < abs(target-closest) {
-					closest = a
-				}
+	// Find the nearest available frequency.
+	if len(avail) != 0 {
+		closest := avail[0]
+		for _, a := range avail {
+			if abs(target-a) < abs(target-closest) {
+				closest = a
 			}
-			target = closest
-		}
-
-		err := d.SetRange(target, target)
-		if err != nil {
-			return err
 		}
+		target = closest
 	}
+	return target
+}
 
-	return nil
+// position returns the state of the acquisition with the given ID.
+func position(id int) ActionPositionResponse {
+	resp, ok := theLock.Status(id)
+	if !ok {
+		return ActionPositionResponse{Err: fmt.Sprintf("no acquisition with ID %d", id)}
+	}
+	return resp
 }
 
-func (s *Server) restoreGovernor() error {
-	var err error
-	for _, g := range s.oldGovernors {
-		// Try to set all of the domains, even if one fails.
-		err1 := g.domain.SetRange(g.min, g.max)
-		if err1 != nil && err == nil {
-			err = err1
-		}
+// queryPower returns the CPU frequency scaling capabilities of the
+// host.
+func queryPower() ActionQueryPowerResponse {
+	var resp ActionQueryPowerResponse
+	if theConfig.Unprivileged {
+		resp.Err = "CPU governor control is disabled for unprivileged daemons"
 	}
-	return err
+	domains, err := cpupower.Domains()
+	if err != nil {
+		resp.Err = err.Error()
+		return resp
+	}
+	if len(domains) == 0 {
+		resp.Err = "no power domains; is CPU frequency scaling supported?"
+		return resp
+	}
+	resp.Driver, _ = domains[0].Driver()
+	resp.Governors, _ = domains[0].Governors()
+	resp.Boost = cpupower.HaveBoost()
+	for _, d := range domains {
+		min, max, avail := d.AvailableRange()
+		resp.Domains = append(resp.Domains, PowerDomain{d.CPUs(), min, max, avail})
+	}
+	return resp
 }
@@ -0,0 +1,49 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+// listenDebug listens on addr for the debug HTTP server. addr must be
+// a loopback address, since the server is unauthenticated.
+func listenDebug(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("debug address: %w", err)
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("debug address %s is not a loopback address", addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serveDebug serves net/http/pprof profiles under /debug/pprof/ and
+// expvar variables at /debug/vars on l.
+func serveDebug(l net.Listener) error {
+	// Sample lock contention so the mutex profile is useful.
+	runtime.SetMutexProfileFraction(5)
+
+	expvar.Publish("perflock", expvar.Func(func() interface{} {
+		return theStats.stat()
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return http.Serve(l, mux)
+}
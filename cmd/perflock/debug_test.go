@@ -0,0 +1,21 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestListenDebug(t *testing.T) {
+	l, err := listenDebug("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	for _, addr := range []string{":0", "0.0.0.0:0", "192.0.2.1:0", "example.com:0", "localhost"} {
+		if l, err := listenDebug(addr); err == nil {
+			l.Close()
+			t.Errorf("listening on %s succeeded, want error", addr)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// dryRun prints what perflock would do to acquire a and run cmd with
+// the CPU governor set to governor percent, without doing any of it.
+func dryRun(c *Client, a ActionAcquire, governor int, cmd []string) {
+	plan, err := c.Plan(a)
+	if err != nil {
+		fatal(err)
+	}
+	if plan.Err != "" {
+		fatal("acquire would be refused: ", plan.Err)
+	}
+
+	mode := "exclusive"
+	if a.Shared {
+		mode = "shared"
+	}
+	fmt.Printf("lock:     %s\n", mode)
+	if plan.Acquired {
+		fmt.Printf("acquire:  immediately\n")
+	} else {
+		fmt.Printf("acquire:  after %d queued acquisitions\n", plan.Ahead)
+	}
+
+	wantCores := a.Cores > 0 || a.CoresPercent > 0 || a.CPUs.Count() > 0
+	switch {
+	case wantCores && plan.Acquired:
+		desc := cpuset.String(&plan.Cores)
+		if plan.Topology != "" {
+			desc += " (" + plan.Topology + ")"
+		}
+		fmt.Printf("cores:    %s\n", desc)
+	case a.CPUs.Count() > 0:
+		fmt.Printf("cores:    %s, once free\n", cpuset.String(&a.CPUs))
+	case a.CoresPercent > 0:
+		fmt.Printf("cores:    %d%%, chosen when acquired\n", a.CoresPercent)
+	case wantCores:
+		fmt.Printf("cores:    %d, chosen when acquired\n", a.Cores)
+	}
+	if plan.Acquired && plan.Affinity.Count() > 0 {
+		fmt.Printf("affinity: %s\n", cpuset.String(&plan.Affinity))
+	}
+	if a.MaxLoad > 0 {
+		fmt.Printf("load:     wait until below %g CPUs\n", a.MaxLoad)
+	}
+
+	if !a.Shared && governor >= 0 {
+		power, err := c.QueryPower()
+		if err != nil {
+			fatal(err)
+		}
+		if power.Err != "" {
+			fmt.Printf("governor: not set: %s\n", power.Err)
+		}
+		for _, d := range power.Domains {
+			if power.Err != "" {
+				break
+			}
+			target := governorTarget(d.Min, d.Max, d.Available, governor)
+			fmt.Printf("governor: CPUs %s: %d kHz (range %d-%d kHz)\n", d.CPUs, target, d.Min, d.Max)
+		}
+	}
+
+	fmt.Printf("command:  %s\n", shellEscapeList(cmd))
+}
@@ -0,0 +1,179 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// stateDump is the daemon's internal scheduling state, as reported by
+// perflock -dump. It's meant for debugging, so its format may change.
+type stateDump struct {
+	Time time.Time `json:"time"`
+
+	// All is the set of CPUs commands may run on, and Reservable
+	// is the subset -cores and -cpus may reserve.
+	All        cpuset.Set `json:"all"`
+	Reservable cpuset.Set `json:"reservable"`
+
+	// Free is the subset of Reservable not reserved by a holder.
+	Free cpuset.Set `json:"free"`
+
+	// Topology reports whether the CPU topology is known.
+	Topology bool `json:"topology"`
+
+	BackfillMaxWait string `json:"backfillMaxWait,omitempty"`
+	MaxQueue        int    `json:"maxQueue,omitempty"`
+	MaxQueuePerUser int    `json:"maxQueuePerUser,omitempty"`
+	MaxShared       int    `json:"maxShared,omitempty"`
+	LastID          int    `json:"lastID"`
+
+	// Paused reports whether an administrator paused the queue.
+	Paused bool `json:"paused,omitempty"`
+
+	Queue        []lockerDump      `json:"queue"`
+	Monitors     []lockerDump      `json:"monitors"`
+	Reservations []reservationDump `json:"reservations"`
+	Governor     governorDump      `json:"governor"`
+}
+
+type lockerDump struct {
+	ID          int        `json:"id"`
+	User        string     `json:"user,omitempty"`
+	Msg         string     `json:"msg"`
+	Shared      bool       `json:"shared"`
+	Woken       bool       `json:"woken"`
+	Reservation int        `json:"reservation,omitempty"`
+	NCores      int        `json:"nCores,omitempty"`
+	Topology    string     `json:"topology,omitempty"`
+	CPUs        cpuset.Set `json:"cpus"`
+	Cores       cpuset.Set `json:"cores"`
+	Affinity    cpuset.Set `json:"affinity"`
+	Enqueued    time.Time  `json:"enqueued"`
+	WokeAt      *time.Time `json:"wokeAt,omitempty"`
+}
+
+type reservationDump struct {
+	ID    int       `json:"id"`
+	User  string    `json:"user,omitempty"`
+	Cmd   string    `json:"cmd,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type governorDump struct {
+	// Percent is the applied setting, if Saved is non-empty.
+	Percent int `json:"percent"`
+	Users   int `json:"users"`
+
+	// Saved is the settings the daemon will restore.
+	Saved []governorSavedDump `json:"saved"`
+
+	// RestorePending indicates that Saved will be restored once
+	// the hold time passes.
+	RestorePending bool `json:"restorePending"`
+}
+
+type governorSavedDump struct {
+	CPUs string `json:"cpus"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+}
+
+// Dump returns the internal state of l.
+func (l *PerfLock) Dump() stateDump {
+	l.l.Lock()
+	defer l.l.Unlock()
+	d := stateDump{
+		Time:            time.Now(),
+		All:             l.all,
+		Reservable:      l.cores,
+		Topology:        l.topo != nil,
+		MaxQueue:        l.maxQueue,
+		MaxQueuePerUser: l.maxQueuePerUser,
+		MaxShared:       l.maxShared,
+		LastID:          l.lastID,
+		Paused:          l.paused,
+		Queue:           []lockerDump{},
+		Monitors:        []lockerDump{},
+		Reservations:    []reservationDump{},
+	}
+	if l.backfillMaxWait != 0 {
+		d.BackfillMaxWait = l.backfillMaxWait.String()
+	}
+	var reserved cpuset.Set
+	for _, locker := range l.q {
+		if locker.woken {
+			reserved = cpuset.Union(&reserved, &locker.cores)
+		}
+		d.Queue = append(d.Queue, dumpLocker(locker))
+	}
+	for _, locker := range l.monitors {
+		d.Monitors = append(d.Monitors, dumpLocker(locker))
+	}
+	d.Free = cpuset.Difference(&l.cores, &reserved)
+	for _, r := range l.reservations {
+		d.Reservations = append(d.Reservations, reservationDump{r.id, r.user, r.cmd, r.start, r.end})
+	}
+	return d
+}
+
+// dumpLocker returns the state of locker.
+func dumpLocker(locker *Locker) lockerDump {
+	ld := lockerDump{
+		ID:          locker.id,
+		User:        locker.user,
+		Msg:         locker.msg,
+		Shared:      locker.shared,
+		Woken:       locker.woken,
+		Reservation: locker.reservation,
+		NCores:      locker.nCores,
+		Topology:    locker.topology,
+		CPUs:        locker.cpus,
+		Cores:       locker.cores,
+		Affinity:    locker.affinity,
+		Enqueued:    locker.enqueued,
+	}
+	if locker.woken {
+		wokeAt := locker.wokeAt
+		ld.WokeAt = &wokeAt
+	}
+	return ld
+}
+
+// dumpGovernor returns the state of theGovernor.
+func dumpGovernor() governorDump {
+	g := &theGovernor
+	g.Lock()
+	defer g.Unlock()
+	d := governorDump{
+		Percent:        g.percent,
+		Users:          g.users,
+		Saved:          []governorSavedDump{},
+		RestorePending: g.restore != nil,
+	}
+	for _, gs := range g.saved {
+		d.Saved = append(d.Saved, governorSavedDump{gs.domain.CPUs(), gs.min, gs.max})
+	}
+	return d
+}
+
+// dump returns the daemon's internal state as JSON for s.
+func (s *Server) dump() ActionDumpResponse {
+	if !s.isAdmin() {
+		return ActionDumpResponse{Err: "only administrators may dump the daemon's state"}
+	}
+	d := theLock.Dump()
+	d.Governor = dumpGovernor()
+	data, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return ActionDumpResponse{Err: fmt.Sprintf("encoding state: %v", err)}
+	}
+	return ActionDumpResponse{JSON: data}
+}
@@ -0,0 +1,196 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpupower"
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// envSnapshot records the conditions a benchmark ran under. Fields
+// that couldn't be determined are left empty.
+type envSnapshot struct {
+	Time     time.Time `json:"time"`
+	Perflock string    `json:"perflock"`
+	Kernel   string    `json:"kernel"`
+	CPUModel string    `json:"cpuModel"`
+	NumCPU   int       `json:"numCPU"`
+
+	// SMT is the SMT control state, such as "on", "off", or
+	// "notsupported".
+	SMT string `json:"smt,omitempty"`
+
+	// Turbo is "on" or "off", or empty if it can't be controlled.
+	Turbo string `json:"turbo,omitempty"`
+
+	// Governor is the -governor percent requested, or -1 if the
+	// frequency wasn't adjusted.
+	Governor int `json:"governor"`
+
+	// Domains is the current state of each frequency scaling
+	// domain.
+	Domains []envDomain `json:"domains,omitempty"`
+
+	Shared bool `json:"shared"`
+
+	// Cores and CPUs are the cores reserved for the command and the
+	// CPUs it is restricted to, or empty if none.
+	Cores string `json:"cores,omitempty"`
+	CPUs  string `json:"cpus,omitempty"`
+
+	LoadAvg []float64 `json:"loadavg,omitempty"`
+
+	// PerfStat is the counters measured with -perf-stat while the
+	// command ran.
+	PerfStat []perfCounter `json:"perfStat,omitempty"`
+}
+
+// envDomain is the state of a frequency scaling domain.
+type envDomain struct {
+	CPUs     string `json:"cpus"`
+	Governor string `json:"governor"`
+
+	// Min and Max are the current frequency range, in kHz.
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// readEnv takes a snapshot of the current environment for a command
+// run with the given lock response and governor percent.
+func readEnv(resp ActionAcquireResponse, shared bool, governor int) envSnapshot {
+	env := envSnapshot{
+		Time:     time.Now(),
+		Perflock: perflockVersion(),
+		CPUModel: cpuModel(),
+		NumCPU:   runtime.NumCPU(),
+		Governor: governor,
+		Shared:   shared,
+		Cores:    cpuset.String(&resp.Cores),
+		CPUs:     cpuset.String(&resp.Affinity),
+		LoadAvg:  loadAvg(),
+	}
+	env.Kernel = kernelVersion()
+	if data, err := os.ReadFile("/sys/devices/system/cpu/smt/control"); err == nil {
+		env.SMT = strings.TrimSpace(string(data))
+	}
+	if boost, err := cpupower.Boost(); err == nil {
+		env.Turbo = "off"
+		if boost {
+			env.Turbo = "on"
+		}
+	}
+	domains, _ := cpupower.Domains()
+	for _, d := range domains {
+		ed := envDomain{CPUs: d.CPUs()}
+		ed.Governor, _ = d.Governor()
+		ed.Min, ed.Max, _ = d.CurrentRange()
+		env.Domains = append(env.Domains, ed)
+	}
+	return env
+}
+
+// writeEnv writes env as JSON to path, or to stdout if path is "-".
+func writeEnv(path string, env envSnapshot) error {
+	data, err := json.MarshalIndent(env, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
+
+// benchfmt returns env's perflock configuration as benchfmt
+// configuration lines, so benchmark results can be grouped by it.
+func (env *envSnapshot) benchfmt() string {
+	var buf strings.Builder
+	mode := "exclusive"
+	if env.Shared {
+		mode = "shared"
+	}
+	fmt.Fprintf(&buf, "perflock: %s\n", mode)
+	if env.Governor >= 0 {
+		fmt.Fprintf(&buf, "cpu-governor: %d%%\n", env.Governor)
+	} else {
+		fmt.Fprintf(&buf, "cpu-governor: none\n")
+	}
+	if env.Turbo != "" {
+		fmt.Fprintf(&buf, "turbo: %s\n", env.Turbo)
+	}
+	if env.CPUs != "" {
+		cpus, _ := cpuset.Parse(env.CPUs)
+		fmt.Fprintf(&buf, "cores: %d\n", cpus.Count())
+	}
+	return buf.String()
+}
+
+// perflockVersion returns the version of this perflock binary, or its
+// VCS revision if it wasn't built from a tagged module version.
+func perflockVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return info.Main.Version
+}
+
+// cpuModel returns the CPU model name from /proc/cpuinfo.
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
+
+// loadAvg returns the 1, 5, and 15 minute load averages.
+func loadAvg() []float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil
+	}
+	var avg []float64
+	for _, f := range fields[:3] {
+		x, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil
+		}
+		avg = append(avg, x)
+	}
+	return avg
+}
@@ -0,0 +1,23 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestBenchfmt(t *testing.T) {
+	for _, test := range []struct {
+		env  envSnapshot
+		want string
+	}{
+		{envSnapshot{Governor: 90, Turbo: "off", CPUs: "2-5"},
+			"perflock: exclusive\ncpu-governor: 90%\nturbo: off\ncores: 4\n"},
+		{envSnapshot{Shared: true, Governor: -1},
+			"perflock: shared\ncpu-governor: none\n"},
+	} {
+		if got := test.env.benchfmt(); got != test.want {
+			t.Errorf("benchfmt(%+v):\ngot  %q\nwant %q", test.env, got, test.want)
+		}
+	}
+}
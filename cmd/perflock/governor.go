@@ -0,0 +1,199 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpupower"
+)
+
+type governorSettings struct {
+	domain   *cpupower.Domain
+	min, max int
+}
+
+// theGovernor tracks the CPU frequency settings the daemon has
+// applied. Frequency transitions add settling noise to the start of a
+// benchmark, so if the daemon is configured with a hold time and
+// back-to-back lock holders request the same settings, they are kept
+// in place between them rather than restored and reapplied.
+var theGovernor struct {
+	sync.Mutex
+
+	// hold is how long to keep the settings once they're unused,
+	// or 0 to restore them immediately.
+	hold time.Duration
+
+	// saved is the settings from before the daemon changed them,
+	// or nil if they are unchanged.
+	saved []*governorSettings
+
+	// percent is the applied setting, if saved is non-nil.
+	percent int
+
+	// users is the number of lock holders using the applied
+	// settings.
+	users int
+
+	// restore, if non-nil, restores the saved settings when it
+	// fires.
+	restore *time.Timer
+}
+
+// setGovernor sets the frequency of all CPUs to percent between their
+// lowest and highest available frequencies for s, until s calls
+// releaseGovernor.
+func (s *Server) setGovernor(percent int) error {
+	if theConfig.Unprivileged {
+		return fmt.Errorf("CPU governor control is disabled for unprivileged daemons")
+	}
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("governor percent %d out of range", percent)
+	}
+	g := &theGovernor
+	g.Lock()
+	defer g.Unlock()
+	if s.governorSet {
+		g.users--
+		s.governorSet = false
+	}
+	if g.restore != nil {
+		g.restore.Stop()
+		g.restore = nil
+	}
+	if g.saved != nil && g.percent == percent {
+		// Already applied. Keep it.
+		g.users++
+		s.governorSet = true
+		return nil
+	}
+
+	domains, err := cpupower.Domains()
+	if err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("no power domains")
+	}
+
+	// Save current frequency settings, unless they're already
+	// ours.
+	if g.saved == nil {
+		var saved []*governorSettings
+		for _, d := range domains {
+			min, max, err := d.CurrentRange()
+			if err != nil {
+				return err
+			}
+			saved = append(saved, &governorSettings{d, min, max})
+		}
+		g.saved = saved
+	}
+	g.users++
+	s.governorSet = true
+
+	// Set new settings.
+	g.percent = -1
+	for _, d := range domains {
+		min, max, avail := d.AvailableRange()
+		target := governorTarget(min, max, avail, percent)
+		err := d.SetRange(target, target)
+		if err != nil {
+			return err
+		}
+	}
+	g.percent = percent
+
+	return nil
+}
+
+// releaseGovernor releases settings applied by setGovernor. Once no
+// lock holder is using them, they are restored after the hold time.
+func releaseGovernor() {
+	g := &theGovernor
+	g.Lock()
+	defer g.Unlock()
+	g.users--
+	if g.users > 0 || g.saved == nil {
+		return
+	}
+	if g.hold <= 0 {
+		restoreGovernor()
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(g.hold, func() {
+		g.Lock()
+		defer g.Unlock()
+		if g.restore != t {
+			// Stopped too late.
+			return
+		}
+		g.restore = nil
+		restoreGovernor()
+	})
+	g.restore = t
+}
+
+// restoreGovernor restores the saved frequency settings. theGovernor
+// must be locked.
+func restoreGovernor() {
+	g := &theGovernor
+	err := restoreSettings(g.saved)
+	g.saved = nil
+	if err != nil {
+		slog.Error("restoring CPU governor", "err", err)
+		theStats.governorError()
+	}
+}
+
+// restoreSettings applies saved frequency settings.
+func restoreSettings(saved []*governorSettings) error {
+	var err error
+	for _, gs := range saved {
+		// Try to set all of the domains, even if one fails.
+		err1 := gs.domain.SetRange(gs.min, gs.max)
+		if err1 != nil && err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// applyGovernor sets the frequency of all CPUs to percent between
+// their lowest and highest available frequencies in this process, for
+// -standalone. It returns a function that restores the previous
+// settings.
+func applyGovernor(percent int) (restore func() error, err error) {
+	domains, err := cpupower.Domains()
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no power domains")
+	}
+	var saved []*governorSettings
+	for _, d := range domains {
+		min, max, err := d.CurrentRange()
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, &governorSettings{d, min, max})
+	}
+	restore = func() error { return restoreSettings(saved) }
+	for _, d := range domains {
+		min, max, avail := d.AvailableRange()
+		target := governorTarget(min, max, avail, percent)
+		if err := d.SetRange(target, target); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	return restore, nil
+}
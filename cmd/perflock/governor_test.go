@@ -0,0 +1,51 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGovernorHold(t *testing.T) {
+	g := &theGovernor
+	saved := func() bool {
+		g.Lock()
+		defer g.Unlock()
+		return g.saved != nil
+	}
+
+	// Pretend 90% is already applied, so setGovernor doesn't need
+	// to touch the real CPU frequency settings.
+	g.Lock()
+	g.hold = 50 * time.Millisecond
+	g.saved, g.percent = []*governorSettings{}, 90
+	g.Unlock()
+
+	// A back-to-back run with the same setting keeps it.
+	var a, b Server
+	if err := a.setGovernor(90); err != nil {
+		t.Fatal(err)
+	}
+	releaseGovernor()
+	a.governorSet = false
+	if err := b.setGovernor(90); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * g.hold)
+	if !saved() {
+		t.Fatalf("settings restored while in use")
+	}
+
+	// Once unused for the hold time, the settings are restored.
+	releaseGovernor()
+	if !saved() {
+		t.Fatalf("settings restored before the hold time")
+	}
+	time.Sleep(2 * g.hold)
+	if saved() {
+		t.Fatalf("settings not restored after the hold time")
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/perflockpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// listenGRPC listens for gRPC connections on addr, which is either a
+// loopback TCP host:port or "unix:" followed by a socket path. Clients
+// connecting over a UNIX domain socket are identified by their peer
+// credentials. TCP clients are unauthenticated, so they may only query
+// the lock, not acquire it.
+func listenGRPC(addr string) (net.Listener, credentials.TransportCredentials, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		l, err := listenSocket(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return l, peerCredentials{}, nil
+	}
+	if theConfig.Unprivileged {
+		return nil, nil, fmt.Errorf("unprivileged daemons can only serve gRPC on a UNIX domain socket")
+	} else if !isLoopback(addr) {
+		return nil, nil, fmt.Errorf("gRPC over TCP is unauthenticated, so it can only listen on a loopback address, not %s", addr)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, insecure.NewCredentials(), nil
+}
+
+// isLoopback reports whether the host of addr is a loopback address.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newGRPCServer returns a server for the gRPC API.
+func newGRPCServer(creds credentials.TransportCredentials) *grpc.Server {
+	srv := grpc.NewServer(grpc.Creds(creds))
+	perflockpb.RegisterPerfLockServer(srv, &grpcServer{})
+	return srv
+}
+
+type grpcServer struct {
+	perflockpb.UnimplementedPerfLockServer
+}
+
+func (g *grpcServer) Lock(stream perflockpb.PerfLock_LockServer) error {
+	ctx := stream.Context()
+	s := NewServer(nil)
+	var authenticated bool
+	s.id, s.pid, authenticated = grpcIdentity(ctx)
+	s.log = s.log.With("user", s.id.userName, "grpc", true)
+	if !authenticated {
+		return status.Error(codes.PermissionDenied, "clients connected over TCP are unauthenticated and may not acquire the lock; connect over a unix: address")
+	}
+	// Drop any held locks if we exit for any reason.
+	defer s.drop()
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	acquire := req.GetAcquire()
+	if acquire == nil {
+		return status.Error(codes.FailedPrecondition, "first request must be Acquire")
+	}
+	action := ActionAcquire{
+		Shared:       acquire.Shared,
+		NonBlocking:  acquire.NonBlocking,
+		Msg:          acquire.Msg,
+		Cores:        int(acquire.Cores),
+		CoresPercent: int(acquire.CoresPercent),
+		Topology:     acquire.Topology,
+		HugePages:    int(acquire.HugePages),
+		LockMemory:   acquire.LockMemory,
+		NoSwap:       acquire.NoSwap,
+		MemoryMax:    acquire.MemoryMax,
+		CPUMax:       int(acquire.CpuMax),
+		Monitor:      acquire.Monitor,
+		MaxLoad:      acquire.MaxLoad,
+	}
+	var cpus []int
+	for _, cpu := range acquire.Cpus {
+		cpus = append(cpus, int(cpu))
+	}
+	action.CPUs, err = cpuset.FromSlice(cpus)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.enqueue(action); err != nil {
+		return status.Error(grpcCode(err), err.Error())
+	}
+	if s.locker == nil {
+		// Non-blocking acquire failed.
+		return stream.Send(&perflockpb.LockResponse{Response: &perflockpb.LockResponse_NotAcquired{NotAcquired: &perflockpb.NotAcquired{}}})
+	}
+
+	// Wait for acquire, reporting our position as the queue moves
+	// and periodically updating the ETA.
+	pos := -1
+	var lastSent time.Time
+	for acquired := false; !acquired; {
+		changed := theLock.Changed()
+		if p := theLock.Position(s.locker); p != pos || time.Since(lastSent) >= progressInterval {
+			pos, lastSent = p, time.Now()
+			eta, _ := theLock.ETA(s.locker)
+			queued := &perflockpb.Queued{Position: int32(pos), EtaSeconds: int64(eta / time.Second), Id: int64(s.locker.ID())}
+			err := stream.Send(&perflockpb.LockResponse{Response: &perflockpb.LockResponse_Queued{Queued: queued}})
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case ok := <-s.locker.C:
+			if !ok {
+				err := s.locker.Err()
+				s.locker = nil
+				return status.Error(codes.FailedPrecondition, err.Error())
+			}
+			acquired = true
+		case <-changed:
+		case <-time.After(progressInterval - time.Since(lastSent)):
+		case <-s.locker.Evicted():
+			s.log.Info("evicted", "id", s.locker.ID())
+			s.cancel()
+			return status.Error(codes.Aborted, errEvicted)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-shutdownC:
+			return status.Error(codes.Unavailable, errShuttingDown)
+		}
+	}
+	// Hold the lock, but wait for the load to drop before
+	// granting it. Until then, s is still acquiring, so dropping
+	// it doesn't count as a release.
+	stop := make(chan struct{})
+	defer close(stop)
+	var gateWarning string
+	if c, _ := s.startGate(stop); c != nil {
+		select {
+		case gateWarning = <-c:
+		case <-s.locker.Evicted():
+			s.log.Info("evicted", "id", s.locker.ID())
+			s.cancel()
+			return status.Error(codes.Aborted, errEvicted)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-shutdownC:
+			return status.Error(codes.Unavailable, errShuttingDown)
+		}
+	}
+	s.acquiring = false
+	resp := s.grant(gateWarning)
+	if resp.Err != "" {
+		return status.Error(codes.ResourceExhausted, resp.Err)
+	}
+	acquired := &perflockpb.Acquired{
+		Cores:    cpuList(resp.Cores),
+		Topology: resp.Topology,
+		Affinity: cpuList(resp.Affinity),
+		Warnings: resp.Warnings,
+	}
+	if err := stream.Send(&perflockpb.LockResponse{Response: &perflockpb.LockResponse_Acquired{Acquired: acquired}}); err != nil {
+		return err
+	}
+
+	// Process requests until the client closes the stream or the
+	// acquisition is evicted.
+	reqs := make(chan *perflockpb.LockRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		var req *perflockpb.LockRequest
+		select {
+		case req = <-reqs:
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-s.locker.Evicted():
+			s.log.Info("evicted", "id", s.locker.ID())
+			return status.Error(codes.Aborted, errEvicted)
+		}
+		switch action := req.Action.(type) {
+		case *perflockpb.LockRequest_SetGovernor:
+			errString := ""
+			if s.locker.monitor {
+				errString = "monitors cannot set the CPU governor"
+			} else if err := s.setGovernor(int(action.SetGovernor.Percent)); err != nil {
+				errString = err.Error()
+				theStats.governorError()
+			}
+			err := stream.Send(&perflockpb.LockResponse{Response: &perflockpb.LockResponse_GovernorSet{GovernorSet: &perflockpb.GovernorSet{Error: errString}}})
+			if err != nil {
+				return err
+			}
+		case *perflockpb.LockRequest_Acquire:
+			return status.Error(codes.FailedPrecondition, "acquiring lock twice")
+		default:
+			return status.Error(codes.InvalidArgument, "unknown request")
+		}
+	}
+}
+
+func (g *grpcServer) List(ctx context.Context, req *perflockpb.ListRequest) (*perflockpb.ListResponse, error) {
+	return listResponse(queue()), nil
+}
+
+func listResponse(list []ListEntry) *perflockpb.ListResponse {
+	resp := &perflockpb.ListResponse{}
+	for _, e := range list {
+		resp.Entries = append(resp.Entries, e.String())
+		item := &perflockpb.ListEntry{
+			Id:           int64(e.ID),
+			User:         e.User,
+			Command:      e.Command,
+			EnqueuedUnix: e.Enqueued.Unix(),
+			Shared:       e.Shared,
+			Held:         e.Held,
+			Job:          e.Job,
+			Cores:        int32(e.Cores),
+			Topology:     e.Topology,
+			Cpus:         cpuList(e.CPUs),
+			Reservation:  e.Reservation,
+			Monitor:      e.Monitor,
+			Assigned:     cpuList(e.Assigned),
+		}
+		if e.Reservation {
+			item.StartUnix, item.EndUnix = e.Start.Unix(), e.End.Unix()
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp
+}
+
+func (g *grpcServer) Subscribe(req *perflockpb.ListRequest, stream perflockpb.PerfLock_SubscribeServer) error {
+	ctx := stream.Context()
+	for {
+		changed := theLock.Changed()
+		if err := stream.Send(listResponse(queue())); err != nil {
+			return err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (g *grpcServer) QueryPower(ctx context.Context, req *perflockpb.QueryPowerRequest) (*perflockpb.QueryPowerResponse, error) {
+	power := queryPower()
+	resp := &perflockpb.QueryPowerResponse{
+		Error:     power.Err,
+		Driver:    power.Driver,
+		Boost:     power.Boost,
+		Governors: power.Governors,
+	}
+	for _, d := range power.Domains {
+		pd := &perflockpb.PowerDomain{Cpus: d.CPUs, Min: int32(d.Min), Max: int32(d.Max)}
+		for _, f := range d.Available {
+			pd.Available = append(pd.Available, int32(f))
+		}
+		resp.Domains = append(resp.Domains, pd)
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) Position(ctx context.Context, req *perflockpb.PositionRequest) (*perflockpb.PositionResponse, error) {
+	pos, ok := theLock.Status(int(req.Id))
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no acquisition with ID %d", req.Id)
+	}
+	return &perflockpb.PositionResponse{
+		Acquired:   pos.Acquired,
+		Position:   int32(pos.Position),
+		EtaSeconds: int64(pos.ETA / time.Second),
+		Msg:        pos.Msg,
+		Shared:     pos.Shared,
+		Cores:      int32(pos.Cores),
+		Topology:   pos.Topology,
+		Cpus:       cpuList(pos.CPUs),
+		Free:       cpuList(pos.Free),
+	}, nil
+}
+
+func (g *grpcServer) Stat(ctx context.Context, req *perflockpb.StatRequest) (*perflockpb.StatResponse, error) {
+	st := theStats.stat()
+	return &perflockpb.StatResponse{
+		UptimeSeconds:  st.Uptime.Seconds(),
+		Acquisitions:   int64(st.Acquisitions),
+		Held:           int32(st.Held),
+		Waiting:        int32(st.Waiting),
+		Wait:           durationStats(st.Wait),
+		Hold:           durationStats(st.Hold),
+		GovernorErrors: int64(st.GovernorErrors),
+	}, nil
+}
+
+// durationStats converts d for a gRPC response.
+func durationStats(d DurationStats) *perflockpb.DurationStats {
+	return &perflockpb.DurationStats{
+		N:           int32(d.N),
+		MeanSeconds: d.Mean.Seconds(),
+		P50Seconds:  d.P50.Seconds(),
+		P90Seconds:  d.P90.Seconds(),
+		P99Seconds:  d.P99.Seconds(),
+	}
+}
+
+// cpuList returns the CPUs in set as a list for a gRPC response.
+func cpuList(set cpuset.Set) []int32 {
+	var cpus []int32
+	for _, cpu := range cpuset.ToSlice(&set) {
+		cpus = append(cpus, int32(cpu))
+	}
+	return cpus
+}
+
+// grpcIdentity returns the identity and process ID of the gRPC client
+// making the call in ctx, and whether it is authenticated. Clients that
+// didn't connect over a UNIX domain socket are unauthenticated, have no
+// user or group ID or process ID, and are named by their address.
+func grpcIdentity(ctx context.Context) (id identity, pid int, authenticated bool) {
+	id = identity{^uint32(0), ^uint32(0), "???"}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return id, 0, false
+	}
+	if info, ok := p.AuthInfo.(peerCredInfo); ok {
+		return identity{info.ucred.Uid, info.ucred.Gid, lookupUserName(info.ucred.Uid)}, int(info.ucred.Pid), true
+	}
+	id.userName = p.Addr.String()
+	return id, 0, false
+}
+
+// grpcCode returns the gRPC status code for an error refusing an
+// acquire.
+func grpcCode(err error) codes.Code {
+	var perr policyError
+	switch {
+	case errors.As(err, &perr):
+		return codes.PermissionDenied
+	case errors.Is(err, errQueueFull):
+		return codes.ResourceExhausted
+	}
+	return codes.InvalidArgument
+}
+
+// peerCredentials is a gRPC transport credential for UNIX domain
+// sockets that identifies clients by their SO_PEERCRED credentials.
+type peerCredentials struct{}
+
+type peerCredInfo struct {
+	credentials.CommonAuthInfo
+	ucred *ucred
+}
+
+func (peerCredInfo) AuthType() string {
+	return "peercred"
+}
+
+func (peerCredentials) ClientHandshake(ctx context.Context, authority string, c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c, peerCredInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}, nil
+}
+
+func (peerCredentials) ServerHandshake(c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, nil, fmt.Errorf("peer credentials require a UNIX domain socket")
+	}
+	ucred, err := readPeerCredentials(uc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if theConfig.Unprivileged && int(ucred.Uid) != os.Getuid() {
+		return nil, nil, fmt.Errorf("rejecting connection from uid %d", ucred.Uid)
+	}
+	return c, peerCredInfo{credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}, ucred}, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/aclements/perflock/internal/cgroup"
+	"github.com/aclements/perflock/internal/cpupower"
+	"github.com/aclements/perflock/internal/resctrl"
+)
+
+// The privileged helper performs the daemon's writes to system files
+// and runs its hooks on its behalf, so the rest of the daemon can run
+// as an unprivileged user. It is a child process of the daemon
+// started with helperArg. It reads a helperConfig from stdin, followed
+// by helperRequests.
+
+const helperArg = "-privileged-helper"
+
+// helperConfig configures the helper. The daemon sends it before
+// dropping privileges, so the unprivileged daemon can't change it.
+type helperConfig struct {
+	Hooks hooks
+
+	// Units lists the systemd units the helper may stop and start.
+	Units []string
+}
+
+type helperRequest struct {
+	Path string
+	Data []byte
+
+	// Hook, if non-empty, is the name of a hook to run instead of
+	// writing a file.
+	Hook string
+
+	// StopUnits or StartUnits, if non-empty, are systemd units to
+	// stop or start instead of writing a file.
+	StopUnits, StartUnits []string
+
+	// Mkdir or Remove, if set, create or remove the directory Path
+	// instead of writing it.
+	Mkdir, Remove bool
+}
+
+type helperResponse struct {
+	// Err is empty if the request succeeded.
+	Err string
+
+	// Units lists the units stopped by a StopUnits request.
+	Units []string
+}
+
+// helperPaths matches the files the helper is willing to write.
+var helperPaths = regexp.MustCompile(`^/sys/devices/system/cpu/cpu[0-9]+/cpufreq/scaling_(min|max)_freq$` +
+	`|^/sys/fs/resctrl(/` + resctrlPrefix + `[0-9]+)?/(schemata|cpus_list)$` +
+	`|^/proc/sys/vm/(nr_hugepages|swappiness)$|^/sys/devices/system/node/node[0-9]+/hugepages/hugepages-[0-9]+kB/nr_hugepages$` +
+	`|^/sys/fs/cgroup(/[^/]+)*/cgroup\.subtree_control$` +
+	`|^/sys/fs/cgroup(/[^/]+)*/` + cgroupPrefix + `[0-9]+/(cgroup\.procs|memory\.min|memory\.max|cpu\.max)$`)
+
+// helperDirs matches the directories the helper is willing to create
+// and remove.
+var helperDirs = regexp.MustCompile(`^/sys/fs/resctrl/` + resctrlPrefix + `[0-9]+$` +
+	`|^/sys/fs/cgroup(/[^/]+)*/` + cgroupPrefix + `[0-9]+$`)
+
+// doHelper runs the privileged helper.
+func doHelper() {
+	gr, gw := gob.NewDecoder(os.Stdin), gob.NewEncoder(os.Stdout)
+	var cfg helperConfig
+	if err := gr.Decode(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	for {
+		var req helperRequest
+		if err := gr.Decode(&req); err != nil {
+			if err != io.EOF {
+				log.Fatal(err)
+			}
+			return
+		}
+		var resp helperResponse
+		if req.Hook != "" {
+			if err := cfg.Hooks.run(req.Hook); err != nil {
+				resp.Err = err.Error()
+			}
+		} else if units := slices.Concat(req.StopUnits, req.StartUnits); len(units) > 0 {
+			if unit, ok := allowedUnits(cfg.Units, units); !ok {
+				resp.Err = fmt.Sprintf("helper: refusing to control unit %s", unit)
+			} else if len(req.StopUnits) > 0 {
+				stopped, err := stopUnits(req.StopUnits)
+				resp.Units = stopped
+				if err != nil {
+					resp.Err = err.Error()
+				}
+			} else if err := startUnits(req.StartUnits); err != nil {
+				resp.Err = err.Error()
+			}
+		} else if req.Mkdir || req.Remove {
+			if req.Path != filepath.Clean(req.Path) || !helperDirs.MatchString(req.Path) {
+				resp.Err = fmt.Sprintf("helper: refusing to modify %s", req.Path)
+			} else if err := helperDir(req); err != nil {
+				resp.Err = err.Error()
+			}
+		} else if req.Path != filepath.Clean(req.Path) || !helperPaths.MatchString(req.Path) {
+			resp.Err = fmt.Sprintf("helper: refusing to write %s", req.Path)
+		} else if err := ioutil.WriteFile(req.Path, req.Data, 0); err != nil {
+			resp.Err = err.Error()
+		}
+		if err := gw.Encode(resp); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// helperDir creates or removes directory req.Path.
+func helperDir(req helperRequest) error {
+	if req.Mkdir {
+		return os.Mkdir(req.Path, 0755)
+	}
+	return os.Remove(req.Path)
+}
+
+// allowedUnits reports whether every unit in units is in allowed. If
+// not, it returns the first unit that isn't.
+func allowedUnits(allowed, units []string) (string, bool) {
+	for _, unit := range units {
+		if !slices.Contains(allowed, unit) {
+			return unit, false
+		}
+	}
+	return "", true
+}
+
+// helper is a connection to a running privileged helper.
+type helper struct {
+	mu sync.Mutex
+	gr *gob.Decoder
+	gw *gob.Encoder
+}
+
+// startHelper starts the privileged helper and routes all cpupower,
+// resctrl, and cgroup changes and hooks through it.
+func startHelper(cfg helperConfig) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, helperArg)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		// The daemon can't do its job without the helper.
+		log.Fatal("privileged helper exited: ", cmd.Wait())
+	}()
+
+	h := &helper{gr: gob.NewDecoder(stdout), gw: gob.NewEncoder(stdin)}
+	if err := h.gw.Encode(cfg); err != nil {
+		return err
+	}
+	cpupower.WriteFile = h.writeFile
+	resctrl.WriteFile = h.writeFile
+	resctrl.Mkdir = h.mkdir
+	resctrl.Remove = h.remove
+	cgroup.WriteFile = h.writeFile
+	cgroup.Mkdir = h.mkdir
+	cgroup.Remove = h.remove
+	runHook = h.runHook
+	stopUnits = h.stopUnits
+	startUnits = h.startUnits
+	return nil
+}
+
+func (h *helper) writeFile(path string, data []byte) error {
+	_, err := h.do(helperRequest{Path: path, Data: data})
+	return err
+}
+
+func (h *helper) mkdir(path string) error {
+	_, err := h.do(helperRequest{Path: path, Mkdir: true})
+	return err
+}
+
+func (h *helper) remove(path string) error {
+	_, err := h.do(helperRequest{Path: path, Remove: true})
+	return err
+}
+
+func (h *helper) runHook(name string) error {
+	_, err := h.do(helperRequest{Hook: name})
+	return err
+}
+
+func (h *helper) stopUnits(units []string) ([]string, error) {
+	if len(units) == 0 {
+		return nil, nil
+	}
+	resp, err := h.do(helperRequest{StopUnits: units})
+	return resp.Units, err
+}
+
+func (h *helper) startUnits(units []string) error {
+	if len(units) == 0 {
+		return nil
+	}
+	_, err := h.do(helperRequest{StartUnits: units})
+	return err
+}
+
+func (h *helper) do(req helperRequest) (helperResponse, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var resp helperResponse
+	if err := h.gw.Encode(req); err != nil {
+		return resp, err
+	}
+	if err := h.gr.Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Err != "" {
+		return resp, fmt.Errorf("%s", resp.Err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxHistory is the number of finished acquisitions the daemon
+// remembers for ActionHistory.
+const maxHistory = 1000
+
+var theHistory struct {
+	sync.Mutex
+	entries []HistoryEntry
+}
+
+// recordHistory records that s, which held the lock, is releasing it.
+func (s *Server) recordHistory(tel *Telemetry) {
+	l := s.locker
+	e := HistoryEntry{
+		ID:        l.ID(),
+		User:      l.user,
+		Command:   l.msg,
+		Shared:    l.shared,
+		Job:       findJob(l.ID()) != nil,
+		Cores:     l.Cores(),
+		Acquired:  l.wokeAt,
+		Released:  time.Now(),
+		Telemetry: tel,
+	}
+	theHistory.Lock()
+	defer theHistory.Unlock()
+	if len(theHistory.entries) >= maxHistory {
+		theHistory.entries = append(theHistory.entries[:0], theHistory.entries[1:]...)
+	}
+	theHistory.entries = append(theHistory.entries, e)
+}
+
+// history returns the recorded acquisitions, oldest first.
+func history() []HistoryEntry {
+	theHistory.Lock()
+	defer theHistory.Unlock()
+	return append([]HistoryEntry(nil), theHistory.entries...)
+}
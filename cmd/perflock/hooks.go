@@ -0,0 +1,114 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hooks are shell commands the daemon runs to prepare the system for
+// exclusive lock holders and to restore it afterwards, such as
+// stopping cron or changing sysctls.
+type hooks struct {
+	// Acquire is run when an exclusive lock is granted.
+	Acquire string `json:"acquire"`
+
+	// Release is run when the exclusive lock is released.
+	Release string `json:"release"`
+}
+
+// hookTimeout bounds how long a hook may run.
+const hookTimeout = time.Minute
+
+// run runs the hook called name ("acquire" or "release"), if any.
+func (h hooks) run(name string) error {
+	var script string
+	switch name {
+	case "acquire":
+		script = h.Acquire
+	case "release":
+		script = h.Release
+	default:
+		return fmt.Errorf("unknown hook %q", name)
+	}
+	if script == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "/bin/sh", "-c", script).CombinedOutput()
+	if err != nil {
+		if len(out) > 0 {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return err
+	}
+	return nil
+}
+
+// runHook runs the configured hook called name. It may be replaced to
+// run hooks from a more privileged process.
+var runHook = func(name string) error {
+	return theConfig.Hooks.run(name)
+}
+
+// exclusive tracks the number of exclusive lock holders, so the
+// system is prepared when the first is granted and restored when the
+// last is released.
+var exclusive struct {
+	sync.Mutex
+	holders int
+
+	// stopped lists the systemd units stopped for the current
+	// exclusive lock holders.
+	stopped []string
+}
+
+// enterExclusive records that an exclusive lock was granted. If no
+// other exclusive lock is held, it prepares the system. It returns
+// any problems doing so, to be reported to the lock holder.
+func enterExclusive() (warnings []string) {
+	exclusive.Lock()
+	defer exclusive.Unlock()
+	exclusive.holders++
+	if exclusive.holders > 1 {
+		return nil
+	}
+	stopped, err := stopUnits(theConfig.QuiesceUnits)
+	exclusive.stopped = stopped
+	if err != nil {
+		slog.Error("stopping systemd units", "err", err)
+		warnings = append(warnings, fmt.Sprintf("stopping systemd units failed: %v", err))
+	}
+	if err := runHook("acquire"); err != nil {
+		slog.Error("acquire hook failed", "err", err)
+		warnings = append(warnings, fmt.Sprintf("acquire hook failed: %v", err))
+	}
+	return warnings
+}
+
+// exitExclusive records that an exclusive lock was released. If no
+// other exclusive lock is held, it restores the system.
+func exitExclusive() {
+	exclusive.Lock()
+	defer exclusive.Unlock()
+	exclusive.holders--
+	if exclusive.holders > 0 {
+		return
+	}
+	if err := runHook("release"); err != nil {
+		slog.Error("release hook failed", "err", err)
+	}
+	if err := startUnits(exclusive.stopped); err != nil {
+		slog.Error("restarting systemd units", "err", err)
+	}
+	exclusive.stopped = nil
+}
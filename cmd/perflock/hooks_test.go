@@ -0,0 +1,42 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestQuiesceUnits(t *testing.T) {
+	var log []string
+	defer func(stop func([]string) ([]string, error), start func([]string) error) {
+		stopUnits, startUnits = stop, start
+	}(stopUnits, startUnits)
+	stopUnits = func(units []string) ([]string, error) {
+		log = append(log, fmt.Sprint("stop ", units))
+		// Pretend only the first unit was active.
+		return units[:1], nil
+	}
+	startUnits = func(units []string) error {
+		log = append(log, fmt.Sprint("start ", units))
+		return nil
+	}
+	defer func(units []string) { theConfig.QuiesceUnits = units }(theConfig.QuiesceUnits)
+	theConfig.QuiesceUnits = []string{"cron.service", "docker.service"}
+
+	// Units are stopped for the first exclusive holder and
+	// restarted after the last.
+	enterExclusive()
+	enterExclusive()
+	exitExclusive()
+	if want := []string{"stop [cron.service docker.service]"}; !slices.Equal(log, want) {
+		t.Errorf("with one holder left, got %q, want %q", log, want)
+	}
+	exitExclusive()
+	if want := []string{"stop [cron.service docker.service]", "start [cron.service]"}; !slices.Equal(log, want) {
+		t.Errorf("after all holders released, got %q, want %q", log, want)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aclements/perflock/internal/cpupower"
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// hugePagesMu serializes changes to the huge page pools.
+var hugePagesMu sync.Mutex
+
+// maxHugePages is the most huge pages one acquisition may reserve,
+// from theConfig.MaxHugePages. ActionReload may change it.
+var maxHugePages atomic.Int64
+
+// hugePages is a number of huge pages added to a pool for a command.
+type hugePages struct {
+	path string
+	n    int
+}
+
+// reserveHugePages adds n default-size huge pages to the pool of the
+// NUMA node of cores, if they are all on one node, or otherwise to the
+// system-wide pool. It fails if the kernel can't allocate them all,
+// for example because memory is too fragmented.
+func reserveHugePages(n int, cores cpuset.Set) (*hugePages, error) {
+	if theConfig.Unprivileged {
+		return nil, fmt.Errorf("huge page reservation is disabled for unprivileged daemons")
+	}
+	// The limit may have been lowered since the acquire was queued.
+	if err := checkHugePages(n); err != nil {
+		return nil, err
+	}
+	path := "/proc/sys/vm/nr_hugepages"
+	if cores.Count() > 0 {
+		if nodes, err := cpuNodes(cores); err == nil && len(nodes) == 1 {
+			size, err := hugePageSize()
+			if err != nil {
+				return nil, err
+			}
+			path = fmt.Sprintf("/sys/devices/system/node/node%d/hugepages/hugepages-%dkB/nr_hugepages", nodes[0], size)
+		}
+	}
+
+	hugePagesMu.Lock()
+	defer hugePagesMu.Unlock()
+	before, err := readIntFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cpupower.WriteFile(path, []byte(strconv.Itoa(before+n))); err != nil {
+		return nil, fmt.Errorf("reserving huge pages: %w", err)
+	}
+	got, err := readIntFile(path)
+	if err == nil && got < before+n {
+		err = fmt.Errorf("could only reserve %d of %d huge pages", got-before, n)
+	}
+	if err != nil {
+		cpupower.WriteFile(path, []byte(strconv.Itoa(before)))
+		return nil, err
+	}
+	return &hugePages{path, n}, nil
+}
+
+// checkHugePages returns an error if an acquisition may not reserve n
+// huge pages.
+func checkHugePages(n int) error {
+	max := maxHugePages.Load()
+	switch {
+	case n == 0:
+		return nil
+	case max == 0:
+		return fmt.Errorf("huge page reservation is disabled; the daemon configuration must set maxHugePages")
+	case int64(n) > max:
+		return fmt.Errorf("cannot reserve %d huge pages; the daemon allows at most %d", n, max)
+	}
+	return nil
+}
+
+// release returns the huge pages to the kernel.
+func (h *hugePages) release() {
+	hugePagesMu.Lock()
+	defer hugePagesMu.Unlock()
+	cur, err := readIntFile(h.path)
+	if err == nil {
+		err = cpupower.WriteFile(h.path, []byte(strconv.Itoa(max(cur-h.n, 0))))
+	}
+	if err != nil {
+		slog.Error("releasing huge pages", "path", h.path, "err", err)
+	}
+}
+
+// hugePageSize returns the default huge page size in KiB.
+func hugePageSize() (int, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if rest, ok := strings.CutPrefix(s.Text(), "Hugepagesize:"); ok {
+			return strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(rest), " kB"))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("huge pages are not supported")
+}
+
+func readIntFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,433 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// Batch jobs are commands the daemon runs on behalf of a client once
+// they acquire the lock, so the client doesn't have to stay connected
+// while they wait.
+
+// maxJobs bounds the number of finished jobs the daemon remembers.
+const maxJobs = 1000
+
+// jobGrace is how long a cancelled job has to exit after SIGTERM
+// before it is killed.
+const jobGrace = 10 * time.Second
+
+// Job states.
+const (
+	JobWaiting   = "waiting"
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// job is a batch job.
+type job struct {
+	owner identity
+	args  []string
+	dir   string
+	env   []string
+
+	acquire  ActionAcquire
+	governor int
+	warmup   time.Duration
+
+	// after is the job this job waits for before it's queued, or
+	// nil. If afterOK is set, after must succeed.
+	after   *job
+	afterOK bool
+
+	// cancel is closed to cancel the job.
+	cancel     chan struct{}
+	cancelOnce sync.Once
+
+	// done is closed when the job finishes.
+	done chan struct{}
+
+	// mu protects info.
+	mu   sync.Mutex
+	info JobInfo
+}
+
+var theJobs struct {
+	sync.Mutex
+	jobs []*job
+}
+
+// jobDir returns the directory job logs are written to.
+func jobDir() (string, error) {
+	if theConfig.JobDir != "" {
+		return theConfig.JobDir, nil
+	}
+	if theConfig.Unprivileged {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "perflock", "jobs"), nil
+	}
+	return "/var/lib/perflock/jobs", nil
+}
+
+// submit submits batch job a for s.
+func (s *Server) submit(a ActionSubmit) ActionSubmitResponse {
+	fail := func(err error) ActionSubmitResponse {
+		return ActionSubmitResponse{Err: err.Error()}
+	}
+	if len(a.Args) == 0 {
+		return fail(fmt.Errorf("no command"))
+	}
+	a.Acquire.NonBlocking, a.Acquire.Progress, a.Acquire.Reservation = false, false, 0
+	if a.Acquire.Monitor {
+		return fail(fmt.Errorf("batch jobs cannot be monitors"))
+	}
+	if err := s.resolveCoresPercent(&a.Acquire); err != nil {
+		return fail(err)
+	}
+	if err := s.checkAcquire(a.Acquire); err != nil {
+		return fail(err)
+	}
+	if a.Warmup < 0 {
+		return fail(fmt.Errorf("invalid warm-up %v", a.Warmup))
+	}
+	if acq := a.Acquire; a.Warmup > 0 && acq.Shared && acq.Cores == 0 && acq.CPUs.Count() == 0 {
+		return fail(fmt.Errorf("warming up a shared job requires reserved cores"))
+	}
+	if uid := os.Getuid(); uid != 0 && int(s.id.uid) != uid {
+		return fail(fmt.Errorf("the daemon can't run jobs as user %s", s.id.userName))
+	}
+	dir, err := jobDir()
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fail(err)
+	}
+
+	j := &job{owner: s.id, args: a.Args, dir: a.Dir, env: a.Env, acquire: a.Acquire, governor: a.Governor, warmup: a.Warmup, cancel: make(chan struct{}), done: make(chan struct{})}
+	js := &Server{id: s.id, log: s.log}
+	var id int
+	state := JobQueued
+	if a.After != 0 {
+		// Queue the job once the job it's after finishes, but
+		// give it an ID now so it can be referred to.
+		j.after, j.afterOK = findJob(a.After), a.AfterOK
+		if j.after == nil {
+			return fail(fmt.Errorf("no job %d", a.After))
+		}
+		id, state = theLock.NewID(), JobWaiting
+	} else {
+		js.locker, err = theLock.EnqueueAs(a.Acquire, s.id.userName, js.lockMsg(a.Acquire)+" [job]", 0)
+		if err != nil {
+			return ActionSubmitResponse{Err: err.Error(), QueueFull: errors.Is(err, errQueueFull)}
+		}
+		js.acquiring = true
+		id = js.locker.ID()
+	}
+	js.log = js.log.With("job", id)
+	j.info = JobInfo{
+		ID:        id,
+		User:      s.id.userName,
+		Command:   a.Acquire.Msg,
+		State:     state,
+		Submitted: time.Now(),
+		Log:       filepath.Join(dir, fmt.Sprintf("%d.log", id)),
+		After:     a.After,
+	}
+	logFile, err := os.OpenFile(j.info.Log, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err == nil && os.Getuid() == 0 {
+		err = logFile.Chown(int(s.id.uid), int(s.id.gid))
+	}
+	if err != nil {
+		if js.locker != nil {
+			js.cancel()
+		}
+		return fail(err)
+	}
+
+	theJobs.Lock()
+	theJobs.jobs = append(theJobs.jobs, j)
+	forgetJobs()
+	theJobs.Unlock()
+
+	go j.run(js, logFile)
+	return ActionSubmitResponse{ID: id, Log: j.info.Log}
+}
+
+// forgetJobs drops the oldest finished jobs beyond maxJobs. theJobs
+// must be locked.
+func forgetJobs() {
+	extra := len(theJobs.jobs) - maxJobs
+	jobs := theJobs.jobs[:0]
+	for _, j := range theJobs.jobs {
+		if extra > 0 && j.finished() {
+			extra--
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	theJobs.jobs = jobs
+}
+
+// run waits for j to acquire the lock as s and runs it, writing its
+// output to logFile.
+func (j *job) run(s *Server, logFile *os.File) {
+	defer logFile.Close()
+	defer s.drop()
+
+	if j.after != nil {
+		select {
+		case <-j.after.done:
+		case <-j.cancel:
+			j.finish(JobCancelled, -1)
+			return
+		}
+		if after := j.after.Info(); j.afterOK && after.State != JobDone {
+			fmt.Fprintf(logFile, "perflock: job %d %s; not running\n", after.ID, after.State)
+			j.finish(JobCancelled, -1)
+			return
+		}
+		locker, err := theLock.EnqueueAs(j.acquire, s.id.userName, s.lockMsg(j.acquire)+" [job]", j.info.ID)
+		if err != nil {
+			fmt.Fprintf(logFile, "perflock: %v\n", err)
+			j.finish(JobFailed, -1)
+			return
+		}
+		s.locker, s.acquiring = locker, true
+		j.mu.Lock()
+		j.info.State = JobQueued
+		j.mu.Unlock()
+	}
+
+	select {
+	case ok := <-s.locker.C:
+		s.acquiring = false
+		if !ok {
+			fmt.Fprintf(logFile, "perflock: %v\n", s.locker.Err())
+			s.locker = nil
+			j.finish(JobFailed, -1)
+			return
+		}
+	case <-j.cancel:
+		s.cancel()
+		j.finish(JobCancelled, -1)
+		return
+	}
+	if g := newLoadGate(j.acquire); g != nil {
+		warning, ok := g.wait(s.log, s.locker.ID(), j.cancel)
+		if !ok {
+			s.cancel()
+			j.finish(JobCancelled, -1)
+			return
+		}
+		if warning != "" {
+			fmt.Fprintf(logFile, "perflock: warning: %s\n", warning)
+		}
+	}
+
+	s.acquire = j.acquire
+	if err := s.prepare(); err != nil {
+		fmt.Fprintf(logFile, "perflock: %v\n", err)
+		j.finish(JobFailed, -1)
+		return
+	}
+	for _, w := range s.acquired() {
+		fmt.Fprintf(logFile, "perflock: warning: %s\n", w)
+	}
+	if !j.acquire.Shared && j.governor >= 0 {
+		if err := s.setGovernor(j.governor); err != nil {
+			fmt.Fprintf(logFile, "perflock: warning: not setting CPU governor: %v\n", err)
+			theStats.governorError()
+		}
+	}
+
+	cmd := exec.Command(j.args[0], j.args[1:]...)
+	cmd.Dir, cmd.Env = j.dir, withMarker(j.env, lockMode(j.acquire.Shared, false), s.locker.Cores())
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	attr, err := jobProcAttr(j.owner)
+	if err != nil {
+		fmt.Fprintf(logFile, "perflock: %v\n", err)
+		j.finish(JobFailed, -1)
+		return
+	}
+	cmd.SysProcAttr = attr
+	affinity := s.locker.Affinity()
+	if affinity.Count() == 0 {
+		// The daemon itself is confined to the housekeeping
+		// cores, but the job shouldn't be.
+		affinity = theLock.All()
+	}
+	if j.warmup > 0 {
+		if err := warmup(&affinity, j.warmup); err != nil {
+			fmt.Fprintf(logFile, "perflock: warning: warming up: %v\n", err)
+		}
+	}
+	if err := startWithAffinity(cmd, &affinity); err != nil {
+		fmt.Fprintf(logFile, "perflock: %v\n", err)
+		j.finish(JobFailed, -1)
+		return
+	}
+	// The job runs briefly before it's confined, but not long
+	// enough to matter.
+	if err := s.confine(cmd.Process.Pid); err != nil {
+		fmt.Fprintf(logFile, "perflock: %v\n", err)
+		cmd.Process.Kill()
+		cmd.Wait()
+		j.finish(JobFailed, -1)
+		return
+	}
+	j.mu.Lock()
+	j.info.State, j.info.Started = JobRunning, time.Now()
+	j.mu.Unlock()
+
+	// Forward cancellation to the job as SIGTERM.
+	sigs, done := make(chan os.Signal, 1), make(chan struct{})
+	go func() {
+		select {
+		case <-j.cancel:
+			sigs <- syscall.SIGTERM
+		case <-done:
+		}
+	}()
+	forwarded := make(chan bool)
+	go func() {
+		forwarded <- forwardSignals(cmd.Process.Pid, sigs, jobGrace, nil, done)
+	}()
+	err = cmd.Wait()
+	close(done)
+	<-forwarded
+	if s.telemetry != nil {
+		tel := s.telemetry.stop()
+		if tel != nil {
+			fmt.Fprintf(logFile, "perflock: %v\n", tel)
+		}
+		j.mu.Lock()
+		j.info.Telemetry = tel
+		j.mu.Unlock()
+	}
+	if cmd.ProcessState != nil {
+		usage := processUsage(cmd.ProcessState)
+		writeUsage(logFile, "text", usage)
+		j.mu.Lock()
+		j.info.Usage = usage
+		j.mu.Unlock()
+	}
+
+	status := cmd.ProcessState.ExitCode()
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		status = 128 + int(ws.Signal())
+	}
+	select {
+	case <-j.cancel:
+		j.finish(JobCancelled, status)
+	default:
+		if err != nil {
+			fmt.Fprintf(logFile, "perflock: %v\n", err)
+			j.finish(JobFailed, status)
+		} else {
+			j.finish(JobDone, status)
+		}
+	}
+}
+
+// finish records that j finished in the given state.
+func (j *job) finish(state string, status int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.State, j.info.Status, j.info.Finished = state, status, time.Now()
+	close(j.done)
+}
+
+// Info returns information about j.
+func (j *job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+// finished reports whether j has finished.
+func (j *job) finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return !j.info.Finished.IsZero()
+}
+
+// startWithAffinity starts cmd restricted to the CPUs in set.
+func startWithAffinity(cmd *exec.Cmd, set *cpuset.Set) error {
+	errc := make(chan error)
+	go func() {
+		// The child inherits this thread's affinity. Leave the
+		// thread locked so it exits with this goroutine rather
+		// than running other goroutines with this affinity.
+		runtime.LockOSThread()
+		if set.Count() > 0 {
+			if err := cpuset.SetAffinity(0, set); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
+
+// jobs returns information about all jobs.
+func jobs() []JobInfo {
+	theJobs.Lock()
+	defer theJobs.Unlock()
+	var infos []JobInfo
+	for _, j := range theJobs.jobs {
+		infos = append(infos, j.Info())
+	}
+	return infos
+}
+
+// findJob returns job id, or nil if there's no such job.
+func findJob(id int) *job {
+	theJobs.Lock()
+	defer theJobs.Unlock()
+	for _, j := range theJobs.jobs {
+		if j.info.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// cancelJob cancels job id for s.
+func (s *Server) cancelJob(id int) error {
+	theJobs.Lock()
+	defer theJobs.Unlock()
+	for _, j := range theJobs.jobs {
+		if j.info.ID != id {
+			continue
+		}
+		if j.owner.uid != s.id.uid && !s.isAdmin() {
+			return fmt.Errorf("job %d belongs to %s", id, j.owner.userName)
+		}
+		if j.finished() {
+			return fmt.Errorf("job %d already finished", id)
+		}
+		j.cancelOnce.Do(func() { close(j.cancel) })
+		return nil
+	}
+	return fmt.Errorf("no job %d", id)
+}
@@ -0,0 +1,208 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// The load gate delays granting an exclusive lock until the load left
+// behind by commands that ran outside perflock, such as a large build
+// that just finished, has died down.
+
+// defaultLoadGateTimeout is the default for loadGateConfig.Timeout.
+const defaultLoadGateTimeout = 5 * time.Minute
+
+// loadGatePoll is how often the load gate measures the load. CPU
+// usage is measured over this interval.
+const loadGatePoll = time.Second
+
+// loadGateConfig configures the load gate.
+type loadGateConfig struct {
+	// MaxLoad is the load, in CPUs, that the 1-minute load average
+	// and the CPU usage not due to perflock must both drop below
+	// before an exclusive lock is granted. Acquirers may override
+	// it with -max-load.
+	MaxLoad float64 `json:"maxLoad"`
+
+	// Timeout is how long to wait for the load to drop before
+	// granting the lock anyway. If zero, it defaults to
+	// defaultLoadGateTimeout.
+	Timeout duration `json:"timeout"`
+}
+
+// hostLoad is the load on the host that isn't due to perflock.
+type hostLoad struct {
+	// Avg is the 1-minute load average, less one for each core
+	// reserved by another command holding the lock.
+	Avg float64
+
+	// Busy is the number of CPUs' worth of time used on the CPUs
+	// not reserved by another command holding the lock.
+	Busy float64
+}
+
+func (h hostLoad) String() string {
+	return fmt.Sprintf("load average %.2f, %.2f CPUs busy", h.Avg, h.Busy)
+}
+
+// loadGate waits for the host load to drop before an acquisition is
+// granted.
+type loadGate struct {
+	max     float64
+	timeout time.Duration
+
+	// measure measures the host load, excluding commands holding
+	// the lock other than holder id. It returns false if stop is
+	// closed first.
+	measure func(id int, stop <-chan struct{}) (hostLoad, bool, error)
+}
+
+// newLoadGate returns the load gate for acquire a, or nil if a isn't
+// gated.
+func newLoadGate(a ActionAcquire) *loadGate {
+	if a.Shared || a.Monitor {
+		return nil
+	}
+	g := &loadGate{max: a.MaxLoad, timeout: defaultLoadGateTimeout, measure: measureLoad}
+	if cfg := theConfig.LoadGate; cfg != nil {
+		if g.max == 0 {
+			g.max = cfg.MaxLoad
+		}
+		if cfg.Timeout != 0 {
+			g.timeout = time.Duration(cfg.Timeout)
+		}
+	}
+	if g.max == 0 {
+		return nil
+	}
+	return g
+}
+
+// wait waits until the host load drops below g.max, g.timeout passes,
+// or stop is closed, for the acquisition holding the lock as id. It
+// returns a warning for the acquirer if the gate was bypassed, and
+// false if stop was closed.
+func (g *loadGate) wait(log *slog.Logger, id int, stop <-chan struct{}) (string, bool) {
+	start := time.Now()
+	for {
+		load, ok, err := g.measure(id, stop)
+		if !ok {
+			return "", false
+		}
+		if err != nil {
+			log.Warn("measuring load; not waiting for it to drop", "err", err)
+			return fmt.Sprintf("not waiting for the load to drop: %v", err), true
+		}
+		if load.Avg < g.max && load.Busy < g.max {
+			log.Debug("load dropped", "load", load.Avg, "busy", load.Busy, "waited", time.Since(start))
+			return "", true
+		}
+		if time.Since(start) >= g.timeout {
+			log.Info("load gate timed out", "load", load.Avg, "busy", load.Busy, "max", g.max)
+			return fmt.Sprintf("load did not drop below %g within %v (%v); running anyway", g.max, g.timeout, load), true
+		}
+	}
+}
+
+// measureLoad measures the host load over loadGatePoll, excluding
+// commands holding the lock other than holder id.
+func measureLoad(id int, stop <-chan struct{}) (hostLoad, bool, error) {
+	before, err := readCPUTimes()
+	if err != nil {
+		return hostLoad{}, true, err
+	}
+	select {
+	case <-time.After(loadGatePoll):
+	case <-stop:
+		return hostLoad{}, false, nil
+	}
+	after, err := readCPUTimes()
+	if err != nil {
+		return hostLoad{}, true, err
+	}
+	avg := loadAvg()
+	if avg == nil {
+		return hostLoad{}, true, fmt.Errorf("load average unavailable")
+	}
+
+	// Commands holding the lock on reserved cores are confined to
+	// them, so the CPUs outside them are busy with other work.
+	var others cpuset.Set
+	for _, e := range theLock.Queue() {
+		if e.Held && e.ID != id {
+			others = cpuset.Union(&others, &e.Assigned)
+		}
+	}
+	all := theLock.All()
+	cpus := cpuset.Difference(&all, &others)
+	load := hostLoad{Avg: max(avg[0]-float64(others.Count()), 0)}
+	for _, cpu := range cpuset.ToSlice(&cpus) {
+		b, a := before[cpu], after[cpu]
+		if total := a.total - b.total; total > 0 {
+			load.Busy += float64(a.busy-b.busy) / float64(total)
+		}
+	}
+	return load, true, nil
+}
+
+// cpuTime is the time a CPU has spent busy and in total, in clock
+// ticks.
+type cpuTime struct {
+	busy, total uint64
+}
+
+// readCPUTimes returns the time each CPU has spent busy.
+func readCPUTimes() (map[int]cpuTime, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUTimes(data)
+}
+
+// parseCPUTimes parses the per-CPU lines of /proc/stat.
+func parseCPUTimes(data []byte) (map[int]cpuTime, error) {
+	times := make(map[int]cpuTime)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		cpu, err := strconv.Atoi(fields[0][len("cpu"):])
+		if err != nil {
+			return nil, fmt.Errorf("malformed /proc/stat line %q", sc.Text())
+		}
+		var t cpuTime
+		// The fields are user, nice, system, idle, iowait, irq,
+		// softirq, steal, guest, and guest_nice time. Guest time
+		// is already included in user time.
+		for i, f := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed /proc/stat line %q", sc.Text())
+			}
+			t.total += n
+			if i != 3 && i != 4 {
+				t.busy += n
+			}
+		}
+		times[cpu] = t
+	}
+	return times, sc.Err()
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCPUTimes(t *testing.T) {
+	const stat = `cpu  30 0 20 150 10 0 0 0 0 0
+cpu0 10 0 10 70 10 0 0 0 0 0
+cpu1 20 0 10 80 0 0 0 0 5 0
+intr 12345
+`
+	times, err := parseCPUTimes([]byte(stat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]cpuTime{0: {busy: 20, total: 100}, 1: {busy: 30, total: 110}}
+	if len(times) != len(want) {
+		t.Fatalf("got %v, want %v", times, want)
+	}
+	for cpu, w := range want {
+		if times[cpu] != w {
+			t.Errorf("cpu%d: got %+v, want %+v", cpu, times[cpu], w)
+		}
+	}
+
+	if _, err := parseCPUTimes([]byte("cpu0 1 2 x 4 5\n")); err == nil {
+		t.Errorf("parsing malformed line succeeded")
+	}
+}
+
+func TestLoadGate(t *testing.T) {
+	// fake returns the loads in turn, repeating the last one.
+	fake := func(loads ...hostLoad) func(int, <-chan struct{}) (hostLoad, bool, error) {
+		return func(id int, stop <-chan struct{}) (hostLoad, bool, error) {
+			select {
+			case <-stop:
+				return hostLoad{}, false, nil
+			default:
+			}
+			l := loads[0]
+			if len(loads) > 1 {
+				loads = loads[1:]
+			}
+			return l, true, nil
+		}
+	}
+	log := slog.New(slog.DiscardHandler)
+
+	// The gate opens once both measures drop.
+	g := &loadGate{max: 1, timeout: time.Hour, measure: fake(hostLoad{4, 0}, hostLoad{0.5, 2}, hostLoad{0.5, 0.2})}
+	if warning, ok := g.wait(log, 1, nil); !ok || warning != "" {
+		t.Errorf("got %q, %v; want the gate to open", warning, ok)
+	}
+
+	// It's bypassed with a warning once it times out.
+	g = &loadGate{max: 1, timeout: 0, measure: fake(hostLoad{4, 4})}
+	if warning, ok := g.wait(log, 1, nil); !ok || !strings.Contains(warning, "running anyway") {
+		t.Errorf("got %q, %v; want a bypass warning", warning, ok)
+	}
+
+	// Waiting stops when asked to.
+	stop := make(chan struct{})
+	close(stop)
+	g = &loadGate{max: 1, timeout: time.Hour, measure: fake(hostLoad{4, 4})}
+	if _, ok := g.wait(log, 1, stop); ok {
+		t.Errorf("wait did not stop")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// localLock is a lock shared by perflock processes on this machine
+// without a daemon. It provides mutual exclusion, but none of the
+// daemon's scheduling: waiters aren't necessarily granted the lock in
+// order, shared commands can't reserve cores, and nothing changes the
+// CPU governor.
+type localLock interface {
+	// Lock acquires the lock in shared or exclusive mode. If
+	// deadline is non-zero, Lock gives up at deadline and returns
+	// false. The lock is held until perflock exits.
+	Lock(shared bool, deadline time.Time) (bool, error)
+}
+
+// daemonFlags are the command flags that need the daemon.
+var daemonFlags = []string{"at", "window", "submit", "after", "after-ok", "n", "topology", "hugepages", "mlock", "no-swap", "mem", "cpu-max", "count", "monitor", "max-load"}
+
+// localRun is a command to run under a localLock.
+type localRun struct {
+	cmd              []string
+	shared           bool
+	cores            int
+	coresPct         int
+	cpus             cpuset.Set
+	try              bool
+	deadline         time.Time
+	notify           string
+	envOut           string
+	benchfmt         bool
+	membind          bool
+	rusage           string
+	perfStat         string
+	warmup           time.Duration
+	ab               *abRun
+	governor         *governorFlag
+	grace, killAfter time.Duration
+
+	// standalone indicates -standalone, where perflock sets the CPU
+	// governor itself rather than leaving it alone.
+	standalone bool
+
+	// nested indicates that perflock was run by a command holding
+	// the lock, which perflock runs under without acquiring it or
+	// changing the CPU governor.
+	nested bool
+}
+
+// runLocal runs r.cmd under lock and exits with its status.
+func runLocal(lock localLock, r localRun) {
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range daemonFlags {
+			if f.Name == name && r.nested {
+				fatalf("-%s is not supported when run by another perflock (use -reacquire)", name)
+			} else if f.Name == name {
+				fatalf("-%s requires the perflock daemon", name)
+			}
+		}
+	})
+	if r.governor.set && r.governor.percent >= 0 && !r.standalone && !r.nested {
+		fatal("-governor requires the perflock daemon or -standalone (use -governor none)")
+	}
+	if r.shared && (r.cores != 0 || r.coresPct != 0 || r.cpus.Count() > 0) {
+		fatal("-cores and -cpus require an exclusive lock without the perflock daemon")
+	}
+	var resp ActionAcquireResponse
+	if r.cores != 0 || r.coresPct != 0 {
+		cpus, err := localCores(r.cores, r.coresPct)
+		if err != nil {
+			fatal(err)
+		}
+		resp.Cores = cpus
+	} else if r.cpus.Count() > 0 {
+		resp.Cores = r.cpus
+	}
+	resp.Affinity = resp.Cores
+
+	start := time.Now()
+	ok, err := lock.Lock(r.shared, start)
+	if err == nil && !ok && !r.try {
+		fmt.Fprintf(os.Stderr, "Waiting for lock...\n")
+		ok, err = lock.Lock(r.shared, r.deadline)
+	}
+	if err != nil {
+		fatal("acquiring lock: ", err)
+	}
+	if !ok {
+		if r.try {
+			fmt.Fprintln(os.Stderr, "Lock is busy")
+		} else {
+			fmt.Fprintln(os.Stderr, "Deadline passed before acquiring the lock")
+		}
+		os.Exit(exitNotAcquired)
+	}
+
+	n := notifier{cmd: r.notify, command: shellEscapeList(r.cmd)}
+	n.acquired(time.Since(start))
+	if resp.Affinity.Count() > 0 {
+		runtime.LockOSThread()
+		if err := setAffinity(&resp.Affinity); err != nil {
+			fatal("setting CPU affinity: ", err)
+		}
+	}
+	if r.membind {
+		if err := membind(resp.Cores); err != nil {
+			fatal("binding memory to NUMA nodes: ", err)
+		}
+	}
+	governor := -1
+	restore := func() error { return nil }
+	if r.standalone && !r.nested && !r.shared && r.governor.percent >= 0 {
+		var err error
+		restore, err = applyGovernor(r.governor.percent)
+		if err != nil {
+			if r.governor.set {
+				fatalf("cannot set CPU governor: %v (use -governor none to run without it)", err)
+			}
+			log.Printf("warning: not setting CPU governor: %v", err)
+			restore = func() error { return nil }
+		} else {
+			governor = r.governor.percent
+		}
+	}
+	if r.warmup > 0 {
+		warmUp(resp.Affinity, r.warmup)
+	}
+	var env envSnapshot
+	if r.envOut != "" || r.benchfmt {
+		env = readEnv(resp, r.shared, governor)
+		// With -perf-stat, the snapshot is written after command
+		// runs, with the counters.
+		if r.envOut != "" && r.perfStat == "" {
+			if err := writeEnv(r.envOut, env); err != nil {
+				restore()
+				fatal("writing environment snapshot: ", err)
+			}
+		}
+		if r.benchfmt {
+			fmt.Print(env.benchfmt())
+		}
+	}
+	// A nested perflock's command inherits its parent's marker.
+	var cmdEnv []string
+	if !r.nested {
+		cmdEnv = withMarker(os.Environ(), lockMode(r.shared, false), resp.Cores)
+	}
+	cmd := r.cmd
+	var perf *perfStat
+	if r.perfStat != "" {
+		perf = &perfStat{events: r.perfStat}
+		var err error
+		if cmd, err = perf.wrap(cmd, resp.Affinity); err != nil {
+			restore()
+			fatal("-perf-stat: ", err)
+		}
+	}
+	var status int
+	if r.ab != nil {
+		status = r.ab.run(cmdEnv, r.grace, r.killAfter, r.rusage)
+	} else {
+		var usage *Usage
+		status, usage = run(cmd, cmdEnv, r.grace, r.killAfter)
+		if perf != nil {
+			perf.finish(&env, r.envOut)
+		}
+		if r.rusage != "" && usage != nil {
+			writeUsage(os.Stderr, r.rusage, usage)
+		}
+	}
+	if err := restore(); err != nil {
+		log.Printf("warning: restoring CPU governor: %v", err)
+	}
+	n.finished(status)
+	// Closing the lock would release it early.
+	runtime.KeepAlive(lock)
+	os.Exit(status)
+}
+
+// localCores picks n CPUs, or pct percent of the available CPUs if pct
+// is non-zero, for an exclusive command without the daemon. Like the
+// daemon, it leaves CPU 0 for other tasks, if it can.
+func localCores(n, pct int) (cpuset.Set, error) {
+	avail, err := cpuset.GetAffinity(0)
+	if err != nil {
+		return cpuset.Set{}, err
+	}
+	cpus := cpuset.ToSlice(&avail)
+	if len(cpus) > 1 && cpus[0] == 0 {
+		cpus = cpus[1:]
+	}
+	if pct != 0 {
+		n = percentOfCores(len(cpus), pct)
+	}
+	if n < 0 || n > len(cpus) {
+		return cpuset.Set{}, fmt.Errorf("cannot reserve %d cores; %d are available", n, len(cpus))
+	}
+	return cpuset.FromSlice(cpus[:n])
+}
@@ -0,0 +1,41 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+func TestLocalCores(t *testing.T) {
+	avail, err := cpuset.GetAffinity(0)
+	if err != nil {
+		t.Skip("cannot get CPU affinity: ", err)
+	}
+	n := avail.Count()
+	if n < 2 {
+		t.Skip("need at least 2 CPUs")
+	}
+
+	cpus, err := localCores(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpus.Count() != 1 || cpus.IsSet(0) {
+		t.Errorf("localCores(1, 0) = %s, want one CPU other than 0", cpuset.String(&cpus))
+	}
+	if _, err := localCores(n+1, 0); err == nil {
+		t.Errorf("localCores(%d, 0) succeeded with %d CPUs available", n+1, n)
+	}
+	// CPU 0 is left out of the percentage.
+	cpus, err = localCores(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := n - 1; avail.IsSet(0) && cpus.Count() != want {
+		t.Errorf("localCores(0, 100) = %s, want %d CPUs", cpuset.String(&cpus), want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// localLockName is the file -fallback and -standalone lock. It's in a
+// directory every user can create files in, so whoever gets there
+// first creates it. Anyone else could also have created it, so
+// openFlockLock is careful about what it opens.
+const localLockName = "/tmp/perflock.lock"
+
+// flockPollInterval is how often flockLock retries a lock with a
+// deadline, since flock itself can't time out.
+const flockPollInterval = 100 * time.Millisecond
+
+// flockLock is a localLock made of an advisory flock on a file.
+// Exclusive and shared mode map to LOCK_EX and LOCK_SH. The kernel
+// releases the lock when perflock exits, however it exits.
+type flockLock struct {
+	f *os.File
+}
+
+func newLocalLock() (localLock, error) {
+	return openFlockLock(localLockName)
+}
+
+// openFlockLock opens the lock file path, creating it if necessary.
+// It refuses to follow a symlink at path or to use anything but a
+// regular file, such as a FIFO, which could block perflock forever.
+func openFlockLock(path string) (*flockLock, error) {
+	// Don't pass O_CREATE if the file exists: with
+	// fs.protected_regular, Linux refuses it in a sticky directory
+	// if someone else owns the file. flock only needs the file
+	// open for reading. O_NONBLOCK keeps opening a FIFO from
+	// waiting for a writer.
+	const flags = os.O_RDONLY | unix.O_NOFOLLOW | unix.O_NONBLOCK
+	f, err := os.OpenFile(path, flags, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.OpenFile(path, flags|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			// Let other users open it despite our umask.
+			f.Chmod(0666)
+		} else if errors.Is(err, fs.ErrExist) {
+			f, err = os.OpenFile(path, flags, 0)
+		}
+	}
+	if errors.Is(err, unix.ELOOP) {
+		return nil, fmt.Errorf("lock file %s is a symlink", path)
+	} else if errors.Is(err, fs.ErrPermission) {
+		return nil, fmt.Errorf("%w; remove it if another user created it unreadable", err)
+	} else if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("lock file %s is not a regular file", path)
+	}
+	return &flockLock{f}, nil
+}
+
+func (l *flockLock) Lock(shared bool, deadline time.Time) (bool, error) {
+	how := unix.LOCK_EX
+	if shared {
+		how = unix.LOCK_SH
+	}
+	if deadline.IsZero() {
+		for {
+			err := unix.Flock(int(l.f.Fd()), how)
+			if err != unix.EINTR {
+				return err == nil, err
+			}
+		}
+	}
+	for {
+		err := unix.Flock(int(l.f.Fd()), how|unix.LOCK_NB)
+		if err == nil {
+			return true, nil
+		} else if err != unix.EWOULDBLOCK && err != unix.EINTR {
+			return false, err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false, nil
+		}
+		time.Sleep(min(wait, flockPollInterval))
+	}
+}
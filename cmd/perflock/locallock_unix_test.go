@@ -0,0 +1,82 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFlockLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perflock.lock")
+	// Each open is a separate lock, even in one process.
+	open := func() *flockLock {
+		l, err := openFlockLock(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.f.Close() })
+		return l
+	}
+	try := func(l *flockLock, shared bool) bool {
+		ok, err := l.Lock(shared, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	a, b, c := open(), open(), open()
+	if !try(a, true) || !try(b, true) {
+		t.Fatal("failed to acquire two shared locks")
+	}
+	if try(c, false) {
+		t.Fatal("acquired exclusive lock while shared lock is held")
+	}
+
+	// Wait for the exclusive lock until the shared locks are
+	// released.
+	go func() {
+		time.Sleep(2 * flockPollInterval)
+		a.f.Close()
+		b.f.Close()
+	}()
+	if ok, err := c.Lock(false, time.Now().Add(time.Minute)); !ok || err != nil {
+		t.Fatalf("waiting for exclusive lock: %v, %v", ok, err)
+	}
+	if try(open(), true) {
+		t.Fatal("acquired shared lock while exclusive lock is held")
+	}
+}
+
+func TestFlockLockFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// Anyone can create the lock file, so perflock must not follow
+	// a symlink or hang opening a FIFO.
+	symlink := filepath.Join(dir, "symlink")
+	if err := os.Symlink(filepath.Join(dir, "target"), symlink); err != nil {
+		t.Fatal(err)
+	}
+	fifo := filepath.Join(dir, "fifo")
+	if err := unix.Mkfifo(fifo, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{symlink, fifo, dir} {
+		if l, err := openFlockLock(path); err == nil {
+			l.f.Close()
+			t.Errorf("openFlockLock(%s) succeeded, want error", path)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "target")); err == nil {
+		t.Errorf("openFlockLock created the target of a symlink")
+	}
+}
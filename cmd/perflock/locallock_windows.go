@@ -0,0 +1,117 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mutexLock is a localLock made of global named mutexes, which any
+// user's perflock can open. An exclusive holder owns the gate and
+// every slot. A shared holder owns one slot, and takes the gate only
+// while claiming it, so waiting exclusive holders aren't starved.
+//
+// Windows releases a mutex when the process owning it exits, even if
+// it crashes, so the lock can't be left held.
+type mutexLock struct {
+	gate  windows.Handle
+	slots []windows.Handle
+}
+
+// localLockName is the name of the gate mutex. The slots are named
+// after it.
+const localLockName = `Global\perflock`
+
+// maxSharedHolders is the number of slots, and hence of commands that
+// may hold the lock in shared mode at once. It is limited by
+// WaitForMultipleObjects.
+const maxSharedHolders = 64 // MAXIMUM_WAIT_OBJECTS
+
+// mutexSDDL grants everyone the right to wait on and release the
+// mutexes.
+const mutexSDDL = "D:(A;;0x00100001;;;WD)"
+
+func newLocalLock() (localLock, error) {
+	sd, err := windows.SecurityDescriptorFromString(mutexSDDL)
+	if err != nil {
+		return nil, err
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	open := func(name string) (windows.Handle, error) {
+		p, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			return 0, err
+		}
+		h, err := windows.CreateMutex(sa, false, p)
+		if err == windows.ERROR_ALREADY_EXISTS {
+			err = nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("opening mutex %s: %w", name, err)
+		}
+		return h, nil
+	}
+
+	var l mutexLock
+	if l.gate, err = open(localLockName); err != nil {
+		return nil, err
+	}
+	for i := 0; i < maxSharedHolders; i++ {
+		h, err := open(fmt.Sprintf("%s-shared-%d", localLockName, i))
+		if err != nil {
+			return nil, err
+		}
+		l.slots = append(l.slots, h)
+	}
+	return &l, nil
+}
+
+func (l *mutexLock) Lock(shared bool, deadline time.Time) (bool, error) {
+	// Mutexes are owned by threads, so stay on this one.
+	runtime.LockOSThread()
+
+	if ok, err := l.wait(l.gate, nil, false, deadline); !ok || err != nil {
+		return ok, err
+	}
+	ok, err := l.wait(0, l.slots, !shared, deadline)
+	if shared || !ok || err != nil {
+		windows.ReleaseMutex(l.gate)
+	}
+	return ok, err
+}
+
+// wait waits for h, or for one or all of hs, until deadline. It
+// reports whether it acquired them.
+func (l *mutexLock) wait(h windows.Handle, hs []windows.Handle, all bool, deadline time.Time) (bool, error) {
+	ms := uint32(windows.INFINITE)
+	if !deadline.IsZero() {
+		ms = 0
+		if d := time.Until(deadline); d > 0 {
+			ms = uint32(d.Milliseconds())
+		}
+	}
+	var ev uint32
+	var err error
+	if hs == nil {
+		ev, err = windows.WaitForSingleObject(h, ms)
+	} else {
+		ev, err = windows.WaitForMultipleObjects(hs, all, ms)
+	}
+	if err != nil {
+		return false, err
+	}
+	if ev == uint32(windows.WAIT_TIMEOUT) {
+		return false, nil
+	}
+	// WAIT_ABANDONED means a holder exited without releasing the
+	// mutex. We own it now.
+	return true, nil
+}
@@ -4,32 +4,352 @@
 
 package main
 
-import "sync"
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/cputopology"
+)
 
 type PerfLock struct {
 	l sync.Mutex
 	q []*Locker
+
+	// changed is closed and replaced every time q changes.
+	changed chan struct{}
+
+	// all is the set of all cores commands may run on.
+	all cpuset.Set
+
+	// cores is the subset of all that can be reserved by lockers.
+	cores cpuset.Set
+
+	// topo is the CPU topology, used to satisfy topology
+	// constraints. If nil, topology constraints can't be satisfied.
+	topo *cputopology.Topology
+
+	// backfillMaxWait, if non-zero, enables backfilling: a shared
+	// locker whose cores are free may be woken ahead of earlier
+	// shared lockers waiting for more cores than are free, as long
+	// as none of them has waited longer than backfillMaxWait.
+	backfillMaxWait time.Duration
+
+	// holds records how long recent acquisitions held the lock,
+	// keyed by command, for estimating wait times.
+	holds map[string]time.Duration
+
+	// lastID is the most recently assigned locker or reservation
+	// ID.
+	lastID int
+
+	// reservations are the current and future reservations of the
+	// exclusive lock.
+	reservations []*reservation
+
+	// maxQueue and maxQueuePerUser, if non-zero, limit the number of
+	// lockers waiting in the queue, in total and per user.
+	maxQueue, maxQueuePerUser int
+
+	// maxShared, if non-zero, limits the number of shared lockers
+	// that may hold the lock at once.
+	maxShared int
+
+	// monitors are the monitor lockers. They hold the lock from when
+	// they're enqueued, independently of q.
+	monitors []*Locker
+
+	// paused stops waiting lockers in q from being woken. Lockers
+	// that hold the lock keep it.
+	paused bool
 }
 
+// maxHolds bounds the number of commands PerfLock.holds remembers.
+const maxHolds = 1000
+
 type Locker struct {
 	C      <-chan bool
 	c      chan<- bool
 	shared bool
 	woken  bool
 
+	// monitor indicates a monitor locker, which never waits or
+	// makes others wait.
+	monitor bool
+
+	// id identifies this locker for ActionPosition.
+	id int
+
+	// user is the user this locker is for, if known.
+	user string
+
+	// reservation, if non-zero, is the ID of the reservation this
+	// locker acquires under.
+	reservation int
+
 	msg string
+
+	// cmd is the command this locker is for, used to estimate
+	// hold times.
+	cmd string
+
+	// nCores is the number of cores requested, or 0 if this locker
+	// doesn't need dedicated cores.
+	nCores int
+
+	// topology is the topology constraint on the requested cores.
+	topology string
+
+	// cpus, if non-empty, is the specific set of cores requested.
+	// In this case, nCores is its size.
+	cpus cpuset.Set
+
+	// cores is the set of cores reserved for this locker once it
+	// is woken.
+	cores cpuset.Set
+
+	// affinity is the set of cores this locker's command should be
+	// restricted to once it is woken, or empty if it is
+	// unrestricted.
+	affinity cpuset.Set
+
+	// enqueued is when this locker was enqueued.
+	enqueued time.Time
+
+	// wokeAt is when this locker was woken.
+	wokeAt time.Time
+
+	// err is set if this locker was removed from the queue
+	// without acquiring the lock.
+	err error
+
+	// evicted is closed when an administrator evicts this locker.
+	// The owner of the locker must then cancel or release it.
+	evicted chan struct{}
+
+	// evicting indicates that evicted has been closed.
+	evicting bool
 }
 
-func (l *PerfLock) Enqueue(shared, nonblocking bool, msg string) *Locker {
-	ch := make(chan bool, 1)
-	locker := &Locker{ch, ch, shared, false, msg}
+// ID returns the ID of locker, which identifies it in ActionPosition.
+func (locker *Locker) ID() int {
+	return locker.id
+}
+
+// Cores returns the set of cores reserved for locker. This is only
+// valid once the locker has been woken.
+func (locker *Locker) Cores() cpuset.Set {
+	return locker.cores
+}
+
+// Err returns why locker was refused the lock. If the lock is refused,
+// C receives false instead of true, and locker is no longer enqueued.
+func (locker *Locker) Err() error {
+	return locker.err
+}
+
+// Evicted returns a channel that is closed when an administrator
+// evicts locker with PerfLock.Evict.
+func (locker *Locker) Evicted() <-chan struct{} {
+	return locker.evicted
+}
+
+// Affinity returns the set of cores locker's command should be
+// restricted to, or an empty set if it is unrestricted. This is only
+// valid once the locker has been woken.
+func (locker *Locker) Affinity() cpuset.Set {
+	return locker.affinity
+}
+
+// All returns the set of all cores commands may run on.
+func (l *PerfLock) All() cpuset.Set {
+	l.l.Lock()
+	defer l.l.Unlock()
+	return l.all
+}
+
+// Reservable returns the set of cores that can be reserved by
+// lockers.
+func (l *PerfLock) Reservable() cpuset.Set {
+	l.l.Lock()
+	defer l.l.Unlock()
+	return l.cores
+}
+
+// Topology returns a description of where in the CPU topology the
+// cores reserved for locker are.
+func (l *PerfLock) Topology(locker *Locker) string {
+	// SetCores may replace l.topo concurrently.
+	l.l.Lock()
+	defer l.l.Unlock()
+	if l.topo == nil || locker.nCores == 0 {
+		return ""
+	}
+	return l.topo.Describe(&locker.cores)
+}
 
-	// Enqueue.
+// CheckCores returns an error if the cores requested by a could
+// never be reserved.
+func (l *PerfLock) CheckCores(a ActionAcquire) error {
 	l.l.Lock()
 	defer l.l.Unlock()
+	if a.CPUs.Count() > 0 {
+		if a.Cores != 0 || a.Topology != TopologyAny {
+			return fmt.Errorf("cannot combine specific CPUs with a number of cores or topology")
+		}
+		if missing := cpuset.Difference(&a.CPUs, &l.cores); missing.Count() > 0 {
+			return fmt.Errorf("cannot reserve CPUs %s", cpuset.String(&missing))
+		}
+		return nil
+	}
+	n, topology := a.Cores, a.Topology
+	if n < 0 {
+		return fmt.Errorf("cannot reserve %d cores", n)
+	}
+	if topology != TopologyAny && n == 0 {
+		return fmt.Errorf("topology constraint %q requires reserving cores", topology)
+	}
+	if _, ok := l.takeCores(&l.cores, n, topology); !ok {
+		if topology == TopologyAny {
+			return fmt.Errorf("cannot reserve %d cores; %d are available", n, l.cores.Count())
+		}
+		return fmt.Errorf("cannot reserve %d cores with topology %q", n, topology)
+	}
+	return nil
+}
+
+// SetCores sets the set of all cores commands may run on, the
+// subset of those that can be reserved by lockers, and their
+// topology.
+//
+// SetCores may be called at any time, for example if CPUs are
+// hotplugged. Lockers that already hold cores keep them, even if
+// they are no longer reservable. Waiting lockers whose request can
+// no longer be satisfied are refused.
+func (l *PerfLock) SetCores(all, cores cpuset.Set, topo *cputopology.Topology) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.all, l.cores, l.topo = all, cores, topo
+	if len(l.q) == 0 {
+		return
+	}
+
+	q := l.q[:0]
+	for _, locker := range l.q {
+		if !locker.woken && locker.nCores > 0 {
+			if _, ok := l.take(locker, &l.cores); !ok {
+				locker.err = fmt.Errorf("cannot reserve %d cores after CPUs changed; %d are available", locker.nCores, l.cores.Count())
+				locker.c <- false
+				continue
+			}
+		}
+		q = append(q, locker)
+	}
+	l.setQ(q)
+}
+
+// SetLimits sets the limits on the queue and on the number of shared
+// holders, and the backfill wait. Lockers already in the queue keep
+// their places, even if they exceed the new limits.
+func (l *PerfLock) SetLimits(maxQueue, maxQueuePerUser, maxShared int, backfillMaxWait time.Duration) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.maxQueue, l.maxQueuePerUser = maxQueue, maxQueuePerUser
+	l.maxShared, l.backfillMaxWait = maxShared, backfillMaxWait
+	l.setQ(l.q)
+}
+
+// Paused reports whether waking waiting lockers is paused.
+func (l *PerfLock) Paused() bool {
+	l.l.Lock()
+	defer l.l.Unlock()
+	return l.paused
+}
+
+// SetPaused pauses or resumes waking waiting lockers.
+func (l *PerfLock) SetPaused(paused bool) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.paused = paused
+	l.setQ(l.q)
+}
+
+// Enqueue enqueues an acquire of the lock with the parameters in a.
+// msg is the queue entry describing it. If a is non-blocking and the
+// lock can't be acquired immediately, Enqueue returns nil. Enqueue
+// ignores the queue limits.
+func (l *PerfLock) Enqueue(a ActionAcquire, msg string) *Locker {
+	l.l.Lock()
+	defer l.l.Unlock()
+	return l.enqueue(newLocker(a, msg), a.NonBlocking, 0)
+}
+
+// EnqueueAs is like Enqueue, but on behalf of user, subject to the
+// queue limits. If id is non-zero, it must have been returned by
+// NewID, and becomes the locker's ID. If a would wait and the queue is
+// full, EnqueueAs returns an error wrapping errQueueFull.
+func (l *PerfLock) EnqueueAs(a ActionAcquire, user, msg string, id int) (*Locker, error) {
+	locker := newLocker(a, msg)
+	locker.user = user
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	if !a.NonBlocking && a.Reservation == 0 {
+		if err := l.checkLimits(user); err != nil {
+			return nil, err
+		}
+	}
+	return l.enqueue(locker, a.NonBlocking, id), nil
+}
+
+// checkLimits returns an error if user may not add another waiting
+// locker to the queue. l.l must be held.
+func (l *PerfLock) checkLimits(user string) error {
+	waiting, mine := 0, 0
+	for _, locker := range l.q {
+		if !locker.woken {
+			waiting++
+			if locker.user == user {
+				mine++
+			}
+		}
+	}
+	if l.maxQueue > 0 && waiting >= l.maxQueue {
+		return fmt.Errorf("%w: %d acquisitions are waiting", errQueueFull, waiting)
+	}
+	if l.maxQueuePerUser > 0 && mine >= l.maxQueuePerUser {
+		return fmt.Errorf("%w: user %s has %d acquisitions waiting", errQueueFull, user, mine)
+	}
+	return nil
+}
+
+func (l *PerfLock) enqueue(locker *Locker, nonBlocking bool, id int) *Locker {
+	if id == 0 {
+		l.lastID++
+		id = l.lastID
+	}
+	locker.id = id
+	if locker.monitor {
+		l.monitors = append(l.monitors, locker)
+		l.wake(locker)
+		l.setQ(l.q)
+		return locker
+	}
+	if locker.reservation != 0 {
+		// Go ahead of everything that's waiting.
+		i := 0
+		for i < len(l.q) && l.q[i].woken {
+			i++
+		}
+		l.setQ(slices.Insert(l.q, i, locker))
+		return locker
+	}
 	l.setQ(append(l.q, locker))
 
-	if nonblocking && !locker.woken {
+	if nonBlocking && !locker.woken {
 		// Acquire failed. Dequeue.
 		l.setQ(l.q[:len(l.q)-1])
 		return nil
@@ -38,11 +358,79 @@ func (l *PerfLock) Enqueue(shared, nonblocking bool, msg string) *Locker {
 	return locker
 }
 
+// NewID returns a new locker ID for a later EnqueueAs.
+func (l *PerfLock) NewID() int {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.lastID++
+	return l.lastID
+}
+
+func newLocker(a ActionAcquire, msg string) *Locker {
+	ch := make(chan bool, 1)
+	locker := &Locker{C: ch, c: ch, shared: a.Shared, monitor: a.Monitor, msg: msg, cmd: a.Msg, nCores: a.Cores, topology: a.Topology, cpus: a.CPUs, reservation: a.Reservation, enqueued: time.Now(), evicted: make(chan struct{})}
+	if a.CPUs.Count() > 0 {
+		locker.nCores = a.CPUs.Count()
+	}
+	return locker
+}
+
+// Plan returns what would happen if a were enqueued now, without
+// enqueuing it. If a could be acquired immediately, Plan returns the
+// resulting locker, whose Cores and Affinity are what a would get.
+// Otherwise, it returns nil and the number of lockers a would wait
+// behind.
+func (l *PerfLock) Plan(a ActionAcquire) (*Locker, int) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if a.Monitor {
+		return newLocker(a, ""), 0
+	}
+
+	// Simulate the enqueue on a copy of the queue, so we don't wake
+	// anyone.
+	sim := PerfLock{all: l.all, cores: l.cores, topo: l.topo, backfillMaxWait: l.backfillMaxWait, maxShared: l.maxShared, holds: l.holds, reservations: l.reservations, paused: l.paused}
+	var q []*Locker
+	for _, locker := range l.q {
+		cp := *locker
+		ch := make(chan bool, 1)
+		cp.C, cp.c = ch, ch
+		q = append(q, &cp)
+	}
+	locker := newLocker(a, "")
+	sim.setQ(append(q, locker))
+	if !locker.woken {
+		return nil, len(l.q)
+	}
+	return locker, 0
+}
+
 func (l *PerfLock) Dequeue(locker *Locker) {
+	l.dequeue(locker, true)
+}
+
+// Cancel dequeues locker, which was cancelled before it could use the
+// lock, even if it was woken.
+func (l *PerfLock) Cancel(locker *Locker) {
+	l.dequeue(locker, false)
+}
+
+func (l *PerfLock) dequeue(locker *Locker, used bool) {
 	l.l.Lock()
 	defer l.l.Unlock()
+	if locker.monitor {
+		if i := slices.Index(l.monitors, locker); i >= 0 {
+			l.monitors = slices.Delete(l.monitors, i, i+1)
+			l.setQ(l.q)
+			return
+		}
+	}
 	for i, o := range l.q {
 		if locker == o {
+			if locker.woken && used {
+				l.recordHold(locker.cmd, time.Since(locker.wokeAt))
+			}
 			copy(l.q[i:], l.q[i+1:])
 			l.setQ(l.q[:len(l.q)-1])
 			return
@@ -51,38 +439,519 @@ func (l *PerfLock) Dequeue(locker *Locker) {
 	panic("Dequeue of non-enqueued Locker")
 }
 
-func (l *PerfLock) Queue() []string {
-	var q []string
+// Evict asks the owner of the waiting or held locker id to cancel or
+// release it. It returns an error if there is no such locker.
+func (l *PerfLock) Evict(id int) error {
+	l.l.Lock()
+	defer l.l.Unlock()
+	for _, locker := range slices.Concat(l.q, l.monitors) {
+		if locker.id != id {
+			continue
+		}
+		if !locker.evicting {
+			locker.evicting = true
+			close(locker.evicted)
+		}
+		return nil
+	}
+	return fmt.Errorf("no acquisition %d", id)
+}
+
+// recordHold records that an acquisition for cmd held the lock for d.
+func (l *PerfLock) recordHold(cmd string, d time.Duration) {
+	if l.holds == nil {
+		l.holds = make(map[string]time.Duration)
+	}
+	old, ok := l.holds[cmd]
+	if !ok {
+		if len(l.holds) >= maxHolds {
+			// Forget an arbitrary command.
+			for k := range l.holds {
+				delete(l.holds, k)
+				break
+			}
+		}
+		l.holds[cmd] = d
+		return
+	}
+	// Weight recent holds more heavily.
+	l.holds[cmd] = old + (d-old)/4
+}
+
+// ETA estimates how long until locker acquires the lock, based on how
+// long earlier acquisitions of the same commands held it. It returns
+// false if locker isn't enqueued or there's no history for a command
+// ahead of it.
+func (l *PerfLock) ETA(locker *Locker) (time.Duration, bool) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	return l.eta(locker)
+}
+
+func (l *PerfLock) eta(locker *Locker) (time.Duration, bool) {
+	// Lockers that hold the lock run concurrently, so wait for the
+	// longest of them. Waiting lockers ahead of locker run one
+	// after another. (This overestimates for shared lockers that
+	// will run concurrently.)
+	var running, waiting time.Duration
+	now := time.Now()
+	for _, o := range l.q {
+		if o == locker {
+			return running + waiting, true
+		}
+		est, ok := l.holds[o.cmd]
+		if !ok {
+			return 0, false
+		}
+		if o.woken {
+			if rest := est - now.Sub(o.wokeAt); rest > running {
+				running = rest
+			}
+		} else {
+			waiting += est
+		}
+	}
+	return 0, false
+}
+
+// Queue returns the lockers in the queue, followed by the monitors
+// and the reservations.
+func (l *PerfLock) Queue() []ListEntry {
+	var q []ListEntry
 
 	l.l.Lock()
 	defer l.l.Unlock()
 	for _, locker := range l.q {
-		q = append(q, locker.msg)
+		q = append(q, ListEntry{
+			ID:       locker.id,
+			User:     locker.user,
+			Command:  locker.cmd,
+			Enqueued: locker.enqueued,
+			Shared:   locker.shared,
+			Held:     locker.woken,
+			Cores:    locker.nCores,
+			CPUs:     locker.cpus,
+			Topology: locker.topology,
+			Assigned: locker.cores,
+		})
+	}
+	for _, locker := range l.monitors {
+		q = append(q, ListEntry{
+			ID:       locker.id,
+			User:     locker.user,
+			Command:  locker.cmd,
+			Enqueued: locker.enqueued,
+			Held:     true,
+			Monitor:  true,
+		})
+	}
+	for _, r := range l.reservations {
+		q = append(q, ListEntry{
+			ID:          r.id,
+			User:        r.user,
+			Command:     r.cmd,
+			Enqueued:    r.made,
+			Reservation: true,
+			Start:       r.start,
+			End:         r.end,
+		})
 	}
 	return q
 }
 
+// Counts returns the number of lockers holding the lock and the
+// number waiting for it.
+func (l *PerfLock) Counts() (held, waiting int) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	for _, locker := range l.q {
+		if locker.woken {
+			held++
+		} else {
+			waiting++
+		}
+	}
+	return
+}
+
+// Changed returns a channel that will be closed the next time the
+// queue changes.
+func (l *PerfLock) Changed() <-chan struct{} {
+	l.l.Lock()
+	defer l.l.Unlock()
+	if l.changed == nil {
+		l.changed = make(chan struct{})
+	}
+	return l.changed
+}
+
+// Position returns the number of lockers ahead of locker in the
+// queue, or -1 if locker is not enqueued.
+func (l *PerfLock) Position(locker *Locker) int {
+	l.l.Lock()
+	defer l.l.Unlock()
+	for i, o := range l.q {
+		if locker == o {
+			return i
+		}
+	}
+	return -1
+}
+
+// Status returns the state of the locker with the given ID, or false
+// if no such locker is enqueued.
+func (l *PerfLock) Status(id int) (ActionPositionResponse, bool) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	var reserved cpuset.Set
+	for _, o := range l.q {
+		if o.woken {
+			reserved = cpuset.Union(&reserved, &o.cores)
+		}
+	}
+	for i, locker := range l.q {
+		if locker.id != id {
+			continue
+		}
+		resp := ActionPositionResponse{
+			Acquired: locker.woken,
+			Position: i,
+			Msg:      locker.msg,
+			Shared:   locker.shared,
+			Cores:    locker.nCores,
+			Topology: locker.topology,
+			CPUs:     locker.cpus,
+			Free:     cpuset.Difference(&l.cores, &reserved),
+		}
+		if locker.woken {
+			resp.Position = -1
+		} else {
+			resp.ETA, _ = l.eta(locker)
+		}
+		return resp, true
+	}
+	return ActionPositionResponse{}, false
+}
+
 func (l *PerfLock) setQ(q []*Locker) {
 	l.q = q
-	if len(q) == 0 {
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+	if len(q) == 0 || l.paused {
+		return
+	}
+
+	now := time.Now()
+	if !q[0].shared {
+		if !q[0].woken && l.reservedAgainst(q[0], now) {
+			return
+		}
+		// A reservation's acquire goes ahead of everything that's
+		// waiting, which with backfilling can include shared
+		// lockers ahead of ones that hold the lock. Wait for those
+		// to release it.
+		if !q[0].woken && slices.ContainsFunc(q[1:], func(o *Locker) bool { return o.woken }) {
+			return
+		}
+		if q[0].nCores > 0 && !q[0].woken {
+			q[0].cores, _ = l.take(q[0], &l.cores)
+		}
+		l.wake(q[0])
 		return
 	}
 
-	wake := func(locker *Locker) {
-		if locker.woken == false {
-			locker.woken = true
-			locker.c <- true
+	// Wake all shared acquires at the head of the queue whose
+	// cores are available. This stops at the first exclusive
+	// acquire, so shared acquires enqueued after an exclusive
+	// waiter can't starve it.
+	var reserved cpuset.Set
+	held := 0
+	for _, locker := range q {
+		if locker.woken {
+			reserved = cpuset.Union(&reserved, &locker.cores)
+			held++
+		}
+	}
+	free := cpuset.Difference(&l.cores, &reserved)
+	for _, locker := range q {
+		if !locker.shared {
+			break
+		}
+		if locker.woken {
+			continue
+		}
+		if l.maxShared > 0 && held >= l.maxShared {
+			break
+		}
+		if l.reservedAgainst(locker, now) {
+			break
+		}
+		if locker.nCores > 0 {
+			cores, ok := l.take(locker, &free)
+			if !ok {
+				// This locker has to wait for cores. Unless
+				// we're backfilling, so does everything
+				// behind it.
+				if l.backfillMaxWait == 0 || now.Sub(locker.enqueued) > l.backfillMaxWait {
+					break
+				}
+				continue
+			}
+			locker.cores = cores
+			free = cpuset.Difference(&free, &locker.cores)
+		}
+		l.wake(locker)
+		held++
+	}
+}
+
+// wake grants locker the lock, if it doesn't already hold it.
+func (l *PerfLock) wake(locker *Locker) {
+	if locker.woken == false {
+		locker.woken = true
+		locker.wokeAt = time.Now()
+		locker.affinity = l.affinity(locker)
+		locker.c <- true
+	}
+}
+
+// affinity returns the set of cores locker's command should be
+// restricted to, or an empty set if it is unrestricted.
+func (l *PerfLock) affinity(locker *Locker) cpuset.Set {
+	if locker.nCores > 0 {
+		return locker.cores
+	}
+	if !locker.shared || locker.monitor {
+		return cpuset.Set{}
+	}
+	// Keep shared commands without reserved cores off the cores
+	// currently reserved by other lockers, and off the isolated
+	// cores, which are meant for reservations.
+	var avoid cpuset.Set
+	for _, o := range l.q {
+		if o.woken && o.nCores > 0 {
+			avoid = cpuset.Union(&avoid, &o.cores)
+		}
+	}
+	if l.topo != nil {
+		avoid = cpuset.Union(&avoid, &l.topo.Isolated)
+	}
+	leftover := cpuset.Difference(&l.all, &avoid)
+	if leftover.Count() == 0 || cpuset.Equal(&leftover, &l.all) {
+		// Either nothing is left, in which case there's nowhere
+		// better to run, or nothing needs avoiding.
+		return cpuset.Set{}
+	}
+	return leftover
+}
+
+// take returns the cores to reserve for locker from free, or false if
+// they aren't free.
+func (l *PerfLock) take(locker *Locker, free *cpuset.Set) (cpuset.Set, bool) {
+	if locker.cpus.Count() > 0 {
+		if missing := cpuset.Difference(&locker.cpus, free); missing.Count() > 0 {
+			return cpuset.Set{}, false
 		}
+		return locker.cpus, true
+	}
+	return l.takeCores(free, locker.nCores, locker.topology)
+}
+
+// takeCores returns n cores from free that satisfy the topology
+// constraint, or false if there aren't enough such cores in free.
+//
+// takeCores prefers cores the kernel has isolated (isolcpus or
+// nohz_full), since those are set aside for benchmarks. Beyond that,
+// to reduce interference between concurrent reservations, takeCores
+// places each reservation as far from the already reserved cores as
+// it can: in the packages with the fewest reserved cores and, within
+// those, in the L3 caches with the fewest reserved cores. It keeps
+// each reservation itself within as few L3 caches as possible.
+//
+// Shared lockers that didn't request cores are confined to the cores
+// that weren't reserved when they were woken, but they keep running
+// there if cores are reserved later. For example, if J3 acquires
+// without -cores on an idle 8 core machine, and then J1 and J2
+// reserve cores 0-3 and 4-7, J3 will compete with J1 and J2 for their
+// cores. Had J1 and J2 reserved first, J3 would have been confined to
+// the housekeeping cores.
+func (l *PerfLock) takeCores(free *cpuset.Set, n int, topology string) (cpuset.Set, bool) {
+	if free.Count() < n {
+		return cpuset.Set{}, false
 	}
-	if q[0].shared {
-		// Wake all shared acquires at the head of the queue.
-		for _, locker := range q {
-			if !locker.shared {
+	if l.topo == nil {
+		if topology != TopologyAny {
+			return cpuset.Set{}, false
+		}
+		return l.takeLowest([]cpuset.Set{*free}, free, free, n), true
+	}
+
+	reserved := cpuset.Difference(&l.cores, free)
+	iso := &l.topo.Isolated
+	groups := l.spreadGroups(free, &reserved)
+	switch topology {
+	case TopologyAny:
+		return l.takeLowest(preferIsolated(groups, iso), free, free, n), true
+	case TopologySameL3:
+		sort.SliceStable(groups, func(i, j int) bool {
+			return overlap(&groups[i], iso) > overlap(&groups[j], iso)
+		})
+		for _, group := range groups {
+			if group.Count() >= n {
+				return l.takeLowest(preferIsolated([]cpuset.Set{group}, iso), free, free, n), true
+			}
+		}
+	case TopologySameSocket:
+		pkgs := l.topo.Groups(cputopology.Package)
+		sort.SliceStable(pkgs, func(i, j int) bool {
+			ri, rj := overlap(&pkgs[i], &reserved), overlap(&pkgs[j], &reserved)
+			if ri != rj {
+				return ri < rj
+			}
+			ai, aj := cpuset.Intersect(&pkgs[i], free), cpuset.Intersect(&pkgs[j], free)
+			return overlap(&ai, iso) > overlap(&aj, iso)
+		})
+		for _, pkg := range pkgs {
+			avail := cpuset.Intersect(&pkg, free)
+			if avail.Count() >= n {
+				return l.takeLowest(preferIsolated(groups, iso), &avail, free, n), true
+			}
+		}
+	}
+	return cpuset.Set{}, false
+}
+
+// spreadGroups returns the free cores grouped by L3 cache (or by
+// package if there is no L3 information), in the order takeCores
+// should prefer them given the reserved cores. Free cores that aren't
+// in any group are returned in a final group.
+func (l *PerfLock) spreadGroups(free, reserved *cpuset.Set) []cpuset.Set {
+	pkgs := l.topo.Groups(cputopology.Package)
+	units := l.topo.Groups(cputopology.L3)
+	if len(units) == 0 {
+		units = pkgs
+	}
+	pkgOf := func(group *cpuset.Set) *cpuset.Set {
+		for i := range pkgs {
+			if overlap(&pkgs[i], group) > 0 {
+				return &pkgs[i]
+			}
+		}
+		return group
+	}
+
+	type unit struct {
+		free                  cpuset.Set
+		pkgReserved, reserved int
+	}
+	var us []unit
+	var grouped cpuset.Set
+	for i := range units {
+		grouped = cpuset.Union(&grouped, &units[i])
+		avail := cpuset.Intersect(&units[i], free)
+		if avail.Count() == 0 {
+			continue
+		}
+		us = append(us, unit{avail, overlap(pkgOf(&units[i]), reserved), overlap(&units[i], reserved)})
+	}
+	sort.SliceStable(us, func(i, j int) bool {
+		a, b := &us[i], &us[j]
+		if a.pkgReserved != b.pkgReserved {
+			return a.pkgReserved < b.pkgReserved
+		}
+		if a.reserved != b.reserved {
+			return a.reserved < b.reserved
+		}
+		// Prefer the largest free groups so reservations span
+		// fewer groups.
+		return a.free.Count() > b.free.Count()
+	})
+
+	groups := make([]cpuset.Set, 0, len(us)+1)
+	for _, u := range us {
+		groups = append(groups, u.free)
+	}
+	if rest := cpuset.Difference(free, &grouped); rest.Count() > 0 {
+		groups = append(groups, rest)
+	}
+	return groups
+}
+
+// preferIsolated splits each group into its isolated and
+// non-isolated cores and returns all of the isolated parts first.
+func preferIsolated(groups []cpuset.Set, iso *cpuset.Set) []cpuset.Set {
+	if iso.Count() == 0 {
+		return groups
+	}
+	out := make([]cpuset.Set, 0, 2*len(groups))
+	for i := range groups {
+		out = append(out, cpuset.Intersect(&groups[i], iso))
+	}
+	for i := range groups {
+		out = append(out, cpuset.Difference(&groups[i], iso))
+	}
+	return out
+}
+
+// takeLowest returns n cores from within, taking cores from each
+// group in order. The groups must contain at least n cores from
+// within.
+//
+// Within each group, it takes whole physical cores whose hardware
+// threads are all free before threads whose siblings are in use, so
+// that lockers share physical cores as little as possible.
+func (l *PerfLock) takeLowest(groups []cpuset.Set, within, free *cpuset.Set, n int) cpuset.Set {
+	var cores cpuset.Set
+	take := func(cpus []int) bool {
+		for _, cpu := range cpus {
+			if n == 0 {
 				break
 			}
-			wake(locker)
+			cores.Set(cpu)
+			n--
+		}
+		return n == 0
+	}
+	for i := range groups {
+		avail := cpuset.Intersect(&groups[i], within)
+		whole, partial := l.byPhysicalCore(&avail, free)
+		if take(whole) || take(partial) {
+			break
 		}
-	} else {
-		wake(q[0])
 	}
+	return cores
+}
+
+// byPhysicalCore splits the cores in avail into those whose physical
+// core is entirely free, with siblings adjacent, and those whose
+// physical core has threads that aren't free.
+func (l *PerfLock) byPhysicalCore(avail, free *cpuset.Set) (whole, partial []int) {
+	if l.topo == nil {
+		return cpuset.ToSlice(avail), nil
+	}
+	var seen cpuset.Set
+	for _, phys := range l.topo.Groups(cputopology.Core) {
+		threads := cpuset.Intersect(&phys, avail)
+		if threads.Count() == 0 {
+			continue
+		}
+		seen = cpuset.Union(&seen, &threads)
+		if overlap(&phys, free) == phys.Count() {
+			whole = append(whole, cpuset.ToSlice(&threads)...)
+		} else {
+			partial = append(partial, cpuset.ToSlice(&threads)...)
+		}
+	}
+	// Cores with unknown topology.
+	rest := cpuset.Difference(avail, &seen)
+	whole = append(whole, cpuset.ToSlice(&rest)...)
+	return whole, partial
+}
+
+// overlap returns the number of cores in both a and b.
+func overlap(a, b *cpuset.Set) int {
+	both := cpuset.Intersect(a, b)
+	return both.Count()
 }
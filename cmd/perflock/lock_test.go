@@ -0,0 +1,729 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/cputopology"
+)
+
+func woken(locker *Locker) bool {
+	select {
+	case <-locker.C:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestSharedDoesNotStarveExclusive(t *testing.T) {
+	var l PerfLock
+
+	// A shared holder, followed by an exclusive waiter.
+	s1 := l.Enqueue(ActionAcquire{Shared: true}, "s1")
+	if !woken(s1) {
+		t.Fatalf("first shared locker not woken")
+	}
+	x := l.Enqueue(ActionAcquire{}, "x")
+	if woken(x) {
+		t.Fatalf("exclusive locker woken while shared lock held")
+	}
+
+	// A stream of shared acquires must queue behind the exclusive
+	// waiter rather than joining the current shared holders.
+	for i := 0; i < 3; i++ {
+		if l.Enqueue(ActionAcquire{Shared: true, NonBlocking: true}, "s") != nil {
+			t.Fatalf("non-blocking shared acquire succeeded ahead of exclusive waiter")
+		}
+	}
+	s2 := l.Enqueue(ActionAcquire{Shared: true}, "s2")
+	if woken(s2) {
+		t.Fatalf("shared locker woken ahead of exclusive waiter")
+	}
+
+	// Once the shared holder releases, the exclusive waiter runs,
+	// and only then the later shared locker.
+	l.Dequeue(s1)
+	if !woken(x) {
+		t.Fatalf("exclusive locker not woken after shared release")
+	}
+	if woken(s2) {
+		t.Fatalf("shared locker woken while exclusive lock held")
+	}
+	l.Dequeue(x)
+	if !woken(s2) {
+		t.Fatalf("shared locker not woken after exclusive release")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	var l PerfLock
+
+	// A monitor is granted the lock even while an exclusive locker
+	// holds it and another waits.
+	x1 := l.Enqueue(ActionAcquire{}, "x1")
+	x2 := l.Enqueue(ActionAcquire{}, "x2")
+	m := l.Enqueue(ActionAcquire{Monitor: true, NonBlocking: true}, "m")
+	if m == nil || !woken(m) {
+		t.Fatalf("monitor not woken while exclusive lock held")
+	}
+	if !woken(x1) {
+		t.Fatalf("first exclusive locker not woken")
+	}
+
+	// The monitor doesn't delay the exclusive waiter.
+	l.Dequeue(x1)
+	if !woken(x2) {
+		t.Fatalf("exclusive locker not woken while monitor held")
+	}
+	if held, waiting := l.Counts(); held != 1 || waiting != 0 {
+		t.Errorf("got %d held and %d waiting, want monitor not counted", held, waiting)
+	}
+	q := l.Queue()
+	if len(q) != 2 || !q[1].Monitor || !q[1].Held {
+		t.Fatalf("got queue %+v, want the monitor listed after x2", q)
+	}
+	if got := q[1].String(); !strings.HasSuffix(got, " [monitor]") {
+		t.Errorf("got %q, want a [monitor] entry", got)
+	}
+	l.Dequeue(m)
+	if q := l.Queue(); len(q) != 1 {
+		t.Errorf("got %d entries after monitor released, want 1", len(q))
+	}
+}
+
+func coreSet(cpus ...int) cpuset.Set {
+	var s cpuset.Set
+	for _, cpu := range cpus {
+		s.Set(cpu)
+	}
+	return s
+}
+
+func TestCores(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	b := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "b")
+	if !woken(a) || !woken(b) {
+		t.Fatalf("lockers with disjoint cores not both woken")
+	}
+	ac, bc := a.Cores(), b.Cores()
+	if all, want := cpuset.Union(&ac, &bc), coreSet(0, 1, 2, 3); ac.Count() != 2 || bc.Count() != 2 || !cpuset.Equal(&all, &want) {
+		t.Fatalf("want disjoint 2 core reservations, got %s and %s", cpuset.String(&ac), cpuset.String(&bc))
+	}
+
+	// No cores are left, so this has to wait.
+	c := l.Enqueue(ActionAcquire{Shared: true, Cores: 1}, "c")
+	if woken(c) {
+		t.Fatalf("locker woken with no free cores")
+	}
+	l.Dequeue(a)
+	if !woken(c) {
+		t.Fatalf("locker not woken after cores freed")
+	}
+	if cc, ac := c.Cores(), a.Cores(); !ac.IsSet(cpuset.ToSlice(&cc)[0]) {
+		t.Fatalf("want core from %s, got %s", cpuset.String(&ac), cpuset.String(&cc))
+	}
+}
+
+func TestMaxShared(t *testing.T) {
+	l := PerfLock{maxShared: 2}
+
+	a := l.Enqueue(ActionAcquire{Shared: true}, "a")
+	b := l.Enqueue(ActionAcquire{Shared: true}, "b")
+	c := l.Enqueue(ActionAcquire{Shared: true}, "c")
+	if !woken(a) || !woken(b) {
+		t.Fatalf("shared lockers under the cap not woken")
+	}
+	if woken(c) {
+		t.Fatalf("shared locker over the cap woken")
+	}
+	// Monitors don't count against the cap.
+	if m := l.Enqueue(ActionAcquire{Monitor: true}, "m"); !woken(m) {
+		t.Fatalf("monitor not woken at the shared cap")
+	}
+	if plan, _ := l.Plan(ActionAcquire{Shared: true}); plan != nil {
+		t.Errorf("plan of shared acquire over the cap succeeded")
+	}
+	l.Dequeue(a)
+	if !woken(c) {
+		t.Fatalf("shared locker not woken after a holder released")
+	}
+}
+
+func TestPause(t *testing.T) {
+	var l PerfLock
+	a := l.Enqueue(ActionAcquire{Shared: true}, "a")
+	l.SetPaused(true)
+
+	// Holders keep the lock, but nothing new is woken, not even a
+	// shared locker that could join them.
+	b := l.Enqueue(ActionAcquire{Shared: true}, "b")
+	if !woken(a) || woken(b) {
+		t.Fatalf("paused lock woke a new locker")
+	}
+	if l.Enqueue(ActionAcquire{Shared: true, NonBlocking: true}, "c") != nil {
+		t.Errorf("non-blocking acquire succeeded while paused")
+	}
+	l.Dequeue(a)
+	if woken(b) {
+		t.Fatalf("paused lock woke a waiting locker after a release")
+	}
+
+	l.SetPaused(false)
+	if !woken(b) {
+		t.Fatalf("waiting locker not woken after resuming")
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	l := PerfLock{maxShared: 1}
+	a := l.Enqueue(ActionAcquire{Shared: true}, "a")
+	b := l.Enqueue(ActionAcquire{Shared: true}, "b")
+	if !woken(a) || woken(b) {
+		t.Fatalf("shared locker over the cap woken")
+	}
+	// Raising the cap wakes the waiting locker.
+	l.SetLimits(0, 0, 2, 0)
+	if !woken(b) {
+		t.Fatalf("shared locker not woken after raising the cap")
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	for _, backfill := range []bool{false, true} {
+		var l PerfLock
+		l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+		if backfill {
+			l.backfillMaxWait = time.Hour
+		}
+
+		a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+		big := l.Enqueue(ActionAcquire{Shared: true, Cores: 3}, "big")
+		small := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "small")
+		if !woken(a) || woken(big) {
+			t.Fatalf("backfill=%v: want only first locker woken", backfill)
+		}
+		if got := woken(small); got != backfill {
+			t.Errorf("backfill=%v: small locker woken = %v", backfill, got)
+		}
+	}
+
+	// Once the big locker has waited too long, nothing may start
+	// ahead of it.
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+	l.backfillMaxWait = time.Hour
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	big := l.Enqueue(ActionAcquire{Shared: true, Cores: 3}, "big")
+	big.enqueued = big.enqueued.Add(-2 * time.Hour)
+	small := l.Enqueue(ActionAcquire{Shared: true, Cores: 1}, "small")
+	if !woken(a) || woken(big) || woken(small) {
+		t.Errorf("locker backfilled ahead of a locker that waited too long")
+	}
+}
+
+func TestTopology(t *testing.T) {
+	// Two L3 caches of four CPUs each in one package.
+	topo := &cputopology.Topology{}
+	for cpu := 0; cpu < 8; cpu++ {
+		topo.CPUs = append(topo.CPUs, cputopology.CPU{ID: cpu, Package: 0, Core: cpu, L3: cpu / 4 * 4})
+	}
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3, 4, 5, 6, 7), coreSet(0, 1, 2, 3, 4, 5, 6, 7), topo)
+
+	if err := l.CheckCores(ActionAcquire{Cores: 5, Topology: TopologySameL3}); err == nil {
+		t.Errorf("5 cores sharing an L3 are not possible, but CheckCores succeeded")
+	}
+
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	b := l.Enqueue(ActionAcquire{Shared: true, Cores: 3, Topology: TopologySameL3}, "b")
+	if !woken(a) || !woken(b) {
+		t.Fatalf("lockers not woken")
+	}
+	if got, want := b.Cores(), coreSet(4, 5, 6); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s sharing an L3, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+
+	// There are 3 free cores, but not in the same L3.
+	c := l.Enqueue(ActionAcquire{Shared: true, Cores: 3, Topology: TopologySameL3}, "c")
+	if woken(c) {
+		t.Fatalf("locker woken without enough cores sharing an L3")
+	}
+	l.Dequeue(a)
+	if !woken(c) {
+		t.Fatalf("locker not woken after L3 freed")
+	}
+	if got := l.Topology(c); got != "package 0, L3 0" {
+		t.Errorf("want topology %q, got %q", "package 0, L3 0", got)
+	}
+}
+
+func TestTopologyDuringSetCores(t *testing.T) {
+	// Topology may be called while CPU hotplug replaces the
+	// topology. Run with -race to check this.
+	topo := &cputopology.Topology{}
+	for cpu := 0; cpu < 4; cpu++ {
+		topo.CPUs = append(topo.CPUs, cputopology.CPU{ID: cpu, Core: cpu})
+	}
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), topo)
+	a := l.Enqueue(ActionAcquire{Cores: 2}, "a")
+	if !woken(a) {
+		t.Fatalf("locker not woken")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), topo)
+		}
+	}()
+	for range 100 {
+		if got := l.Topology(a); got == "" {
+			t.Errorf("got no topology for reserved cores")
+		}
+	}
+	<-done
+}
+
+func TestSpread(t *testing.T) {
+	// Two packages, each with two L3 caches of four CPUs.
+	topo := &cputopology.Topology{}
+	var all cpuset.Set
+	for cpu := 0; cpu < 16; cpu++ {
+		topo.CPUs = append(topo.CPUs, cputopology.CPU{ID: cpu, Package: cpu / 8, Core: cpu, L3: cpu / 4 * 4})
+		all.Set(cpu)
+	}
+	var l PerfLock
+	l.SetCores(all, all, topo)
+
+	// Each reservation should go to a different package first, and
+	// then to a different L3 cache.
+	for _, want := range []cpuset.Set{coreSet(0, 1), coreSet(8, 9), coreSet(4, 5), coreSet(12, 13)} {
+		locker := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "x")
+		if got := locker.Cores(); !woken(locker) || !cpuset.Equal(&got, &want) {
+			t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+		}
+	}
+
+	// A reservation that doesn't fit in one L3 cache should span as
+	// few as possible.
+	locker := l.Enqueue(ActionAcquire{Shared: true, Cores: 3}, "x")
+	if got, want := locker.Cores(), coreSet(2, 3, 6); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	// Two physical cores with two threads each, numbered like
+	// Linux numbers them.
+	topo := &cputopology.Topology{}
+	for cpu := 0; cpu < 4; cpu++ {
+		topo.CPUs = append(topo.CPUs, cputopology.CPU{ID: cpu, Core: cpu % 2, L3: 0})
+	}
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), topo)
+
+	// A two core reservation gets both threads of a physical core.
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	if got, want := a.Cores(), coreSet(0, 2); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+	l.Dequeue(a)
+
+	// Single core reservations avoid sharing a physical core until
+	// they have to.
+	for _, want := range []cpuset.Set{coreSet(0), coreSet(1), coreSet(2)} {
+		locker := l.Enqueue(ActionAcquire{Shared: true, Cores: 1}, "x")
+		if got := locker.Cores(); !cpuset.Equal(&got, &want) {
+			t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+		}
+	}
+}
+
+func TestIsolated(t *testing.T) {
+	topo := &cputopology.Topology{Isolated: coreSet(2, 3)}
+	for cpu := 0; cpu < 4; cpu++ {
+		topo.CPUs = append(topo.CPUs, cputopology.CPU{ID: cpu, Core: cpu, L3: 0})
+	}
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(1, 2, 3), topo)
+
+	// Reservations prefer isolated cores.
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 1}, "a")
+	if got, want := a.Cores(), coreSet(2); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+	if got, want := a.Affinity(), coreSet(2); !cpuset.Equal(&got, &want) {
+		t.Errorf("want affinity %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+
+	// Shared lockers without cores stay off the isolated cores.
+	b := l.Enqueue(ActionAcquire{Shared: true}, "b")
+	if !woken(b) {
+		t.Fatal("b not woken")
+	}
+	if got, want := b.Affinity(), coreSet(0, 1); !cpuset.Equal(&got, &want) {
+		t.Errorf("want affinity %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+}
+
+func TestSetCoresRefuses(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	b := l.Enqueue(ActionAcquire{Shared: true, Cores: 4}, "b")
+	c := l.Enqueue(ActionAcquire{Shared: true, Cores: 1}, "c")
+	if !woken(a) || woken(b) || woken(c) {
+		t.Fatal("want only a woken")
+	}
+
+	// CPU 3 goes offline. b can never get 4 cores, so it's refused
+	// and c can proceed.
+	l.SetCores(coreSet(0, 1, 2), coreSet(0, 1, 2), nil)
+	select {
+	case ok := <-b.C:
+		if ok || b.Err() == nil {
+			t.Fatal("want b refused")
+		}
+	default:
+		t.Fatal("b not refused")
+	}
+	if got, want := l.Position(b), -1; got != want {
+		t.Errorf("b at position %d, want %d", got, want)
+	}
+	if !woken(c) {
+		t.Fatal("c not woken")
+	}
+	if got, want := c.Cores(), coreSet(2); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+}
+
+func TestCPUs(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+
+	if err := l.CheckCores(ActionAcquire{CPUs: coreSet(3, 4)}); err == nil {
+		t.Errorf("CPU 4 is not reservable, but CheckCores succeeded")
+	}
+
+	a := l.Enqueue(ActionAcquire{Shared: true, CPUs: coreSet(1, 2)}, "a")
+	if !woken(a) {
+		t.Fatal("a not woken")
+	}
+	if got, want := a.Cores(), coreSet(1, 2); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+
+	// b overlaps a, so it must wait even though enough cores are
+	// free.
+	b := l.Enqueue(ActionAcquire{Shared: true, CPUs: coreSet(2, 3)}, "b")
+	if woken(b) {
+		t.Fatal("b woken while its CPUs are reserved")
+	}
+	l.Dequeue(a)
+	if !woken(b) {
+		t.Fatal("b not woken")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	if !woken(a) {
+		t.Fatal("a not woken")
+	}
+
+	// There's room for 2 more cores.
+	p, _ := l.Plan(ActionAcquire{Shared: true, Cores: 2})
+	if p == nil {
+		t.Fatal("plan for 2 cores would wait")
+	}
+	if got, want := p.Cores(), coreSet(2, 3); !cpuset.Equal(&got, &want) {
+		t.Errorf("want cores %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+
+	// An exclusive acquire would wait behind a.
+	if p, ahead := l.Plan(ActionAcquire{}); p != nil || ahead != 1 {
+		t.Errorf("exclusive plan: got %v, %d ahead; want nil, 1 ahead", p, ahead)
+	}
+
+	// Planning doesn't change the queue.
+	if q := l.Queue(); len(q) != 1 {
+		t.Errorf("queue changed by Plan: %v", q)
+	}
+	b := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "b")
+	if !woken(b) {
+		t.Fatal("b not woken after Plan")
+	}
+}
+
+func TestLeftoverAffinity(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(1, 2, 3), nil)
+
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	if !woken(a) {
+		t.Fatal("a not woken")
+	}
+
+	// A shared locker without cores runs on what's left.
+	b := l.Enqueue(ActionAcquire{Shared: true}, "b")
+	if !woken(b) {
+		t.Fatal("b not woken")
+	}
+	if got, want := b.Affinity(), coreSet(0, 3); !cpuset.Equal(&got, &want) {
+		t.Errorf("want affinity %s, got %s", cpuset.String(&want), cpuset.String(&got))
+	}
+
+	// Once nothing is reserved, it's unrestricted.
+	l.Dequeue(a)
+	c := l.Enqueue(ActionAcquire{Shared: true}, "c")
+	if !woken(c) {
+		t.Fatal("c not woken")
+	}
+	if got := c.Affinity(); got.Count() != 0 {
+		t.Errorf("want unrestricted affinity, got %s", cpuset.String(&got))
+	}
+}
+
+func TestETA(t *testing.T) {
+	var l PerfLock
+	l.recordHold("a", 10*time.Minute)
+	l.recordHold("b", 2*time.Minute)
+	l.recordHold("b", 6*time.Minute) // Averages to 3m.
+
+	a := l.Enqueue(ActionAcquire{Msg: "a"}, "a")
+	b := l.Enqueue(ActionAcquire{Msg: "b"}, "b")
+	c := l.Enqueue(ActionAcquire{Msg: "c"}, "c")
+	d := l.Enqueue(ActionAcquire{Msg: "d"}, "d")
+	if !woken(a) {
+		t.Fatal("a not woken")
+	}
+	// Pretend a has been running for 4 minutes.
+	a.wokeAt = time.Now().Add(-4 * time.Minute)
+
+	check := func(locker *Locker, want time.Duration) {
+		t.Helper()
+		got, ok := l.ETA(locker)
+		if !ok {
+			t.Errorf("no ETA for %s, want %v", locker.msg, want)
+		} else if got < want-time.Second || got > want {
+			t.Errorf("ETA for %s is %v, want %v", locker.msg, got, want)
+		}
+	}
+	check(a, 0)
+	check(b, 6*time.Minute)
+	check(c, 9*time.Minute)
+	// There's no history for c.
+	if eta, ok := l.ETA(d); ok {
+		t.Errorf("got ETA %v for d, want none", eta)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3, 4, 5, 6, 7), coreSet(0, 1, 2, 3, 4, 5, 6, 7), nil)
+
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 6}, "a")
+	b := l.Enqueue(ActionAcquire{Shared: true, CPUs: coreSet(4, 5, 6, 7)}, "b")
+	if !woken(a) || woken(b) {
+		t.Fatal("want a woken and b waiting")
+	}
+
+	st, ok := l.Status(a.ID())
+	if !ok || !st.Acquired || st.Position != -1 {
+		t.Errorf("status of a: got %+v, %v; want acquired", st, ok)
+	}
+	st, ok = l.Status(b.ID())
+	if !ok || st.Acquired || st.Position != 1 || st.Msg != "b" {
+		t.Errorf("status of b: got %+v, %v; want waiting at position 1", st, ok)
+	}
+	if want := coreSet(6, 7); !cpuset.Equal(&st.Free, &want) {
+		t.Errorf("free cores: got %s, want %s", cpuset.String(&st.Free), cpuset.String(&want))
+	}
+
+	l.Dequeue(a)
+	if _, ok := l.Status(a.ID()); ok {
+		t.Errorf("got status for dequeued locker")
+	}
+}
+
+func TestReservation(t *testing.T) {
+	var l PerfLock
+	l.recordHold("short", time.Minute)
+	l.recordHold("long", time.Hour)
+
+	start := time.Now().Add(10 * time.Minute)
+	id, err := l.Reserve(start, time.Hour, "alice", "r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Reserve(start.Add(30*time.Minute), time.Hour, "bob", "r2"); err == nil {
+		t.Errorf("overlapping reservation succeeded")
+	}
+
+	// Commands that finish before the reservation starts may run.
+	short := l.Enqueue(ActionAcquire{Msg: "short"}, "short")
+	if !woken(short) {
+		t.Fatalf("short locker not woken before reservation")
+	}
+	l.Dequeue(short)
+
+	// Commands that would overlap it wait, but the reservation's
+	// own acquire goes ahead of them.
+	long := l.Enqueue(ActionAcquire{Msg: "long"}, "long")
+	if woken(long) {
+		t.Fatalf("long locker woken although it would overlap the reservation")
+	}
+	r := l.Enqueue(ActionAcquire{Msg: "r", Reservation: id}, "r")
+	if !woken(r) {
+		t.Fatalf("reserved locker not woken")
+	}
+	if pos := l.Position(r); pos != 0 {
+		t.Errorf("reserved locker at position %d, want 0", pos)
+	}
+	l.Dequeue(r)
+	if woken(long) {
+		t.Fatalf("long locker woken before reservation ended")
+	}
+	l.Unreserve(id)
+	if !woken(long) {
+		t.Fatalf("long locker not woken after reservation ended")
+	}
+}
+
+func TestReservationBackfill(t *testing.T) {
+	l := PerfLock{backfillMaxWait: time.Hour}
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+
+	// small backfills ahead of big, which is waiting for all the
+	// cores.
+	a := l.Enqueue(ActionAcquire{Shared: true, Cores: 2}, "a")
+	big := l.Enqueue(ActionAcquire{Shared: true, Cores: 4}, "big")
+	small := l.Enqueue(ActionAcquire{Shared: true, Cores: 1}, "small")
+	if !woken(a) || woken(big) || !woken(small) {
+		t.Fatalf("small locker didn't backfill")
+	}
+	l.Dequeue(a)
+
+	// The reservation's acquire goes ahead of big, but must wait
+	// for small, which holds a core.
+	id, err := l.Reserve(time.Now(), time.Hour, "alice", "r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := l.Enqueue(ActionAcquire{Reservation: id}, "r")
+	if woken(r) {
+		t.Fatalf("exclusive reserved locker woken while a shared locker holds the lock")
+	}
+	l.Dequeue(small)
+	if !woken(r) {
+		t.Fatalf("reserved locker not woken after the shared locker released")
+	}
+	if woken(big) {
+		t.Fatalf("shared locker woken during the reservation")
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	l := PerfLock{maxQueue: 2, maxQueuePerUser: 1}
+
+	// The holder doesn't count against the limits.
+	if _, err := l.EnqueueAs(ActionAcquire{}, "alice", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.EnqueueAs(ActionAcquire{}, "alice", "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.EnqueueAs(ActionAcquire{}, "alice", "c", 0); !errors.Is(err, errQueueFull) {
+		t.Errorf("alice's second waiting acquire: got %v, want queue full", err)
+	}
+	// Non-blocking acquires don't wait, so they aren't limited.
+	if _, err := l.EnqueueAs(ActionAcquire{NonBlocking: true}, "alice", "d", 0); err != nil {
+		t.Errorf("non-blocking acquire: got %v, want no error", err)
+	}
+	if _, err := l.EnqueueAs(ActionAcquire{}, "bob", "e", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.EnqueueAs(ActionAcquire{}, "carol", "f", 0); !errors.Is(err, errQueueFull) {
+		t.Errorf("third waiting acquire: got %v, want queue full", err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(0, 1, 2, 3), nil)
+	if _, err := l.EnqueueAs(ActionAcquire{Shared: true, Cores: 2, Msg: "a"}, "alice", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.EnqueueAs(ActionAcquire{Msg: "b"}, "bob", "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(time.Hour)
+	if _, err := l.Reserve(start, time.Hour, "carol", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	q := l.Queue()
+	if len(q) != 3 {
+		t.Fatalf("got %d entries, want 3", len(q))
+	}
+	if e := q[0]; e.User != "alice" || e.Command != "a" || !e.Shared || !e.Held || e.Cores != 2 || e.Assigned.Count() != 2 {
+		t.Errorf("got first entry %+v, want alice's held shared acquire of 2 cores", e)
+	}
+	if e := q[1]; e.User != "bob" || e.Shared || e.Held {
+		t.Errorf("got second entry %+v, want bob's waiting exclusive acquire", e)
+	}
+	if e := q[2]; e.User != "carol" || !e.Reservation || !e.Start.Equal(start) {
+		t.Errorf("got third entry %+v, want carol's reservation", e)
+	}
+	snap := ActionWatchResponse{List: q, Reservable: l.Reservable()}
+	if got, want := freeCores(snap), "free cores: 2-3 (2 of 4)"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if got, want := q[0].String(), "alice\t"+q[0].Enqueued.Format(time.Stamp)+"\ta [shared] [2 cores: 0-1]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDump(t *testing.T) {
+	var l PerfLock
+	l.SetCores(coreSet(0, 1, 2, 3), coreSet(1, 2, 3), nil)
+	if _, err := l.EnqueueAs(ActionAcquire{Shared: true, Cores: 2}, "alice", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.EnqueueAs(ActionAcquire{Shared: true, Cores: 2}, "bob", "b", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	d := l.Dump()
+	if len(d.Queue) != 2 {
+		t.Fatalf("got %d lockers, want 2", len(d.Queue))
+	}
+	held, waiting := d.Queue[0], d.Queue[1]
+	if !held.Woken || held.Cores.Count() != 2 || held.WokeAt == nil {
+		t.Errorf("got first locker %+v, want woken with 2 cores", held)
+	}
+	if waiting.Woken || waiting.Cores.Count() != 0 || waiting.WokeAt != nil {
+		t.Errorf("got second locker %+v, want waiting without cores", waiting)
+	}
+	free := cpuset.Difference(&d.Reservable, &held.Cores)
+	if !cpuset.Equal(&d.Free, &free) || d.Free.Count() != 1 {
+		t.Errorf("got free %s, want %s", cpuset.String(&d.Free), cpuset.String(&free))
+	}
+}
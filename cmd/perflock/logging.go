@@ -0,0 +1,150 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The daemon logs with log/slog. Records go to stderr, syslog, or the
+// systemd journal, as set by logConfig. Each client connection logs
+// with a "conn" attribute, so interleaved sessions can be told apart.
+
+// logConfig configures the daemon's logging.
+type logConfig struct {
+	// Target is where to log: "stderr" (the default), "syslog", or
+	// "journal".
+	Target string `json:"target"`
+
+	// Level is the minimum level to log: "debug", "info" (the
+	// default), "warn", or "error". It can be changed while the
+	// daemon is running with perflock -log-level.
+	Level string `json:"level"`
+}
+
+// logLevel is the daemon's current minimum log level.
+var logLevel slog.LevelVar
+
+// lastConnID is the most recently assigned connection ID.
+var lastConnID atomic.Int64
+
+// setupLogging directs the default slog logger, and hence the log
+// package, to the target in cfg.
+func setupLogging(cfg logConfig) error {
+	if cfg.Level != "" {
+		if err := logLevel.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return fmt.Errorf("log level: %w", err)
+		}
+	}
+	var h slog.Handler
+	switch cfg.Target {
+	case "", "stderr":
+		h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})
+	case "syslog":
+		var err error
+		if h, err = newSyslogHandler(); err != nil {
+			return err
+		}
+	case "journal":
+		var err error
+		if h, err = newJournalHandler(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown log target %q", cfg.Target)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// setLogLevel sets the daemon's log level on behalf of s.
+func (s *Server) setLogLevel(level string) error {
+	if !s.isAdmin() {
+		return fmt.Errorf("only administrators may change the log level")
+	}
+	old := logLevel.Level()
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	s.log.Info("log level changed", "from", old, "to", logLevel.Level())
+	return nil
+}
+
+// connLogger returns a logger for a new client connection.
+func connLogger() *slog.Logger {
+	return slog.With("conn", lastConnID.Add(1))
+}
+
+// sinkHandler formats records like slog.TextHandler, without the time
+// and level, and passes each to emit. This suits targets that record
+// those themselves.
+type sinkHandler struct {
+	slog.Handler
+
+	mu    *sync.Mutex
+	buf   *bytes.Buffer
+	emit  func(level slog.Level, line string, attrs []slog.Attr) error
+	attrs []slog.Attr
+	group string
+}
+
+func newSinkHandler(emit func(slog.Level, string, []slog.Attr) error) *sinkHandler {
+	buf := new(bytes.Buffer)
+	opts := &slog.HandlerOptions{
+		Level: &logLevel,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	return &sinkHandler{Handler: slog.NewTextHandler(buf, opts), mu: new(sync.Mutex), buf: buf, emit: emit}
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	attrs := h.attrs
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.qualify(a))
+		return true
+	})
+	return h.emit(r.Level, strings.TrimSuffix(h.buf.String(), "\n"), attrs)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	h2.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], make([]slog.Attr, 0, len(attrs))...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, h.qualify(a))
+	}
+	return &h2
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+// qualify prefixes a's key with h's group.
+func (h *sinkHandler) qualify(a slog.Attr) slog.Attr {
+	a.Key = h.group + a.Key
+	return a
+}
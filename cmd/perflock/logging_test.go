@@ -0,0 +1,49 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSinkHandler(t *testing.T) {
+	type record struct {
+		level slog.Level
+		line  string
+		attrs []slog.Attr
+	}
+	var got []record
+	h := newSinkHandler(func(level slog.Level, line string, attrs []slog.Attr) error {
+		got = append(got, record{level, line, attrs})
+		return nil
+	})
+	l := slog.New(h).With("conn", 1).WithGroup("job")
+	l.Info("started", "id", 7)
+	l.Debug("not logged")
+
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	if r := got[0]; r.level != slog.LevelInfo || r.line != "msg=started conn=1 job.id=7" {
+		t.Errorf("got level %v, line %q", r.level, r.line)
+	}
+	var keys []string
+	for _, a := range got[0].attrs {
+		keys = append(keys, a.Key)
+	}
+	if k := strings.Join(keys, ","); k != "conn,job.id" {
+		t.Errorf("got attribute keys %s, want conn,job.id", k)
+	}
+
+	// Debug records are logged once the level is lowered.
+	defer logLevel.Set(logLevel.Level())
+	logLevel.Set(slog.LevelDebug)
+	if !h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("debug records disabled at level debug")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strings"
+)
+
+// journalSocket is the systemd journal's native protocol socket.
+const journalSocket = "/run/systemd/journal/socket"
+
+// newSyslogHandler returns a handler that logs to syslog.
+func newSyslogHandler() (slog.Handler, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON, "perflock")
+	if err != nil {
+		return nil, err
+	}
+	return newSinkHandler(func(level slog.Level, line string, attrs []slog.Attr) error {
+		switch {
+		case level >= slog.LevelError:
+			return w.Err(line)
+		case level >= slog.LevelWarn:
+			return w.Warning(line)
+		case level >= slog.LevelInfo:
+			return w.Info(line)
+		}
+		return w.Debug(line)
+	}), nil
+}
+
+// newJournalHandler returns a handler that logs to the systemd
+// journal.
+func newJournalHandler() (slog.Handler, error) {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return nil, err
+	}
+	return newSinkHandler(func(level slog.Level, line string, attrs []slog.Attr) error {
+		_, err := conn.Write(journalEntry(level, line, attrs))
+		return err
+	}), nil
+}
+
+// journalEntry encodes a record as a systemd journal native protocol
+// message. Attributes become journal fields, such as CONN=3.
+func journalEntry(level slog.Level, line string, attrs []slog.Attr) []byte {
+	prio := syslog.LOG_DEBUG
+	switch {
+	case level >= slog.LevelError:
+		prio = syslog.LOG_ERR
+	case level >= slog.LevelWarn:
+		prio = syslog.LOG_WARNING
+	case level >= slog.LevelInfo:
+		prio = syslog.LOG_INFO
+	}
+	var b bytes.Buffer
+	field := func(key, value string) {
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", key, value)
+			return
+		}
+		// Values with newlines are length-prefixed.
+		b.WriteString(key + "\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(value)))
+		b.WriteString(value + "\n")
+	}
+	field("PRIORITY", fmt.Sprint(int(prio)))
+	field("SYSLOG_IDENTIFIER", "perflock")
+	field("MESSAGE", line)
+	for _, a := range attrs {
+		if key := journalKey(a.Key); key != "" {
+			field(key, a.Value.String())
+		}
+	}
+	return b.Bytes()
+}
+
+// journalKey returns the journal field name for attribute key, or ""
+// if there is none. Field names consist of uppercase letters, digits,
+// and underscores, and can't start with an underscore or digit.
+func journalKey(key string) string {
+	key = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	key = strings.TrimLeft(key, "_0123456789")
+	switch key {
+	case "", "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		// Don't let attributes override these.
+		return ""
+	}
+	return key
+}
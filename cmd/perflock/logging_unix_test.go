@@ -0,0 +1,45 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestJournalKey(t *testing.T) {
+	for _, test := range []struct{ key, want string }{
+		{"conn", "CONN"},
+		{"user", "USER"},
+		{"job.id", "JOB_ID"},
+		{"_hidden", "HIDDEN"},
+		{"2fast", "FAST"},
+		{"message", ""},
+		{"priority", ""},
+		{"", ""},
+	} {
+		if got := journalKey(test.key); got != test.want {
+			t.Errorf("journalKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestJournalEntry(t *testing.T) {
+	attrs := []slog.Attr{slog.Int("conn", 3), slog.String("message", "ignored")}
+	got := string(journalEntry(slog.LevelWarn, "msg=hello conn=3", attrs))
+	want := "PRIORITY=4\nSYSLOG_IDENTIFIER=perflock\nMESSAGE=msg=hello conn=3\nCONN=3\n"
+	if got != want {
+		t.Errorf("journalEntry = %q, want %q", got, want)
+	}
+
+	// Values with newlines are length-prefixed.
+	got = string(journalEntry(slog.LevelInfo, "a\nb", nil))
+	if !strings.HasSuffix(got, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n") {
+		t.Errorf("journalEntry with newline = %q", got)
+	}
+}
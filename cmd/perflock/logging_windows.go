@@ -0,0 +1,18 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+func newSyslogHandler() (slog.Handler, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func newJournalHandler() (slog.Handler, error) {
+	return nil, errors.ErrUnsupported
+}
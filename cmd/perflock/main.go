@@ -21,6 +21,157 @@
 // shared-mode commands concurrently. This should be used for commands
 // that would perturb benchmarks but aren't themselves benchmarks.
 //
+// In monitor mode (with the -monitor flag), perflock runs command
+// immediately, without waiting for or delaying any other command,
+// regardless of mode. This is meant for lightweight observability
+// agents, such as telemetry samplers and watchdogs. Monitors still
+// appear in perflock -list, so benchmark users can see what else is
+// running.
+//
+// With -cores N, perflock additionally reserves N cores for command
+// and restricts it to run on them. This is mostly useful in shared
+// mode, where commands with disjoint cores can run concurrently
+// without perturbing each other. With -topology same-l3 or
+// same-socket, the reserved cores must all share an L3 cache or a
+// physical package, respectively, and perflock waits until such a
+// set of cores is free. Alternatively, -cpus reserves a specific list
+// of CPUs, such as 2-5,8, and perflock waits until exactly those CPUs
+// are free. -cores also accepts a percentage, such as 50%, of the
+// reservable cores perflock itself may run on, so the same script
+// reserves a sensible number of cores on both small and large hosts.
+//
+// perflock forwards SIGINT, SIGTERM, SIGQUIT, and SIGHUP to command's
+// process group. If command is still running -grace after the first
+// signal, perflock kills it. With -kill-after, perflock also
+// terminates command this way if it runs too long, so a hung command
+// can't hold the lock indefinitely. If perflock receives one of these
+// signals while waiting for the lock, it withdraws from the queue and
+// exits with status 130.
+//
+// With -count N, perflock runs command N times, releasing the lock
+// and waiting for it again between runs. Commands waiting for the lock
+// run in between, so several users' repeated benchmarks interleave
+// fairly, and each run samples the machine at a different time. It
+// stops at the first run that fails.
+//
+// "perflock ab -- commandA... -- commandB..." compares two commands.
+// It acquires the exclusive lock once and runs the commands
+// alternately under the same environment, in the order A B B A, -count
+// times, so neither command consistently benefits from running first.
+// Before each run, it prints the benchfmt configuration line "ab: A"
+// or "ab: B" to stdout, so when the commands are Go benchmarks,
+// "benchstat -col ab" compares them directly.
+//
+// With -warmup DURATION, perflock keeps command's CPUs busy for
+// DURATION after setting the CPU governor and before running command,
+// so the CPU frequency and temperature have reached a steady state
+// when the benchmark starts. With -shared, this requires -cores or
+// -cpus, so it doesn't slow down other shared commands.
+//
+// With -env-out, perflock writes a JSON snapshot of the conditions
+// command runs under, such as the kernel version, CPU model, CPU
+// frequency settings, reserved cores, and load average, to a file or
+// to stdout before running command, so it can be archived with the
+// results.
+//
+// With -benchfmt, perflock prints its configuration as benchfmt
+// configuration lines, such as "cpu-governor: 90%" and "cores: 4", to
+// stdout before running command. When command is a Go benchmark, this
+// lets benchstat group results by perflock configuration.
+//
+// With -rusage, perflock prints command's resource usage after it
+// exits, including its CPU time, maximum RSS, context switches, and
+// page faults, to stderr as text or JSON. Unusually many involuntary
+// context switches or major page faults suggest that something
+// perturbed the run. Batch jobs always log their resource usage.
+//
+// With -perf-stat, perflock runs command under perf stat, counting
+// the given events, such as "cycles,instructions", while command runs
+// on the CPUs it was given. perflock prints the counts to stderr after
+// command exits and adds them to the -env-out snapshot, which it then
+// writes after command exits rather than before. Counting events of
+// another user's processes or in the kernel may require lowering
+// kernel.perf_event_paranoid.
+//
+// With -at, perflock reserves the exclusive lock for a window of time
+// starting at the given time, such as 02:00, and runs command then.
+// Until the window ends, the daemon doesn't grant the lock to commands
+// it expects to still be running when the window starts, based on how
+// long they ran before. The reservation lasts as long as perflock is
+// waiting or running command.
+//
+// perflock -submit command... submits command as a batch job, which
+// the daemon runs once it acquires the lock, so perflock doesn't need
+// to keep running while command waits. The job runs as the submitting
+// user, with the same working directory and environment, and its
+// output is written to a log file. perflock -jobs lists batch jobs,
+// perflock -logs ID prints a job's output, and perflock -cancel ID
+// cancels it.
+//
+// With -after ID, perflock waits for batch job ID to finish before
+// acquiring the lock, or with -submit, before queuing the job. With
+// -after-ok ID, it runs command only if job ID succeeded. This lets a
+// pipeline of jobs, such as a baseline measurement and then an
+// experiment, be submitted at once and run in order.
+//
+// With -deadline, such as -deadline 06:00, perflock gives up waiting
+// if it hasn't acquired the lock by the given time, and exits with
+// status 3 without running command. Unlike -kill-after, this limits
+// only the wait, not how long command runs.
+//
+// With -max-load N, perflock waits, once it has the exclusive lock,
+// until the 1-minute load average and the CPU usage of processes not
+// run by perflock drop below N CPUs before running command. The daemon
+// may also apply such a load gate to every exclusive command. If the
+// load doesn't drop before the daemon's timeout, perflock prints a
+// warning and runs command anyway.
+//
+// With -try, perflock runs command only if the lock is available
+// immediately. Otherwise, it exits with status 3, like -deadline. This
+// is useful for opportunistic benchmarks run from cron.
+//
+// perflock runs command with PERFLOCK=1 in its environment, along
+// with PERFLOCK_MODE, which is exclusive, shared, or monitor, and
+// PERFLOCK_CORES, which lists any reserved cores. If perflock finds
+// PERFLOCK set, it was run by a command that already holds the lock,
+// such as a wrapper script, so rather than wait for the lock forever,
+// it runs command directly under the enclosing lock. -reacquire makes
+// it acquire the lock anyway.
+//
+// perflock exits with command's exit status, or if command is killed
+// by a signal, 128 plus the signal number, like a shell. If perflock
+// fails rather than command, for example because it can't acquire the
+// lock, it exits with status 125, or the status given by
+// -error-status. If command can't be run, perflock exits with status
+// 126, or 127 if command doesn't exist.
+//
+// If the daemon limits how many commands may wait for the lock and
+// the queue is full, perflock exits with status 75 without running
+// command.
+//
+// perflock -list prints the commands holding and waiting for the lock,
+// followed by reservations, marking your own with "*". -user NAME,
+// -mine, and -exclusive-only restrict it to the commands of user NAME,
+// to your own commands, or to exclusive commands and reservations.
+// Commands holding reserved cores show which CPUs they hold, such as
+// [2 cores: 4-5], and a final line lists the reservable cores that
+// are free.
+//
+// perflock top shows the same queue live, along with a map of which
+// commands hold which cores and the current CPU frequencies and
+// temperatures, refreshing until interrupted. To run the top command
+// itself under the lock, use "perflock -- top", or give it arguments.
+//
+// While a command holds the lock, the daemon samples the frequency of
+// its CPUs and the package temperature. perflock -history prints the
+// minimum, average, and maximum of each for recently finished
+// commands, so a surprising result can be checked against thermal
+// throttling after the fact. Batch jobs also record them in their log.
+//
+// perflock -n command... prints what perflock would do to run command,
+// such as the cores it would reserve and the CPU frequency it would
+// set, without acquiring the lock or running command.
+//
 // For convenience, we recommend you create shell aliases for
 // perflock:
 //
@@ -28,86 +179,968 @@
 //     alias pls='perflock -shared'
 //
 // perflock depends on a locking daemon, which can be started with
-// perflock -daemon.
+// perflock -daemon. By default, the daemon listens on
+// /var/run/perflock.socket, or on $XDG_RUNTIME_DIR/perflock.socket if
+// it can't create that. The socket can also be set with -socket or
+// the PERFLOCK_SOCKET environment variable. The daemon logs to stderr,
+// syslog, or the systemd journal, as set in its configuration, and
+// administrators can change how much it logs with perflock -log-level,
+// such as -log-level debug to trace each connection. To debug
+// scheduling, perflock -dump prints the daemon's internal state, such
+// as the queue, the cores each command holds, and the saved CPU
+// frequency settings, as JSON. perflock -evict ID lets administrators
+// evict another user's command from the queue, or stop it and release
+// the lock it holds. perflock -pause stops the daemon from granting the
+// lock to waiting commands, for example during maintenance, until
+// perflock -resume, and perflock -reload makes it reread its
+// configuration.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"math"
 	"os"
 	"os/exec"
+	"os/signal"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
 )
 
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == helperArg {
+		doHelper()
+		return
+	}
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\n")
 		fmt.Fprintf(os.Stderr, "  %s [flags] command...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s [flags] ab -- commandA... -- commandB...\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -list\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s top\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -stat | -history\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -position id\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -submit [flags] command...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -jobs | -logs id | -cancel id\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -log-level level | -dump | -evict id\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -pause | -resume | -reload\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -daemon\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\n")
 		flag.PrintDefaults()
 	}
 	flagDaemon := flag.Bool("daemon", false, "start perflock daemon")
 	flagList := flag.Bool("list", false, "print current and pending commands")
-	flagSocket := flag.String("socket", "/var/run/perflock.socket", "connect to socket `path`")
+	flagUser := flag.String("user", "", "with -list, list only the commands of `user`")
+	flagMine := flag.Bool("mine", false, "with -list, list only your own commands")
+	flagExclusiveOnly := flag.Bool("exclusive-only", false, "with -list, list only exclusive commands and reservations")
+	flagStat := flag.Bool("stat", false, "print daemon statistics")
+	flagHistory := flag.Bool("history", false, "print recently finished commands with the CPU frequency and temperature\n\twhile they held the lock")
+	flagSubmit := flag.Bool("submit", false, "submit command as a batch job for the daemon to run once it acquires the lock;\n\tits output is written to a log file")
+	flagJobs := flag.Bool("jobs", false, "print batch jobs")
+	flagLogs := flag.Int("logs", 0, "print the output of batch job `id`")
+	flagCancel := flag.Int("cancel", 0, "cancel batch job `id`")
+	flagAfter := flag.Int("after", 0, "wait for batch job `id` to finish before acquiring the lock")
+	flagAfterOK := flag.Int("after-ok", 0, "like -after, but run command only if batch job `id` succeeds")
+	flagLogLevel := flag.String("log-level", "", "set the daemon's log level to `level` (debug, info, warn, or error)")
+	flagEvict := flag.Int("evict", 0, "evict the acquire with ID `id` from the queue, or stop its command and release\n\tthe lock it holds (administrators only)")
+	flagPause := flag.Bool("pause", false, "stop the daemon from granting the lock to waiting commands until -resume\n\t(administrators only)")
+	flagResume := flag.Bool("resume", false, "let the daemon grant the lock again after -pause (administrators only)")
+	flagReload := flag.Bool("reload", false, "make the daemon reread its configuration file (administrators only)")
+	flagDump := flag.Bool("dump", false, "print the daemon's internal scheduling state as JSON, for debugging")
+	flagPosition := flag.Int("position", 0, "print the queue position and request of the acquire with ID `id`")
+	flagSocket := flag.String("socket", "", "connect to socket `path` (default $PERFLOCK_SOCKET, or "+systemSocket+"\n\tor $XDG_RUNTIME_DIR/perflock.socket if that is unavailable)")
+	flagUnprivileged := flag.Bool("unprivileged", false, "with -daemon, run as a per-user daemon without modifying system settings")
+	flagDropPrivileges := flag.String("drop-privileges", "", "with -daemon, serve clients as `user`, using a separate\n\tprivileged helper process to change system settings")
+	flagConfig := flag.String("config", defaultConfig, "with -daemon, read configuration from `file`")
+	flagGRPC := flag.String("grpc", "", "with -daemon, also serve the gRPC API on `address`\n\t(unix:path, or a loopback host:port for queries only)")
 	flagShared := flag.Bool("shared", false, "acquire lock in shared mode (default: exclusive mode)")
+	flagMonitor := flag.Bool("monitor", false, "acquire lock in monitor mode, for observability agents: run command immediately\n\twithout waiting for or delaying other commands, but list it in -list")
+	flagCores := flag.String("cores", "", "reserve `n` cores, or a percentage such as \"50%\" of the cores perflock may run on,\n\tfor command and run it only on those cores")
+	flagCPUs := flag.String("cpus", "", "reserve the CPUs in `list` (for example, \"2-5,8\") for command\n\tand run it only on those CPUs")
+	flagMembind := flag.Bool("membind", false, "with -cores or -cpus, allocate command's memory only from the NUMA nodes\n\tof its CPUs")
+	flagHugePages := flag.Int("hugepages", 0, "add `n` huge pages to the pool while command runs, on the NUMA node of its\n\tcores if they're on one node, and fail if the kernel can't allocate them\n\t(requires an exclusive lock and the daemon's maxHugePages setting)")
+	flagMlock := flag.Bool("mlock", false, "keep command's memory, up to the daemon's maxLockedMemory setting, from being\n\treclaimed or swapped out while it runs (requires an exclusive lock and cgroup v2)")
+	flagNoSwap := flag.Bool("no-swap", false, "set vm.swappiness to 0 while command holds the exclusive lock")
+	flagMem := flag.String("mem", "", "with -shared, limit command's memory, including page cache, to `size`\n\t(for example, \"8G\"; requires cgroup v2)")
+	flagCPUMax := flag.String("cpu-max", "", "with -shared, limit command's CPU time to `percent` of one CPU\n\t(for example, \"200%\"; requires cgroup v2)")
+	flagMaxLoad := flag.Float64("max-load", 0, "wait until the load on the host not due to perflock drops below `n` CPUs before running\n\tcommand, or until the daemon's load gate times out (requires an exclusive lock)")
+	flagRusage := flag.String("rusage", "", "after command exits, print its resource usage, such as CPU time, max RSS,\n\tcontext switches, and page faults, to stderr as `format` \"text\" or \"json\"")
+	flagPerfStat := flag.String("perf-stat", "", "run command under perf stat, counting `events` (for example, \"cycles,instructions\")\n\ton its CPUs, and add the counts to the -env-out snapshot")
+	flagCount := flag.Int("count", 1, "run command `n` times, releasing the lock and waiting for it again between runs\n\tso other commands can run in between, and stop at the first failure")
+	flagTopology := flag.String("topology", "", "with -cores, reserve cores that all share an L3 cache (\"same-l3\")\n\tor a physical package (\"same-socket\")")
+	flagNotify := flag.String("notify", "", "run shell command `cmd` when the lock is acquired and when command finishes;\n\tit receives details in PERFLOCK_* environment variables")
+	flagKillAfter := flag.Duration("kill-after", 0, "terminate command if it runs longer than `duration` and exit with status 124")
+	flagGrace := flag.Duration("grace", 10*time.Second, "after forwarding a signal to command, wait `duration` for it to exit before killing it")
+	flagWarmup := flag.Duration("warmup", 0, "before running command, keep its CPUs busy for `duration` so their frequency\n\tand temperature settle")
+	flagEnvOut := flag.String("env-out", "", "before running command, write a JSON snapshot of the benchmark\n\tenvironment to `file` (\"-\" for stdout)")
+	flagBenchfmt := flag.Bool("benchfmt", false, "before running command, print the perflock configuration to stdout\n\tas benchfmt configuration lines, such as \"cpu-governor: 90%\"")
+	flagAt := flag.String("at", "", "reserve the exclusive lock starting at `time` (\"15:04\" or RFC 3339)\n\tand wait until then to run command")
+	flagWindow := flag.Duration("window", time.Hour, "with -at, reserve the lock for `duration`")
+	flagDeadline := flag.String("deadline", "", "give up and exit with status 3 if the lock isn't acquired by `time`\n\t(\"15:04\" or RFC 3339)")
+	flagTry := flag.Bool("try", false, "run command only if the lock is available immediately;\n\totherwise, exit with status 3")
+	flagStandalone := flag.Bool("standalone", false, "run without the daemon: lock "+localLockName+" and set the CPU governor\n\tand affinity in this process")
+	flagAutoStart := flag.Bool("autostart", false, "if the daemon isn't running, start it: a system-wide daemon if run as root,\n\tand otherwise a per-user daemon, as with -unprivileged")
+	flagFallback := flag.Bool("fallback", false, "if the daemon isn't running, lock "+localLockName+" instead, which\n\tprovides mutual exclusion but no core reservations or CPU governor control")
+	flagReacquire := flag.Bool("reacquire", false, "acquire the lock even if run by a command that holds it, as indicated by $PERFLOCK\n\t(by default, perflock runs command under that command's lock)")
+	flagErrorStatus := flag.Int("error-status", exitError, "exit with status `n` if perflock fails rather than command, for example\n\tif it can't acquire the lock")
+	flagDryRun := flag.Bool("n", false, "print what would be done to run command, without acquiring the lock or running it")
 	flagGovernor := &governorFlag{percent: 90}
 	flag.Var(flagGovernor, "governor", "set CPU frequency to `percent` between the min and max\n\twhile running command, or \"none\" for no adjustment")
 	flag.Parse()
 
+	if *flagAutoStart {
+		// Start the daemon where it would listen by default.
+		autoStartSocket = *flagSocket
+		if autoStartSocket == "" {
+			autoStartSocket = defaultSocket(true, os.Geteuid() != 0)
+		}
+	}
+	if *flagSocket == "" {
+		*flagSocket = defaultSocket(*flagDaemon, *flagUnprivileged)
+	}
+
 	if *flagDaemon {
 		if flag.NArg() > 0 {
 			flag.Usage()
 			os.Exit(2)
 		}
-		doDaemon(*flagSocket)
+		if !haveDaemon {
+			log.Fatalf("the perflock daemon isn't supported on %s", runtime.GOOS)
+		}
+		if *flagUnprivileged && *flagDropPrivileges != "" {
+			log.Fatal("-unprivileged and -drop-privileges are mutually exclusive")
+		}
+		cfg := daemonConfig{
+			Socket:         *flagSocket,
+			GRPC:           *flagGRPC,
+			Unprivileged:   *flagUnprivileged,
+			DropPrivileges: *flagDropPrivileges,
+			Path:           *flagConfig,
+		}
+		if err := readConfig(cfg.Path, cfg.Path == defaultConfig, &cfg); err != nil {
+			log.Fatal(err)
+		}
+		doDaemon(cfg)
 		return
 	}
 
 	log.SetFlags(0)
+	errorStatus = *flagErrorStatus
 
 	if *flagList {
 		if flag.NArg() > 0 {
 			flag.Usage()
 			os.Exit(2)
 		}
-		c := NewClient(*flagSocket)
-		list := c.List()
-		for _, l := range list {
-			fmt.Println(l)
+		c := dial(*flagSocket)
+		snap, err := c.Snapshot()
+		if err != nil {
+			fatal(err)
+		}
+		me := lookupUserName(uint32(os.Getuid()))
+		user := *flagUser
+		if *flagMine {
+			user = me
+		}
+		printList(snap.List, me, func(e ListEntry) bool {
+			return (user == "" || e.User == user) && !(*flagExclusiveOnly && e.Shared)
+		})
+		if snap.Reservable.Count() > 0 {
+			fmt.Println(freeCores(snap))
+		}
+		if snap.Paused {
+			fmt.Println("The queue is paused by an administrator.")
+		}
+		return
+	}
+
+	if *flagPosition != 0 {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		pos, err := c.Position(*flagPosition)
+		if err != nil {
+			fatal(err)
+		}
+		printPosition(pos)
+		return
+	}
+
+	if *flagJobs || *flagLogs != 0 || *flagCancel != 0 {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		if *flagJobs || *flagLogs != 0 {
+			jobs, err := c.Jobs()
+			if err != nil {
+				fatal(err)
+			}
+			if *flagJobs {
+				printJobs(jobs)
+			} else if err := printJobLog(jobs, *flagLogs); err != nil {
+				fatal(err)
+			}
+			return
+		}
+		if err := c.CancelJob(*flagCancel); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *flagLogLevel != "" {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		if err := c.SetLogLevel(*flagLogLevel); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *flagEvict != 0 {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		if err := c.Evict(*flagEvict); err != nil {
+			fatal(err)
 		}
 		return
 	}
 
+	if *flagPause || *flagResume || *flagReload {
+		if flag.NArg() > 0 || *flagPause && *flagResume {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		if *flagPause || *flagResume {
+			if err := c.Pause(*flagPause); err != nil {
+				fatal(err)
+			}
+		}
+		if *flagReload {
+			if err := c.Reload(); err != nil {
+				fatal(err)
+			}
+		}
+		return
+	}
+
+	if *flagDump {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		data, err := c.Dump()
+		if err != nil {
+			fatal(err)
+		}
+		os.Stdout.Write(append(data, '\n'))
+		return
+	}
+
+	if *flagStat {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		stat, err := c.Stat()
+		if err != nil {
+			fatal(err)
+		}
+		printStat(stat)
+		return
+	}
+
+	if *flagHistory {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		c := dial(*flagSocket)
+		hist, err := c.History()
+		if err != nil {
+			fatal(err)
+		}
+		printHistory(hist)
+		return
+	}
+
 	cmd := flag.Args()
 	if len(cmd) == 0 {
 		flag.Usage()
 		os.Exit(2)
 	}
-	c := NewClient(*flagSocket)
-	if !c.Acquire(*flagShared, true, shellEscapeList(cmd)) {
-		list := c.List()
-		fmt.Fprintf(os.Stderr, "Waiting for lock...\n")
-		for _, l := range list {
-			fmt.Fprintln(os.Stderr, l)
+	if isTop(os.Args, cmd) {
+		runTop(dial(*flagSocket))
+		return
+	}
+	switch *flagTopology {
+	case TopologyAny, TopologySameL3, TopologySameSocket:
+	default:
+		fatalf("-topology must be %q or %q", TopologySameL3, TopologySameSocket)
+	}
+	cores, coresPercent, err := parseCores(*flagCores)
+	if err != nil {
+		fatal("-cores: ", err)
+	}
+	var cpus cpuset.Set
+	if *flagCPUs != "" {
+		if *flagCores != "" || *flagTopology != TopologyAny {
+			fatal("-cpus cannot be combined with -cores or -topology")
+		}
+		var err error
+		cpus, err = cpuset.Parse(*flagCPUs)
+		if err != nil {
+			fatal("-cpus: ", err)
+		}
+	}
+	if *flagMembind {
+		if *flagCores == "" && *flagCPUs == "" {
+			fatal("-membind requires -cores or -cpus")
+		}
+		if *flagSubmit {
+			fatal("-membind cannot be combined with -submit")
+		}
+	}
+	switch *flagRusage {
+	case "", "text", "json":
+	default:
+		fatal("-rusage must be \"text\" or \"json\"")
+	}
+	if *flagCount < 1 {
+		fatal("-count must be at least 1")
+	}
+	ab, err := parseAB(cmd, *flagCount)
+	if err != nil {
+		fatal(err)
+	}
+	if ab != nil {
+		if *flagShared || *flagSubmit || *flagPerfStat != "" {
+			fatal("ab cannot be combined with -shared, -submit, or -perf-stat")
+		}
+	} else if *flagCount > 1 && (*flagSubmit || *flagAt != "") {
+		fatal("-count cannot be combined with -submit or -at")
+	}
+	if *flagPerfStat != "" && *flagSubmit {
+		fatal("-perf-stat cannot be combined with -submit")
+	}
+	if *flagRusage != "" && *flagSubmit {
+		fatal("-rusage cannot be combined with -submit; batch job logs include resource usage")
+	}
+	if *flagHugePages < 0 {
+		fatal("-hugepages must be non-negative")
+	}
+	var memMax int64
+	if *flagMem != "" {
+		if !*flagShared {
+			fatal("-mem requires -shared")
+		}
+		var err error
+		memMax, err = parseSize(*flagMem)
+		if err != nil {
+			fatal("-mem: ", err)
+		}
+	}
+	var cpuMax int
+	if *flagCPUMax != "" {
+		if !*flagShared {
+			fatal("-cpu-max requires -shared")
+		}
+		m := regexp.MustCompile(`^([0-9]+)%$`).FindStringSubmatch(*flagCPUMax)
+		if m != nil {
+			cpuMax, _ = strconv.Atoi(m[1])
+		}
+		if cpuMax <= 0 {
+			fatal("-cpu-max must be a positive percentage, such as \"200%\"")
+		}
+	}
+	if (*flagMlock || *flagNoSwap) && *flagShared {
+		fatal("-mlock and -no-swap require an exclusive lock")
+	}
+	if *flagHugePages > 0 && *flagShared {
+		fatal("-hugepages requires an exclusive lock")
+	}
+	if *flagWarmup < 0 {
+		fatal("-warmup must be positive")
+	}
+	if *flagWarmup > 0 && *flagShared && *flagCores == "" && *flagCPUs == "" {
+		// Warming up every CPU would slow down other commands.
+		fatal("-warmup with -shared requires -cores or -cpus")
+	}
+	if *flagMaxLoad < 0 {
+		fatal("-max-load must be positive")
+	}
+	if *flagMaxLoad > 0 && (*flagShared || *flagMonitor) {
+		fatal("-max-load requires an exclusive lock")
+	}
+	if *flagMonitor {
+		if *flagShared || *flagCores != "" || *flagCPUs != "" || *flagHugePages != 0 || *flagMlock || *flagNoSwap || *flagMem != "" || *flagCPUMax != "" {
+			fatal("-monitor cannot be combined with -shared, core or huge page reservations, or resource settings")
+		}
+		if *flagAt != "" || *flagSubmit || ab != nil || *flagEnvOut != "" || *flagBenchfmt || *flagWarmup != 0 {
+			fatal("-monitor cannot be combined with -at, -submit, ab, -env-out, -benchfmt, or -warmup")
+		}
+		// Monitors leave the CPU governor to the commands they
+		// observe.
+		flagGovernor.percent = -1
+	}
+	after, afterOK := *flagAfter, false
+	if *flagAfterOK != 0 {
+		if after != 0 {
+			fatal("-after and -after-ok cannot be combined")
+		}
+		after, afterOK = *flagAfterOK, true
+	}
+	var at time.Time
+	if *flagTry && (*flagAt != "" || *flagSubmit) {
+		fatal("-try cannot be combined with -at or -submit")
+	}
+	if *flagAt != "" {
+		if *flagShared {
+			fatal("-at requires an exclusive lock")
+		}
+		var err error
+		at, err = parseTime(*flagAt, time.Now())
+		if err != nil {
+			fatal("-at: ", err)
+		}
+	}
+	var deadline time.Time
+	var deadlineC <-chan time.Time
+	if *flagDeadline != "" {
+		if *flagSubmit {
+			fatal("-deadline cannot be combined with -submit")
+		}
+		var err error
+		deadline, err = parseTime(*flagDeadline, time.Now())
+		if err != nil {
+			fatal("-deadline: ", err)
+		}
+		if !at.IsZero() && !at.Before(deadline) {
+			fatal("-at must be before -deadline")
+		}
+		deadlineC = time.After(time.Until(deadline))
+	}
+	checkPlatformFlags(flagGovernor)
+	local := localRun{
+		cmd:        cmd,
+		shared:     *flagShared,
+		cores:      cores,
+		coresPct:   coresPercent,
+		cpus:       cpus,
+		try:        *flagTry,
+		deadline:   deadline,
+		notify:     *flagNotify,
+		envOut:     *flagEnvOut,
+		benchfmt:   *flagBenchfmt,
+		governor:   flagGovernor,
+		grace:      *flagGrace,
+		killAfter:  *flagKillAfter,
+		membind:    *flagMembind,
+		rusage:     *flagRusage,
+		warmup:     *flagWarmup,
+		ab:         ab,
+		perfStat:   *flagPerfStat,
+		standalone: *flagStandalone,
+	}
+	if nested() && !*flagReacquire && !*flagSubmit && !*flagDryRun && !*flagMonitor {
+		runNested(local)
+	}
+	if !haveDaemon || *flagStandalone {
+		runStandalone(local)
+	}
+	var c *Client
+	if *flagFallback {
+		var err error
+		c, err = connect(*flagSocket)
+		if err != nil {
+			log.Printf("warning: %v; falling back to lock file %s, without core reservations or CPU governor control", err, localLockName)
+			runStandalone(local)
+		}
+	} else {
+		c = dial(*flagSocket)
+	}
+	acquire := ActionAcquire{
+		Shared:       *flagShared,
+		NonBlocking:  true,
+		Msg:          shellEscapeList(cmd),
+		Cores:        cores,
+		CoresPercent: coresPercent,
+		Topology:     *flagTopology,
+		CPUs:         cpus,
+		HugePages:    *flagHugePages,
+		LockMemory:   *flagMlock,
+		NoSwap:       *flagNoSwap,
+		MemoryMax:    memMax,
+		CPUMax:       cpuMax,
+		Monitor:      *flagMonitor,
+		MaxLoad:      *flagMaxLoad,
+	}
+	if *flagDryRun {
+		dryRun(c, acquire, flagGovernor.percent, cmd)
+		return
+	}
+	if *flagSubmit {
+		governor := flagGovernor.percent
+		if *flagShared {
+			governor = -1
+		}
+		submit(c, ActionSubmit{Acquire: acquire, Governor: governor, Warmup: *flagWarmup, After: after, AfterOK: afterOK}, cmd)
+		return
+	}
+	if after != 0 {
+		fmt.Fprintf(os.Stderr, "Waiting for job %d...\n", after)
+		j, err := c.WaitJob(after)
+		if err != nil {
+			fatal(err)
+		}
+		if afterOK && j.State != JobDone {
+			fatalf("job %d %s; not running command", after, j.State)
 		}
-		c.Acquire(*flagShared, false, shellEscapeList(cmd))
 	}
 	if !*flagShared && flagGovernor.percent >= 0 {
-		c.SetGovernor(flagGovernor.percent)
+		// Check that the daemon can set the CPU governor before
+		// waiting for the lock.
+		power, err := c.QueryPower()
+		if err != nil {
+			fatal(err)
+		}
+		if power.Err != "" {
+			if flagGovernor.set {
+				fatalf("cannot set CPU governor: %s (use -governor none to run without it)", power.Err)
+			}
+			log.Printf("warning: not setting CPU governor: %s", power.Err)
+			flagGovernor.percent = -1
+		}
 	}
-	ignoreSignals()
-	run(cmd)
+	if !at.IsZero() {
+		// Reserve the lock, and wait for the reservation. The
+		// reservation lasts as long as our connection.
+		id, err := c.Reserve(ActionReserve{Start: at, Duration: *flagWindow, Msg: acquire.Msg})
+		if err != nil {
+			fatal("reserving lock: ", err)
+		}
+		fmt.Fprintf(os.Stderr, "Reserved lock from %s to %s\n", at.Format(time.Stamp), at.Add(*flagWindow).Format(time.Stamp))
+		time.Sleep(time.Until(at))
+		acquire.Reservation = id
+	}
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		// We waited for -after too long.
+		fmt.Fprintln(os.Stderr, "Deadline passed before acquiring the lock")
+		os.Exit(exitNotAcquired)
+	}
+	// With -count, origAffinity is this thread's affinity before an
+	// iteration restricted it.
+	var origAffinity *cpuset.Set
+	for i := 0; ; i++ {
+		start := time.Now()
+		resp, err := c.Acquire(acquire, printProgress)
+		if err != nil {
+			fatal(err)
+		}
+		if !resp.Acquired && *flagTry {
+			fmt.Fprintln(os.Stderr, "Lock is busy")
+			os.Exit(exitNotAcquired)
+		}
+		if !resp.Acquired {
+			list, err := c.List()
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "Waiting for lock...\n")
+			for _, l := range list {
+				fmt.Fprintln(os.Stderr, l)
+			}
+			acquire.NonBlocking = false
+			acquire.Progress = true
+			printedID := false
+			stopCancel := cancelOnSignal(c, deadlineC)
+			resp, err = c.Acquire(acquire, func(resp ActionAcquireResponse) {
+				if !printedID {
+					fmt.Fprintf(os.Stderr, "Acquire ID %d; use perflock -position %d to check on it\n", resp.ID, resp.ID)
+					printedID = true
+				}
+				printProgress(resp)
+			})
+			// If we acquired the lock anyway, exiting releases it.
+			if cancelled, expired := stopCancel(); expired {
+				fmt.Fprintln(os.Stderr, "Deadline passed before acquiring the lock")
+				os.Exit(exitNotAcquired)
+			} else if cancelled {
+				fmt.Fprintln(os.Stderr, "Cancelled")
+				os.Exit(exitCancelled)
+			}
+			if errors.Is(err, errQueueFull) {
+				log.Print(err)
+				os.Exit(exitQueueFull)
+			} else if err != nil {
+				fatal(err)
+			}
+		}
+		for _, w := range resp.Warnings {
+			log.Printf("warning: %s", w)
+		}
+		// Notify before restricting our affinity, so the notification
+		// doesn't run on the command's cores.
+		n := notifier{cmd: *flagNotify, command: shellEscapeList(cmd)}
+		n.acquired(time.Since(start))
+		if resp.Affinity.Count() > 0 {
+			// Restrict this thread, and hence the command we fork
+			// from it, to the cores the daemon gave us.
+			runtime.LockOSThread()
+			if origAffinity == nil {
+				if a, err := cpuset.GetAffinity(0); err == nil {
+					origAffinity = &a
+				}
+			}
+			if err := setAffinity(&resp.Affinity); err != nil {
+				fatal("setting CPU affinity: ", err)
+			}
+		} else if origAffinity != nil {
+			// An earlier iteration restricted this thread.
+			if err := setAffinity(origAffinity); err != nil {
+				fatal("setting CPU affinity: ", err)
+			}
+		}
+		if *flagMembind {
+			if err := membind(resp.Cores); err != nil {
+				fatal("binding memory to NUMA nodes: ", err)
+			}
+		}
+		governor := -1
+		if !*flagShared && flagGovernor.percent >= 0 {
+			if err := c.SetGovernor(flagGovernor.percent); err != nil {
+				log.Printf("warning: not setting CPU governor: %v", err)
+			} else {
+				governor = flagGovernor.percent
+			}
+		}
+		if *flagWarmup > 0 {
+			warmUp(resp.Affinity, *flagWarmup)
+		}
+		var env envSnapshot
+		if *flagEnvOut != "" || *flagBenchfmt {
+			env = readEnv(resp, *flagShared, governor)
+			// With -perf-stat, the snapshot is written after command
+			// runs, with the counters.
+			if *flagEnvOut != "" && *flagPerfStat == "" {
+				if err := writeEnv(*flagEnvOut, env); err != nil {
+					fatal("writing environment snapshot: ", err)
+				}
+			}
+			if *flagBenchfmt {
+				fmt.Print(env.benchfmt())
+			}
+		}
+		// Only command sees the marker, not -notify commands or
+		// a daemon started by a later iteration.
+		cmdEnv := withMarker(os.Environ(), lockMode(*flagShared, *flagMonitor), resp.Cores)
+		args := cmd
+		var perf *perfStat
+		if *flagPerfStat != "" {
+			perf = &perfStat{events: *flagPerfStat}
+			if args, err = perf.wrap(args, resp.Affinity); err != nil {
+				fatal("-perf-stat: ", err)
+			}
+		}
+		var status int
+		if ab != nil {
+			status = ab.run(cmdEnv, *flagGrace, *flagKillAfter, *flagRusage)
+		} else {
+			var usage *Usage
+			status, usage = run(args, cmdEnv, *flagGrace, *flagKillAfter)
+			if perf != nil {
+				perf.finish(&env, *flagEnvOut)
+			}
+			if *flagRusage != "" && usage != nil {
+				writeUsage(os.Stderr, *flagRusage, usage)
+			}
+		}
+		n.finished(status)
+		// ab runs all of its iterations under one acquisition.
+		if i == *flagCount-1 || ab != nil || status != 0 {
+			os.Exit(status)
+		}
+		// Release the lock and get back in line, so other commands
+		// can run between iterations.
+		c.Close()
+		c = dial(*flagSocket)
+		acquire.NonBlocking, acquire.Progress = true, false
+	}
+}
+
+// warmUp runs the -warmup loop for d on affinity, or on all the CPUs
+// perflock may run on if affinity is empty.
+func warmUp(affinity cpuset.Set, d time.Duration) {
+	cpus := affinity
+	if cpus.Count() == 0 {
+		var err error
+		if cpus, err = cpuset.GetAffinity(0); err != nil {
+			log.Printf("warning: not warming up: %v", err)
+			return
+		}
+	}
+	if err := warmup(&cpus, d); err != nil {
+		log.Printf("warning: warming up: %v", err)
+	}
+}
+
+// runStandalone runs r under the local lock without the daemon, and
+// exits.
+func runStandalone(r localRun) {
+	lock, err := newLocalLock()
+	if err != nil {
+		fatal(err)
+	}
+	runLocal(lock, r)
+}
+
+// dial connects to the daemon listening on socket, or exits if it
+// can't.
+func dial(socket string) *Client {
+	if !haveDaemon {
+		fatalf("this requires the perflock daemon, which isn't supported on %s", runtime.GOOS)
+	}
+	c, err := connect(socket)
+	if err != nil {
+		log.Print(err)
+		fatal("Is the perflock daemon running?")
+	}
+	return c
+}
+
+// autoStartSocket, if set by -autostart, is the socket connect starts
+// a daemon on if it can't connect to one.
+var autoStartSocket string
+
+// connect connects to the daemon listening on socket. If there is
+// none and -autostart is set, it starts one.
+func connect(socket string) (*Client, error) {
+	c, err := NewClient(socket)
+	if err != nil && autoStartSocket != "" {
+		c, err = startDaemon(autoStartSocket)
+	}
+	return c, err
+}
+
+// submit submits cmd as batch job a.
+func submit(c *Client, a ActionSubmit, cmd []string) {
+	// The daemon has its own PATH and working directory, so
+	// resolve them here.
+	path, err := exec.LookPath(cmd[0])
+	if err != nil {
+		log.Print(err)
+		os.Exit(exitNotFound)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fatal(err)
+	}
+	a.Acquire.NonBlocking = false
+	a.Args, a.Dir, a.Env = append([]string{path}, cmd[1:]...), dir, os.Environ()
+	resp, err := c.Submit(a)
+	if errors.Is(err, errQueueFull) {
+		log.Print(err)
+		os.Exit(exitQueueFull)
+	} else if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Submitted job %d; output in %s\n", resp.ID, resp.Log)
+}
+
+// printList prints the entries of list for which match returns true,
+// marking those of user me with "*".
+func printList(list []ListEntry, me string, match func(ListEntry) bool) {
+	for _, e := range list {
+		if !match(e) {
+			continue
+		}
+		mark := " "
+		if e.User == me {
+			mark = "*"
+		}
+		fmt.Printf("%s %s\n", mark, e)
+	}
+}
+
+// freeCores returns a summary of the reservable cores in snap that no
+// acquisition holds.
+func freeCores(snap ActionWatchResponse) string {
+	free := snap.Reservable
+	for _, e := range snap.List {
+		free = cpuset.Difference(&free, &e.Assigned)
+	}
+	list := cpuset.String(&free)
+	if list == "" {
+		list = "none"
+	}
+	return fmt.Sprintf("free cores: %s (%d of %d)", list, free.Count(), snap.Reservable.Count())
+}
+
+// printJobs prints a table of batch jobs.
+func printJobs(jobs []JobInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tSTATE\tUSER\tSUBMITTED\tCOMMAND\n")
+	for _, j := range jobs {
+		state := j.State
+		if j.State == JobDone || (j.State == JobFailed && j.Status >= 0) {
+			state = fmt.Sprintf("%s (%d)", j.State, j.Status)
+		} else if j.State == JobWaiting {
+			state = fmt.Sprintf("%s (%d)", j.State, j.After)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", j.ID, state, j.User, j.Submitted.Format(time.Stamp), j.Command)
+	}
+	w.Flush()
+}
+
+// printHistory prints finished acquisitions and their telemetry.
+func printHistory(hist []HistoryEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tUSER\tACQUIRED\tHELD\tGHZ MIN/AVG/MAX\t°C MIN/AVG/MAX\tCOMMAND\n")
+	for _, e := range hist {
+		freq, temp := "-", "-"
+		if e.Telemetry != nil {
+			freq, temp = e.Telemetry.Freq.format(2), e.Telemetry.Temp.format(1)
+		}
+		held := e.Released.Sub(e.Acquired).Round(time.Millisecond)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%s\t%s\t%s\n", e.ID, e.User, e.Acquired.Format(time.Stamp), held, freq, temp, e.Command)
+	}
+	w.Flush()
+}
+
+// printJobLog prints the output of job id.
+func printJobLog(jobs []JobInfo, id int) error {
+	for _, j := range jobs {
+		if j.ID != id {
+			continue
+		}
+		f, err := os.Open(j.Log)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(os.Stdout, f)
+		return err
+	}
+	return fmt.Errorf("no job %d", id)
+}
+
+// printPosition prints the state of an acquisition.
+func printPosition(pos ActionPositionResponse) {
+	fmt.Printf("command:     %s\n", pos.Msg)
+	if pos.Acquired {
+		fmt.Printf("position:    holding the lock\n")
+		return
+	}
+	fmt.Printf("position:    %d ahead\n", pos.Position)
+	if pos.ETA > 0 {
+		fmt.Printf("eta:         about %v\n", pos.ETA.Round(time.Second))
+	}
+	mode := "exclusive lock"
+	if pos.Shared {
+		mode = "shared lock"
+	}
+	switch {
+	case pos.CPUs.Count() > 0:
+		busy := cpuset.Difference(&pos.CPUs, &pos.Free)
+		fmt.Printf("waiting for: %s, CPUs %s", mode, cpuset.String(&pos.CPUs))
+		if busy.Count() > 0 {
+			fmt.Printf(" (%s busy)", cpuset.String(&busy))
+		}
+		fmt.Println()
+	case pos.Cores > 0:
+		fmt.Printf("waiting for: %s, %d cores", mode, pos.Cores)
+		if pos.Topology != TopologyAny {
+			fmt.Printf(" %s", pos.Topology)
+		}
+		fmt.Printf(" (%d free)\n", pos.Free.Count())
+	default:
+		fmt.Printf("waiting for: %s\n", mode)
+	}
+}
+
+// printStat prints daemon statistics.
+func printStat(st ActionStatResponse) {
+	durations := func(d DurationStats) string {
+		if d.N == 0 {
+			return "none"
+		}
+		r := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+		return fmt.Sprintf("mean %v, p50 %v, p90 %v, p99 %v (last %d)", r(d.Mean), r(d.P50), r(d.P90), r(d.P99), d.N)
+	}
+	fmt.Printf("uptime:          %v\n", st.Uptime.Round(time.Second))
+	fmt.Printf("acquisitions:    %d\n", st.Acquisitions)
+	fmt.Printf("queue:           %d holding, %d waiting\n", st.Held, st.Waiting)
+	fmt.Printf("wait time:       %s\n", durations(st.Wait))
+	fmt.Printf("hold time:       %s\n", durations(st.Hold))
+	fmt.Printf("governor errors: %d\n", st.GovernorErrors)
+}
+
+// printProgress prints a progress update for a waiting acquire.
+func printProgress(resp ActionAcquireResponse) {
+	if resp.LoadGate > 0 {
+		fmt.Fprintf(os.Stderr, "Waiting for the load to drop below %g CPUs\n", resp.LoadGate)
+		return
+	}
+	msg := fmt.Sprintf("Waiting for lock: %d ahead", resp.Position)
+	if resp.ETA > 0 {
+		msg += fmt.Sprintf(", about %v to go", resp.ETA.Round(time.Second))
+	}
+	fmt.Fprintln(os.Stderr, msg)
+}
+
+// setAffinity restricts the calling thread to the CPUs in set and
+// checks that it got all of them. The kernel silently drops CPUs the
+// thread isn't allowed to run on, for example because of its cpuset
+// cgroup, and CPUs may go offline concurrently, so this retries a few
+// times before giving up.
+func setAffinity(set *cpuset.Set) error {
+	var got cpuset.Set
+	for try := 0; try < 3; try++ {
+		if err := cpuset.SetAffinity(0, set); err != nil {
+			return err
+		}
+		var err error
+		got, err = cpuset.GetAffinity(0)
+		if err != nil {
+			return err
+		}
+		if cpuset.Equal(&got, set) {
+			return nil
+		}
+	}
+	missing := cpuset.Difference(set, &got)
+	return fmt.Errorf("wanted CPUs %s, but the kernel only granted %s (missing %s); is this process confined by a cpuset cgroup?", cpuset.String(set), cpuset.String(&got), cpuset.String(&missing))
 }
 
 type governorFlag struct {
 	percent int
+	set     bool // set explicitly on the command line
 }
 
 func (f *governorFlag) String() string {
@@ -118,6 +1151,7 @@ func (f *governorFlag) String() string {
 }
 
 func (f *governorFlag) Set(v string) error {
+	f.set = true
 	if v == "none" {
 		f.percent = -1
 	} else {
@@ -130,24 +1164,158 @@ func (f *governorFlag) Set(v string) error {
 	return nil
 }
 
-// run executes args as a command and exits with the command's exit
-// status.
-func run(args []string) {
+// parseTime parses s as a wall-clock time, either "15:04" for the next
+// time it is that time of day after now, or an RFC 3339 time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time must be HH:MM or RFC 3339, such as 2006-01-02T15:04:05Z")
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseCores parses s as a number of cores or a percentage of cores,
+// such as "50%". It returns 0, 0 if s is empty.
+func parseCores(s string) (n, percent int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err = strconv.Atoi(p)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, 0, fmt.Errorf("percentage must be between 1%% and 100%%")
+		}
+		return 0, percent, nil
+	}
+	n, err = strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("must be a number of cores or a percentage, such as \"50%%\"")
+	}
+	return n, 0, nil
+}
+
+// parseSize parses s as a positive number of bytes, optionally
+// followed by K, M, G, or T for a power-of-1024 multiple.
+func parseSize(s string) (int64, error) {
+	m := regexp.MustCompile(`^([0-9]+)([KMGT]?)B?$`).FindStringSubmatch(strings.ToUpper(s))
+	if m == nil {
+		return 0, fmt.Errorf("size must be a number of bytes, optionally followed by K, M, G, or T")
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	shift := map[string]uint{"": 0, "K": 10, "M": 20, "G": 30, "T": 40}[m[2]]
+	if err != nil || n <= 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+// exitCancelled is the exit status if waiting for the lock is
+// cancelled by a signal such as Ctrl-C. This is what a shell reports
+// for a command killed by SIGINT.
+const exitCancelled = 130
+
+// exitError is the default exit status if perflock fails rather than
+// command, for example because it can't connect to the daemon or
+// acquire the lock. exitCannotExec and exitNotFound are the exit
+// statuses if command can't be run or doesn't exist. These follow
+// env(1) and timeout(1).
+const (
+	exitError      = 125
+	exitCannotExec = 126
+	exitNotFound   = 127
+)
+
+// errorStatus is the exit status if perflock fails, set by
+// -error-status.
+var errorStatus = exitError
+
+// fatal is like log.Fatal, but exits with errorStatus.
+func fatal(v ...interface{}) {
+	log.Print(v...)
+	os.Exit(errorStatus)
+}
+
+// fatalf is like log.Fatalf, but exits with errorStatus.
+func fatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(errorStatus)
+}
+
+// exitNotAcquired is the exit status if the lock isn't acquired by the
+// -deadline time, or immediately with -try, so scripts can tell that
+// command was skipped because the machine was busy rather than that it
+// failed.
+const exitNotAcquired = 3
+
+// exitQueueFull is the exit status if the daemon refuses to queue
+// command because too many commands are already waiting. This is
+// EX_TEMPFAIL from sysexits.h, since trying again later may succeed.
+const exitQueueFull = 75
+
+// run executes args as a command with environment env, or perflock's
+// own if env is nil, and returns its exit status. Signals sent to
+// perflock are forwarded to the command, and it is killed if it is
+// still running grace after the first signal. If killAfter is non-zero
+// and the command runs longer than that, it is terminated and run
+// returns 124, like timeout(1). run also returns the command's resource
+// usage, or nil if it didn't start.
+func run(args, env []string, grace, killAfter time.Duration) (int, *Usage) {
 	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
 	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	err := cmd.Run()
+	restore := setProcessGroup(cmd)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	// -count and ab call run repeatedly.
+	defer signal.Stop(sigs)
+	if err := cmd.Start(); err != nil {
+		log.Print(err)
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return exitNotFound, nil
+		}
+		return exitCannotExec, nil
+	}
+	var timeout <-chan time.Time
+	if killAfter > 0 {
+		timeout = time.After(killAfter)
+	}
+	done, timedOut := make(chan struct{}), make(chan bool)
+	go func() {
+		timedOut <- forwardSignals(cmd.Process.Pid, sigs, grace, timeout, done)
+	}()
+	err := cmd.Wait()
+	close(done)
+	restore()
+	var usage *Usage
+	if cmd.ProcessState != nil {
+		usage = processUsage(cmd.ProcessState)
+	}
+	if <-timedOut {
+		log.Printf("command exceeded -kill-after %v", killAfter)
+		return 124, usage
+	}
 	switch err := err.(type) {
 	case nil:
-		os.Exit(0)
+		return 0, usage
 	case *exec.ExitError:
 		status := err.Sys().(syscall.WaitStatus)
 		if status.Exited() {
-			os.Exit(status.ExitStatus())
+			return status.ExitStatus(), usage
+		}
+		if status.Signaled() {
+			// Report this like a shell would.
+			return 128 + int(status.Signal()), usage
 		}
-		log.Fatal(err)
-	default:
-		log.Fatal(err)
 	}
+	log.Print(err)
+	return errorStatus, usage
 }
 
 // shellEscape escapes a single shell token.
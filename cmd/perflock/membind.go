@@ -0,0 +1,54 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/cputopology"
+)
+
+// membind restricts the memory allocations of the calling thread, and
+// hence of the command forked from it, to the NUMA nodes of cpus.
+func membind(cpus cpuset.Set) error {
+	nodes, err := cpuNodes(cpus)
+	if err != nil {
+		return err
+	}
+	return setMemBind(nodes)
+}
+
+// cpuNodes returns the NUMA nodes of cpus in ascending order.
+func cpuNodes(cpus cpuset.Set) ([]int, error) {
+	topo, err := cputopology.Read()
+	if err != nil {
+		return nil, err
+	}
+	return topoNodes(topo, cpus)
+}
+
+func topoNodes(topo *cputopology.Topology, cpus cpuset.Set) ([]int, error) {
+	seen := make(map[int]bool)
+	var nodes []int
+	for _, cpu := range topo.CPUs {
+		if !cpus.IsSet(cpu.ID) {
+			continue
+		}
+		if cpu.Node < 0 {
+			return nil, fmt.Errorf("NUMA node of CPU %d is unknown", cpu.ID)
+		}
+		if !seen[cpu.Node] {
+			seen[cpu.Node] = true
+			nodes = append(nodes, cpu.Node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no online CPUs in %s", cpuset.String(&cpus))
+	}
+	sort.Ints(nodes)
+	return nodes, nil
+}
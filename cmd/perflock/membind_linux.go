@@ -0,0 +1,30 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// setMemBind sets the memory policy of the calling thread to allocate
+// only from nodes. Children inherit the policy across fork and exec.
+func setMemBind(nodes []int) error {
+	var mask []uint64
+	for _, n := range nodes {
+		for n/64 >= len(mask) {
+			mask = append(mask, 0)
+		}
+		mask[n/64] |= 1 << (n % 64)
+	}
+	// The kernel reads maxnode-1 bits.
+	maxnode := len(mask)*64 + 1
+	_, _, errno := unix.RawSyscall(unix.SYS_SET_MEMPOLICY, unix.MPOL_BIND, uintptr(unsafe.Pointer(&mask[0])), uintptr(maxnode))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/cputopology"
+)
+
+func TestTopoNodes(t *testing.T) {
+	topo := &cputopology.Topology{CPUs: []cputopology.CPU{
+		{ID: 0, Node: 0}, {ID: 1, Node: 1}, {ID: 2, Node: 0}, {ID: 3, Node: 1}, {ID: 4, Node: -1},
+	}}
+	for _, test := range []struct {
+		cpus string
+		want []int
+	}{
+		{"0,2", []int{0}},
+		{"1-3", []int{0, 1}},
+		{"3", []int{1}},
+		{"4", nil},
+		{"5", nil},
+	} {
+		cpus, _ := cpuset.Parse(test.cpus)
+		got, err := topoNodes(topo, cpus)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("topoNodes(%s) = %v, want error", test.cpus, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("topoNodes(%s) = %v, %v, want %v", test.cpus, got, err, test.want)
+		}
+	}
+}
+
+func TestSetMemBind(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memory policies are Linux-only")
+	}
+	errc := make(chan error)
+	go func() {
+		// Leave the thread locked, so it exits with the
+		// goroutine rather than running other tests with this
+		// policy.
+		runtime.LockOSThread()
+		errc <- setMemBind([]int{0})
+	}()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// perflock tells the commands it runs that they hold the lock through
+// these environment variables, so that a wrapper script that itself
+// calls perflock doesn't wait for a lock its own caller holds.
+const (
+	// envMarker is set to "1".
+	envMarker = "PERFLOCK"
+
+	// envMode is "exclusive", "shared", or "monitor".
+	envMode = "PERFLOCK_MODE"
+
+	// envCores lists the reserved cores, such as "2-5", if any.
+	envCores = "PERFLOCK_CORES"
+)
+
+// lockMode returns the envMode value of an acquisition.
+func lockMode(shared, monitor bool) string {
+	switch {
+	case monitor:
+		return "monitor"
+	case shared:
+		return "shared"
+	}
+	return "exclusive"
+}
+
+// withMarker returns env with the variables for a lock held in mode on
+// cores, replacing any that are already set.
+func withMarker(env []string, mode string, cores cpuset.Set) []string {
+	env = slices.DeleteFunc(slices.Clone(env), func(kv string) bool {
+		k, _, _ := strings.Cut(kv, "=")
+		return k == envMarker || k == envMode || k == envCores
+	})
+	env = append(env, envMarker+"=1", envMode+"="+mode)
+	if cores.Count() > 0 {
+		env = append(env, envCores+"="+cpuset.String(&cores))
+	}
+	return env
+}
+
+// nested reports whether perflock was run by a command that holds the
+// lock.
+func nested() bool {
+	return os.Getenv(envMarker) != ""
+}
+
+// nestedLock is the lock held by the perflock that ran this one.
+// Acquiring the lock again could wait forever for that perflock, which
+// is waiting for us, so locking it always succeeds immediately.
+type nestedLock struct{}
+
+func (nestedLock) Lock(shared bool, deadline time.Time) (bool, error) {
+	return true, nil
+}
+
+// runNested runs r under the lock of the perflock that ran this one,
+// and exits.
+func runNested(r localRun) {
+	if !r.shared && os.Getenv(envMode) != "exclusive" {
+		log.Printf("warning: running under the %s lock of the enclosing perflock (use -reacquire to wait for an exclusive lock)", os.Getenv(envMode))
+	}
+	r.nested = true
+	runLocal(nestedLock{}, r)
+}
@@ -0,0 +1,27 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+func TestWithMarker(t *testing.T) {
+	cores, _ := cpuset.Parse("2-3")
+	env := []string{"HOME=/root", "PERFLOCK=1", "PERFLOCK_MODE=exclusive", "PERFLOCK_CORES=0-1"}
+	got := withMarker(env, "shared", cores)
+	want := []string{"HOME=/root", "PERFLOCK=1", "PERFLOCK_MODE=shared", "PERFLOCK_CORES=2-3"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got = withMarker(env, "exclusive", cpuset.Set{})
+	want = []string{"HOME=/root", "PERFLOCK=1", "PERFLOCK_MODE=exclusive"}
+	if !slices.Equal(got, want) {
+		t.Errorf("without cores: got %q, want %q", got, want)
+	}
+}
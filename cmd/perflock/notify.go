@@ -0,0 +1,125 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// notifier runs the -notify command when the lock is acquired and
+// when the command finishes.
+type notifier struct {
+	// cmd is the shell command to run, or "" to do nothing.
+	cmd string
+
+	// command is the command perflock is running.
+	command string
+
+	start time.Time
+}
+
+// acquired notifies that the lock was acquired after waiting for
+// waited. This doesn't wait for the notification command to finish.
+func (n *notifier) acquired(waited time.Duration) {
+	n.start = time.Now()
+	if n.cmd == "" {
+		return
+	}
+	cmd := n.notifyCommand("acquired", fmt.Sprintf("PERFLOCK_WAITED=%d", int(waited.Seconds())))
+	if err := cmd.Start(); err != nil {
+		log.Printf("warning: running -notify command: %v", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// finished notifies that the command finished with the given exit
+// status, and waits for the notification command to finish.
+func (n *notifier) finished(status int) {
+	if n.cmd == "" {
+		return
+	}
+	cmd := n.notifyCommand("finished",
+		fmt.Sprintf("PERFLOCK_STATUS=%d", status),
+		fmt.Sprintf("PERFLOCK_ELAPSED=%d", int(time.Since(n.start).Seconds())))
+	if err := cmd.Run(); err != nil {
+		log.Printf("warning: running -notify command: %v", err)
+	}
+}
+
+// notifyCommand returns the notification command for event, with the
+// additional environment variables env.
+func (n *notifier) notifyCommand(event string, env ...string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", n.cmd)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Env = append(os.Environ(), "PERFLOCK_EVENT="+event, "PERFLOCK_COMMAND="+n.command)
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
+}
+
+// webhookEvent is the JSON body the daemon posts to the configured
+// webhook.
+type webhookEvent struct {
+	// Event is "acquired" or "released".
+	Event   string    `json:"event"`
+	User    string    `json:"user"`
+	Command string    `json:"command"`
+	Shared  bool      `json:"shared"`
+	Time    time.Time `json:"time"`
+}
+
+var (
+	// webhookClient is the HTTP client used to post webhook events.
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+	// webhookQueue holds encoded events waiting to be posted. A
+	// single goroutine posts them so they arrive in order.
+	webhookQueue = make(chan []byte, 100)
+	webhookOnce  sync.Once
+)
+
+// postWebhook posts ev to the configured webhook, if any, in the
+// background.
+func postWebhook(ev webhookEvent) {
+	url := theConfig.Webhook
+	if url == "" {
+		return
+	}
+	ev.Time = time.Now()
+	body, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("encoding webhook event", "err", err)
+		return
+	}
+	webhookOnce.Do(func() {
+		go func() {
+			for body := range webhookQueue {
+				resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+				if err != nil {
+					slog.Warn("posting webhook", "err", err)
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode/100 != 2 {
+					slog.Warn("posting webhook", "status", resp.Status)
+				}
+			}
+		}()
+	})
+	select {
+	case webhookQueue <- body:
+	default:
+		slog.Warn("webhook queue full; dropping event", "event", ev.Event)
+	}
+}
@@ -2,18 +2,32 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/aclements/perflock/perflockpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -40,6 +54,9 @@ const (
 func TestMain(m *testing.M) {
 	switch os.Getenv("GO_TEST_MODE") {
 	case "": // Run tests (top-level).
+		// The tests may themselves be run under perflock, but
+		// the perflocks they start must not think they're nested.
+		os.Unsetenv(envMarker)
 		os.Exit(m.Run())
 
 	case "perflock": // Act like a perflock.
@@ -60,6 +77,8 @@ func TestMain(m *testing.M) {
 		switch pmode := os.Getenv("GO_TEST_PROGRAM_MODE"); pmode {
 		case "sleeper":
 			sleeper()
+		case "stubborn":
+			stubborn()
 		default:
 			log.Fatalf("unknown program mode %q", pmode)
 		}
@@ -138,6 +157,1032 @@ func TestShared(t *testing.T) {
 	}
 }
 
+func TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+
+	// 1. Start a daemon that only permits shared acquires.
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"policy": {"exclusive": [], "shared": ["*"]}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// 2. An exclusive sleeper must be refused, but a shared one may run.
+	if err := mustStartSleeper(t, socket).Wait(); err == nil {
+		t.Errorf("exclusive acquire succeeded; want it refused by the policy")
+	}
+	if err := mustStartSleeper(t, socket, "-shared").Wait(); err != nil {
+		t.Errorf("shared acquire failed: %v", err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+
+	// 1. Start a daemon that posts to a webhook.
+	events := make(chan webhookEvent, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decoding webhook event: %v", err)
+		}
+		events <- ev
+	}))
+	defer srv.Close()
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"webhook": "`+srv.URL+`"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// 2. Run a sleeper with a -notify command that logs the events.
+	log := filepath.Join(t.TempDir(), "notify.log")
+	notify := `echo $PERFLOCK_EVENT $PERFLOCK_STATUS >> ` + log
+	if err := mustStartSleeper(t, socket, "-notify="+notify).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "acquired\nfinished 0\n"; got != want {
+		t.Errorf("-notify got events %q, want %q", got, want)
+	}
+
+	// 3. Check the webhook events.
+	for _, want := range []string{"acquired", "released"} {
+		select {
+		case ev := <-events:
+			if ev.Event != want {
+				t.Errorf("got webhook event %q, want %q", ev.Event, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for webhook event %q", want)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+
+	// 1. Start a daemon with hooks that log when they run.
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	cfg, err := json.Marshal(map[string]any{"hooks": hooks{
+		Acquire: "echo acquire >> " + log,
+		Release: "echo release >> " + log,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, cfg, 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// 2. Shared acquires don't run the hooks, but exclusive ones do.
+	if err := mustStartSleeper(t, socket, "-shared").Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mustStartSleeper(t, socket).Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3. The daemon runs the release hook after the client exits.
+	want := "acquire\nrelease\n"
+	var got string
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, _ := os.ReadFile(log)
+		if got = string(data); got == want {
+			return
+		}
+	}
+	t.Errorf("hooks ran %q, want %q", got, want)
+}
+
+func TestEnvOut(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	out := filepath.Join(t.TempDir(), "env.json")
+	if err := mustStartSleeper(t, socket, "-shared", "-env-out="+out).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env envSnapshot
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	if !env.Shared || env.Governor != -1 || env.NumCPU == 0 || env.Kernel == "" {
+		t.Errorf("unexpected environment snapshot: %s", data)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("requires abstract UNIX domain sockets")
+	}
+	socket := socketName(t)
+	grpcSocket := socket + ".grpc"
+
+	// 1. Start a daemon serving gRPC.
+	mustStartDaemon(t, socket, "-grpc=unix:"+grpcSocket)
+	conn, err := grpc.NewClient("unix-abstract:"+grpcSocket[1:], grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := perflockpb.NewPerfLockClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 2. Acquire the lock.
+	lock := func(msg string) perflockpb.PerfLock_LockClient {
+		stream, err := client.Lock(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(&perflockpb.LockRequest{Action: &perflockpb.LockRequest_Acquire{Acquire: &perflockpb.Acquire{Msg: msg}}}); err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+	recv := func(stream perflockpb.PerfLock_LockClient) *perflockpb.LockResponse {
+		t.Helper()
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	first := lock("first")
+	if got := recv(first); got.GetQueued().GetPosition() != 0 {
+		t.Fatalf("first acquire: want position 0, got %v", got)
+	}
+	if got := recv(first); got.GetAcquired() == nil {
+		t.Fatalf("first acquire: want acquired, got %v", got)
+	}
+
+	// 3. A second acquire must wait behind the first.
+	second := lock("second")
+	if got := recv(second); got.GetQueued().GetPosition() != 1 {
+		t.Fatalf("second acquire: want position 1, got %v", got)
+	}
+	list, err := client.List(ctx, &perflockpb.ListRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 2 {
+		t.Errorf("want 2 list entries, got %q", list.Entries)
+	}
+
+	// 4. Releasing the first lock passes it on to the second.
+	first.CloseSend()
+	if got := recv(second); got.GetQueued().GetPosition() != 0 {
+		t.Fatalf("second acquire: want position 0, got %v", got)
+	}
+	if got := recv(second); got.GetAcquired() == nil {
+		t.Fatalf("second acquire: want acquired, got %v", got)
+	}
+
+	// 5. A malformed acquire is an invalid argument.
+	bad, err := client.Lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bad.Send(&perflockpb.LockRequest{Action: &perflockpb.LockRequest_Acquire{Acquire: &perflockpb.Acquire{Topology: "bogus"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bad.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("malformed acquire: got %v, want InvalidArgument", err)
+	}
+
+	// 6. So is one that sets memory options a shared lock can't use.
+	bad, err = client.Lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bad.Send(&perflockpb.LockRequest{Action: &perflockpb.LockRequest_Acquire{Acquire: &perflockpb.Acquire{Shared: true, LockMemory: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bad.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("shared acquire with lock_memory: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCTCP(t *testing.T) {
+	// TCP clients are unauthenticated, so the daemon only listens
+	// on loopback addresses.
+	for _, addr := range []string{"0.0.0.0:0", ":0", "[::]:0", "192.0.2.1:0"} {
+		if l, _, err := listenGRPC(addr); err == nil {
+			l.Close()
+			t.Errorf("listenGRPC(%q) succeeded, want error", addr)
+		}
+	}
+	l, _, err := listenGRPC("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// And it refuses to let them acquire the lock.
+	srv := newGRPCServer(insecure.NewCredentials())
+	go srv.Serve(l)
+	defer srv.Stop()
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := perflockpb.NewPerfLockClient(conn).Lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("acquire over TCP: got %v, want PermissionDenied", err)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// Start a command that ignores SIGTERM and give it time to
+	// acquire the lock.
+	cmd, err := startProcess(t, []string{"-socket=" + socket, "-grace=200ms", os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=stubborn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(sleepDuration)
+
+	// perflock should forward SIGTERM, then kill the command after
+	// the grace period and exit.
+	start := time.Now()
+	cmd.Process.Signal(syscall.SIGTERM)
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("perflock did not exit after SIGTERM")
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("perflock exited after %v, before the grace period", d)
+	}
+
+	// The lock should be free again.
+	next := mustStartSleeper(t, socket)
+	done := make(chan error)
+	go func() { done <- next.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lock not released after command was killed")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// 1. Hold the lock and start a second command waiting for it.
+	if _, err := startProcess(t, []string{"-socket=" + socket, os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=stubborn"}); err != nil {
+		t.Fatal(err)
+	}
+	c := mustClient(t, socket)
+	for len(mustList(t, c)) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waiter := mustStartSleeper(t, socket)
+	for len(mustList(t, c)) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 2. Interrupting the waiter cancels its acquire right away,
+	// with a distinct exit status.
+	waiter.Process.Signal(os.Interrupt)
+	err := waiter.Wait()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != exitCancelled {
+		t.Errorf("waiter exited with %v, want status %d", err, exitCancelled)
+	}
+	if list := mustList(t, c); len(list) != 1 {
+		t.Errorf("after cancelling, queue is %q, want only the holder", list)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// 1. Hold the lock and start a second command waiting for it.
+	holder, err := startProcess(t, []string{"-socket=" + socket, "-governor=none", "/bin/sleep", "60"}, []string{"GO_TEST_MODE=perflock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := mustClient(t, socket)
+	for len(mustList(t, c)) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waiter := mustStartSleeper(t, socket)
+	var list []ListEntry
+	for len(list) < 2 {
+		time.Sleep(10 * time.Millisecond)
+		list = mustList(t, c)
+	}
+
+	// 2. Evicting the waiter refuses its acquire.
+	if err := c.Evict(list[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := waiter.Wait(); err == nil {
+		t.Errorf("evicted waiter succeeded; want it refused")
+	}
+
+	// 3. Evicting the holder stops its command and releases the
+	// lock.
+	if err := c.Evict(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- holder.Wait() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("evicted holder succeeded; want it terminated")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("evicted holder still running")
+	}
+	for deadline := time.Now().Add(10 * time.Second); len(mustList(t, c)) != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("after evicting, queue is %q, want it empty", mustList(t, c))
+		}
+	}
+
+	// 4. There's nothing left to evict.
+	if err := c.Evict(list[0].ID); err == nil {
+		t.Errorf("evicting a released acquire succeeded; want an error")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	daemon, err := startProcess(t, []string{"-socket=" + socket, "-daemon"}, []string{"GO_TEST_MODE=perflock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if !waitForDaemon(t, ctx, socket) {
+		t.Fatalf("gave up waiting for daemon")
+	}
+
+	// 1. Hold the lock and start a second command waiting for it.
+	if _, err := startProcess(t, []string{"-socket=" + socket, os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=stubborn"}); err != nil {
+		t.Fatal(err)
+	}
+	c := mustClient(t, socket)
+	for len(mustList(t, c)) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waiter := mustStartSleeper(t, socket)
+	for len(mustList(t, c)) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Close()
+
+	// 2. On SIGTERM, the daemon refuses the waiter and exits
+	// cleanly.
+	daemon.Process.Signal(syscall.SIGTERM)
+	err = waiter.Wait()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != exitError {
+		t.Errorf("waiter exited with %v, want status %d", err, exitError)
+	}
+	if err := daemon.Wait(); err != nil {
+		t.Errorf("daemon exited with %v, want success", err)
+	}
+}
+
+func TestAutoStart(t *testing.T) {
+	t.Parallel()
+
+	// The daemon needs a socket file for its startup lock.
+	socket := filepath.Join(t.TempDir(), "perflock.socket")
+
+	// 1. Start two clients at once. Exactly one starts the daemon,
+	// and both run.
+	outs := make(chan string, 2)
+	for range 2 {
+		go func() {
+			// Not a sleeper, since the daemon inherits the
+			// client's environment.
+			cmd := exec.Command(os.Args[0], "-socket="+socket, "-autostart", "-governor=none", "sleep", "0.1")
+			cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Errorf("client failed: %v\n%s", err, out)
+			}
+			outs <- string(out)
+		}()
+	}
+	var pids []int
+	for range 2 {
+		for _, line := range strings.Split(<-outs, "\n") {
+			var pid int
+			if _, err := fmt.Sscanf(line, "Started perflock daemon (pid %d)", &pid); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+	}
+	for _, pid := range pids {
+		t.Cleanup(func() {
+			if p, err := os.FindProcess(pid); err == nil {
+				p.Signal(syscall.SIGTERM)
+			}
+		})
+	}
+	if len(pids) != 1 {
+		t.Fatalf("clients started %d daemons, want 1", len(pids))
+	}
+
+	// 2. The daemon keeps running after its clients exit.
+	if l := mustList(t, mustClient(t, socket)); len(l) != 0 {
+		t.Errorf("daemon lists %d commands, want 0", len(l))
+	}
+}
+
+func TestStandalone(t *testing.T) {
+	t.Parallel()
+
+	// Standalone sleepers exclude each other without a daemon.
+	start := time.Now()
+	var sleepers [2]*exec.Cmd
+	for i := range sleepers {
+		cmd, err := startProcess(t, []string{"-standalone", "-governor=none", os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=sleeper"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sleepers[i] = cmd
+	}
+	for _, sleeper := range sleepers {
+		if err := sleeper.Wait(); err != nil {
+			t.Fatalf("sleeper failed: %v", err)
+		}
+	}
+	if got, want := time.Since(start), time.Duration(len(sleepers))*sleepDuration; got < want {
+		t.Errorf("expected %d sleepers each sleeping %v to run sequentially, but time passed is %v",
+			len(sleepers), sleepDuration, got)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// 1. Hold the lock.
+	if _, err := startProcess(t, []string{"-socket=" + socket, os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=stubborn"}); err != nil {
+		t.Fatal(err)
+	}
+	c := mustClient(t, socket)
+	for len(mustList(t, c)) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 2. A command with a deadline gives up waiting at the
+	// deadline, with a distinct exit status.
+	deadline := time.Now().Add(500 * time.Millisecond)
+	err := mustStartSleeper(t, socket, "-deadline="+deadline.Format(time.RFC3339Nano)).Wait()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != exitNotAcquired {
+		t.Errorf("waiter exited with %v, want status %d", err, exitNotAcquired)
+	}
+	if time.Now().Before(deadline) {
+		t.Errorf("waiter exited before the deadline")
+	}
+	if list := mustList(t, c); len(list) != 1 {
+		t.Errorf("after the deadline, queue is %q, want only the holder", list)
+	}
+}
+
+func TestTry(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// 1. -try runs the command if the lock is free.
+	if err := mustStartSleeper(t, socket, "-try").Wait(); err != nil {
+		t.Fatalf("-try with a free lock: %v", err)
+	}
+
+	// 2. If the lock is held, -try exits right away without
+	// running the command.
+	if _, err := startProcess(t, []string{"-socket=" + socket, os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=stubborn"}); err != nil {
+		t.Fatal(err)
+	}
+	c := mustClient(t, socket)
+	for len(mustList(t, c)) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	start := time.Now()
+	err := mustStartSleeper(t, socket, "-try").Wait()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != exitNotAcquired {
+		t.Errorf("-try with a held lock exited with %v, want status %d", err, exitNotAcquired)
+	}
+	if d := time.Since(start); d >= sleepDuration {
+		t.Errorf("-try with a held lock took %v; want it not to run the command", d)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	tests := []struct {
+		argv []string
+		want int
+	}{
+		{[]string{"-socket=" + socket, "/nonexistent"}, exitNotFound},
+		{[]string{"-socket=" + socket, os.DevNull}, exitCannotExec},
+		{[]string{"-socket=" + socket, "/bin/sh", "-c", "exit 3"}, 3},
+		{[]string{"-socket=" + socket, "/bin/sh", "-c", "kill $$"}, 128 + int(syscall.SIGTERM)},
+		{[]string{"-socket=" + socket + ".nonexistent", "true"}, exitError},
+		{[]string{"-socket=" + socket + ".nonexistent", "-error-status=200", "true"}, 200},
+	}
+	for _, test := range tests {
+		cmd, err := startProcess(t, test.argv, []string{"GO_TEST_MODE=perflock"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cmd.Wait()
+		if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != test.want {
+			t.Errorf("perflock %s: got %v, want exit status %d", strings.Join(test.argv, " "), err, test.want)
+		}
+	}
+}
+
+func TestUnprivilegedResources(t *testing.T) {
+	t.Parallel()
+
+	// An unprivileged daemon can't reserve huge pages, lock or
+	// limit memory, limit CPU time, or disable swap, so these
+	// acquires fail without running the command and release the
+	// lock.
+	socket := socketName(t)
+	mustStartDaemon(t, socket, "-unprivileged")
+	for _, flag := range []string{"-hugepages=1", "-mlock", "-no-swap", "-shared -mem=1G", "-shared -cpu-max=50%"} {
+		argv := append([]string{"-socket=" + socket}, strings.Fields(flag)...)
+		cmd, err := startProcess(t, append(argv, "/bin/sh", "-c", "exit 3"), []string{"GO_TEST_MODE=perflock"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cmd.Wait()
+		if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != exitError {
+			t.Errorf("%s with an unprivileged daemon exited with %v, want status %d", flag, err, exitError)
+		}
+		if err := mustStartSleeper(t, socket, "-try").Wait(); err != nil {
+			t.Errorf("-try after failed %s: %v", flag, err)
+		}
+	}
+}
+
+func TestHugePagesLimit(t *testing.T) {
+	defer maxHugePages.Store(maxHugePages.Load())
+
+	tests := []struct {
+		max     int64
+		acquire ActionAcquire
+		ok      bool
+	}{
+		{0, ActionAcquire{}, true},
+		{0, ActionAcquire{HugePages: 1}, false},
+		{8, ActionAcquire{HugePages: 8}, true},
+		{8, ActionAcquire{HugePages: 9}, false},
+		{8, ActionAcquire{HugePages: 1, Shared: true}, false},
+	}
+	for _, test := range tests {
+		maxHugePages.Store(test.max)
+		err := validateAcquire(test.acquire)
+		if (err == nil) != test.ok {
+			t.Errorf("with maxHugePages %d, validateAcquire(%+v) = %v, want ok %v", test.max, test.acquire, err, test.ok)
+		}
+	}
+}
+
+func TestLockedMemoryLimit(t *testing.T) {
+	defer maxLockedMemory.Store(maxLockedMemory.Load())
+
+	var cfg daemonConfig
+	if err := json.Unmarshal([]byte(`{"maxLockedMemory": "8G"}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := size(8 << 30); cfg.MaxLockedMemory != want {
+		t.Errorf("maxLockedMemory \"8G\" = %d, want %d", cfg.MaxLockedMemory, want)
+	}
+
+	maxLockedMemory.Store(0)
+	if err := validateAcquire(ActionAcquire{LockMemory: true}); err != errLockMemoryDisabled {
+		t.Errorf("LockMemory without maxLockedMemory: got %v, want %v", err, errLockMemoryDisabled)
+	}
+	maxLockedMemory.Store(int64(cfg.MaxLockedMemory))
+	if err := validateAcquire(ActionAcquire{LockMemory: true}); err != nil {
+		t.Errorf("LockMemory with maxLockedMemory: %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"8G", 8 << 30},
+		{"8gb", 8 << 30},
+		{"1T", 1 << 40},
+		{"0", -1},
+		{"1.5G", -1},
+		{"8P", -1},
+		{"8388608T", -1},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.s)
+		if test.want < 0 {
+			if err == nil {
+				t.Errorf("parseSize(%q) = %d, want error", test.s, got)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", test.s, got, err, test.want)
+		}
+	}
+}
+
+func TestParseCores(t *testing.T) {
+	tests := []struct {
+		s       string
+		n, pct  int
+		wantErr bool
+	}{
+		{"", 0, 0, false},
+		{"4", 4, 0, false},
+		{"50%", 0, 50, false},
+		{"100%", 0, 100, false},
+		{"0%", 0, 0, true},
+		{"101%", 0, 0, true},
+		{"-1", 0, 0, true},
+		{"half", 0, 0, true},
+	}
+	for _, test := range tests {
+		n, pct, err := parseCores(test.s)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseCores(%q) = %d, %d%%, want error", test.s, n, pct)
+			}
+		} else if err != nil || n != test.n || pct != test.pct {
+			t.Errorf("parseCores(%q) = %d, %d%%, %v, want %d, %d%%", test.s, n, pct, err, test.n, test.pct)
+		}
+	}
+}
+
+func TestCoresPercent(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+	c := mustClient(t, socket)
+
+	// The daemon resolves the percentage against the cores this
+	// process may run on, rounding down but reserving at least one.
+	plan, err := c.Plan(ActionAcquire{CoresPercent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Err != "" || plan.Cores.Count() != 1 {
+		t.Errorf("planning 1%% of cores got %+v, want 1 core", plan)
+	}
+	plan, err = c.Plan(ActionAcquire{CoresPercent: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Err != "" || plan.Cores.Count() < 1 {
+		t.Errorf("planning 100%% of cores got %+v, want all reservable cores", plan)
+	}
+	plan, err = c.Plan(ActionAcquire{CoresPercent: 50, Cores: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Err == "" {
+		t.Errorf("planning a percentage and a number of cores succeeded")
+	}
+}
+
+func TestRusage(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+	cmd := exec.Command(os.Args[0], "-socket="+socket, "-governor=none", "-rusage=json", "/bin/sh", "-c", "exit 3")
+	cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 3 {
+		t.Fatalf("perflock -rusage exited with %v, want status 3", err)
+	}
+	var usage Usage
+	if err := json.Unmarshal(stderr.Bytes(), &usage); err != nil {
+		t.Fatalf("parsing -rusage output %q: %v", stderr.Bytes(), err)
+	}
+	if usage.MaxRSS <= 0 {
+		t.Errorf("got max RSS %d, want > 0", usage.MaxRSS)
+	}
+}
+
+func TestPerfStat(t *testing.T) {
+	t.Parallel()
+
+	// A fake perf that runs the command and reports a cycle count.
+	bin := t.TempDir()
+	fake := `#!/bin/sh
+while [ "$1" != -- ]; do
+	case "$1" in
+	-o) out=$2; shift;;
+	esac
+	shift
+done
+shift
+"$@"
+status=$?
+echo "1000,,cycles,500,100.00,," > "$out"
+exit $status
+`
+	if err := os.WriteFile(filepath.Join(bin, "perf"), []byte(fake), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+	envOut := filepath.Join(t.TempDir(), "env.json")
+	cmd := exec.Command(os.Args[0], "-socket="+socket, "-governor=none", "-env-out="+envOut, "-perf-stat=cycles", "/bin/sh", "-c", "exit 3")
+	cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock", "PATH="+bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 3 {
+		t.Fatalf("perflock -perf-stat exited with %v, want status 3; output:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "perflock: perf stat: 1000 cycles") {
+		t.Errorf("output %q does not report the cycle count", out)
+	}
+	data, err := os.ReadFile(envOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env envSnapshot
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatal(err)
+	}
+	if want := []perfCounter{{Event: "cycles", Value: "1000", Running: 100}}; !reflect.DeepEqual(env.PerfStat, want) {
+		t.Errorf("snapshot has counters %+v, want %+v", env.PerfStat, want)
+	}
+}
+
+func TestCount(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+	out := filepath.Join(t.TempDir(), "out")
+	perflock := func(argv ...string) *exec.Cmd {
+		t.Helper()
+		cmd, err := startProcess(t, append([]string{"-socket=" + socket, "-governor=none"}, argv...), []string{"GO_TEST_MODE=perflock"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+	read := func() string {
+		data, _ := os.ReadFile(out)
+		return string(data)
+	}
+
+	// 1. perflock releases the lock between runs, so a command that
+	// starts waiting during the first run goes next.
+	a := perflock("-count=2", "/bin/sh", "-c", "echo a >> "+out+"; sleep 0.5")
+	for read() == "" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	b := perflock("/bin/sh", "-c", "echo b >> "+out)
+	if err := a.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "a\nb\na\n" {
+		t.Errorf("runs happened in order %q, want a, b, a", got)
+	}
+
+	// 2. perflock stops at the first failure.
+	os.Remove(out)
+	err := perflock("-count=3", "/bin/sh", "-c", "echo c >> "+out+"; exit 2").Wait()
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 2 {
+		t.Errorf("failing -count command exited with %v, want status 2", err)
+	}
+	if got := read(); got != "c\n" {
+		t.Errorf("failing -count command ran %q, want once", got)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	dir := t.TempDir()
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"jobDir": "`+dir+`"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// 1. Submit two jobs. The first runs, and the second waits.
+	for i := 0; i < 2; i++ {
+		if err := mustStartSleeper(t, socket, "-submit").Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := mustClient(t, socket)
+	jobs := mustJobs(t, c)
+	if len(jobs) != 2 {
+		t.Fatalf("got jobs %+v, want 2", jobs)
+	}
+
+	// 2. Cancel the second job.
+	if err := c.CancelJob(jobs[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3. Wait for the first job to finish.
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		jobs = mustJobs(t, c)
+		if jobs[0].State != JobQueued && jobs[0].State != JobRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", jobs[0])
+		}
+	}
+	if j := jobs[0]; j.State != JobDone || j.Status != 0 {
+		t.Errorf("first job: got state %s, status %d; want done, 0", j.State, j.Status)
+	}
+	if j := jobs[1]; j.State != JobCancelled {
+		t.Errorf("second job: got state %s, want cancelled", j.State)
+	}
+	data, err := os.ReadFile(jobs[0].Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "GOMAXPROCS=") {
+		t.Errorf("job log %q does not contain the job's output", data)
+	}
+	if !strings.Contains(string(data), "perflock: user ") || jobs[0].Usage == nil {
+		t.Errorf("job did not record its resource usage; log %q, usage %+v", data, jobs[0].Usage)
+	}
+}
+
+func TestJobAfter(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	dir := t.TempDir()
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"jobDir": "`+dir+`"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// 1. Submit a job, and two jobs after it, one of which
+	// requires it to succeed.
+	if err := mustStartSleeper(t, socket, "-submit").Wait(); err != nil {
+		t.Fatal(err)
+	}
+	c := mustClient(t, socket)
+	first := mustJobs(t, c)[0].ID
+	for _, after := range []string{"-after-ok", "-after"} {
+		if err := mustStartSleeper(t, socket, "-submit", fmt.Sprintf("%s=%d", after, first)).Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs := mustJobs(t, c)
+	for _, j := range jobs[1:] {
+		if j.State != JobWaiting || j.After != first {
+			t.Fatalf("got job %+v, want waiting for job %d", j, first)
+		}
+	}
+
+	// 2. Cancel the first job. The job that required it to succeed
+	// is cancelled, and the other runs.
+	if err := c.CancelJob(first); err != nil {
+		t.Fatal(err)
+	}
+	last, err := c.WaitJob(jobs[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.State != JobDone {
+		t.Errorf("last job: got state %s, want done", last.State)
+	}
+	jobs = mustJobs(t, c)
+	if j := jobs[0]; j.State != JobCancelled {
+		t.Errorf("first job: got state %s, want cancelled", j.State)
+	}
+	if j := jobs[1]; j.State != JobCancelled {
+		t.Errorf("-after-ok job: got state %s, want cancelled", j.State)
+	}
+}
+
+func TestKillAfter(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	start := time.Now()
+	cmd, err := startProcess(t, []string{"-socket=" + socket, "-kill-after=200ms", "-grace=200ms", os.Args[0]}, []string{"GO_TEST_MODE=perflock", "GO_TEST_PROGRAM_MODE=stubborn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 124 {
+			t.Errorf("want exit status 124, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("command not killed after -kill-after")
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("perflock exited after %v, before -kill-after and the grace period", d)
+	}
+}
+
+// mustClient connects to the daemon listening on socket.
+func mustClient(t *testing.T, socket string) *Client {
+	t.Helper()
+	c, err := NewClient(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func mustList(t *testing.T, c *Client) []ListEntry {
+	t.Helper()
+	list, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func mustJobs(t *testing.T, c *Client) []JobInfo {
+	t.Helper()
+	jobs, err := c.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
 // funcname returns the function name of the caller.
 func funcname(skip int) string {
 	var pcs [1]uintptr
@@ -173,9 +1218,9 @@ func mustStartSleeper(t *testing.T, socket string, argv ...string) *exec.Cmd {
 
 // mustStartDaemon starts a perflock daemon and wait for it to start listening on
 // the socket.
-func mustStartDaemon(t *testing.T, socket string) {
+func mustStartDaemon(t *testing.T, socket string, argv ...string) {
 	t.Helper()
-	_, err := startProcess(t, []string{"-socket=" + socket, "-daemon"}, []string{"GO_TEST_MODE=perflock"})
+	_, err := startProcess(t, append(argv, "-socket="+socket, "-daemon"), []string{"GO_TEST_MODE=perflock"})
 	if err != nil {
 		t.Fatalf("could not start daemon: %v", err)
 	}
@@ -223,7 +1268,282 @@ func startProcess(t *testing.T, argv []string, env []string) (*exec.Cmd, error)
 	return cmd, nil
 }
 
+// stubborn ignores SIGTERM and runs until it is killed.
+func stubborn() {
+	signal.Ignore(syscall.SIGTERM)
+	time.Sleep(time.Minute)
+}
+
 func sleeper() {
 	log.Printf("GOMAXPROCS=%d\n", runtime.GOMAXPROCS(0))
 	time.Sleep(sleepDuration)
 }
+
+func TestAB(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+	run := func(argv ...string) (string, error) {
+		cmd := exec.Command(os.Args[0], append([]string{"-socket=" + socket, "-governor=none"}, argv...)...)
+		cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock")
+		out, err := cmd.Output()
+		return string(out), err
+	}
+
+	out, err := run("-count=2", "ab", "--", "/bin/echo", "1", "--", "/bin/echo", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ab: A\n1\nab: B\n2\nab: B\n2\nab: A\n1\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+
+	// ab stops at the first failure.
+	out, err = run("-count=2", "ab", "--", "/bin/sh", "-c", "exit 3", "--", "/bin/echo", "2")
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 3 {
+		t.Errorf("failing ab command exited with %v, want status 3", err)
+	}
+	if out != "ab: A\n" {
+		t.Errorf("failing ab command printed %q, want only its first run", out)
+	}
+
+	for _, args := range [][]string{
+		{"ab", "--", "/bin/true"},
+		{"ab", "--", "--", "/bin/true"},
+		{"ab", "--", "/bin/true", "--"},
+	} {
+		if _, err := parseAB(args, 1); err == nil {
+			t.Errorf("parseAB(%q) succeeded, want error", args)
+		}
+	}
+}
+
+func TestAdminSocket(t *testing.T) {
+	t.Parallel()
+
+	// 1. Start a daemon with an admin socket. Its policy makes
+	// everyone an administrator, but the admin socket overrides
+	// that.
+	socket := socketName(t)
+	dir := t.TempDir()
+	admin := filepath.Join(dir, "admin.socket")
+	config := filepath.Join(dir, "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"adminSocket": "`+admin+`", "policy": {"admin": ["*"]}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// 2. Administrative actions are refused on the user socket.
+	if _, err := mustClient(t, socket).Dump(); err == nil {
+		t.Errorf("dump on the user socket succeeded; want it refused")
+	}
+
+	// 3. The admin socket is only accessible to its owner, and
+	// allows them.
+	fi, err := os.Stat(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("admin socket has mode %v, want 0600", perm)
+	}
+	c := mustClient(t, admin)
+	if _, err := c.Dump(); err != nil {
+		t.Errorf("dump on the admin socket: %v", err)
+	}
+	if err := c.SetLogLevel("debug"); err != nil {
+		t.Errorf("setting log level on the admin socket: %v", err)
+	}
+
+	// 4. Pausing the queue holds back waiting commands until it's
+	// resumed.
+	if err := mustClient(t, socket).Pause(true); err == nil {
+		t.Errorf("pause on the user socket succeeded; want it refused")
+	}
+	if err := c.Pause(true); err != nil {
+		t.Fatalf("pausing on the admin socket: %v", err)
+	}
+	sleeper := mustStartSleeper(t, socket)
+	user := mustClient(t, socket)
+	for len(mustList(t, user)) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(sleepDuration)
+	if list := mustList(t, user); list[0].Held {
+		t.Errorf("command acquired the lock while the queue was paused")
+	}
+	if err := c.Pause(false); err != nil {
+		t.Fatalf("resuming on the admin socket: %v", err)
+	}
+	if err := sleeper.Wait(); err != nil {
+		t.Errorf("command failed after resuming: %v", err)
+	}
+
+	// 5. Reloading applies a changed policy.
+	if err := os.WriteFile(config, []byte(`{"adminSocket": "`+admin+`", "policy": {"exclusive": [], "shared": ["*"]}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reload(); err != nil {
+		t.Fatalf("reloading on the admin socket: %v", err)
+	}
+	if err := mustStartSleeper(t, socket).Wait(); err == nil {
+		t.Errorf("exclusive acquire succeeded after reloading; want it refused by the new policy")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"telemetryInterval": "10ms"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	cmd := exec.Command(os.Args[0], "-socket="+socket, "-governor=none", "/bin/sleep", "0.1")
+	cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	// The daemon records the command once it notices it exited.
+	c := mustClient(t, socket)
+	var hist []HistoryEntry
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var err error
+		if hist, err = c.History(); err != nil {
+			t.Fatal(err)
+		}
+		if len(hist) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("command not recorded in history")
+		}
+	}
+	if len(hist) != 1 {
+		t.Fatalf("got %d history entries, want 1: %+v", len(hist), hist)
+	}
+	e := hist[0]
+	if !strings.Contains(e.Command, "sleep") || e.Shared || e.Job {
+		t.Errorf("got entry %+v, want the exclusive sleep command", e)
+	}
+	if held := e.Released.Sub(e.Acquired); held < 100*time.Millisecond {
+		t.Errorf("entry held the lock for %v, want at least 100ms", held)
+	}
+	// The sandbox may not report frequencies or temperatures, but
+	// anything sampled must be consistent.
+	if tel := e.Telemetry; tel != nil {
+		for _, s := range []Summary{tel.Freq, tel.Temp} {
+			if s.N > 0 && !(s.Min <= s.Mean && s.Mean <= s.Max) {
+				t.Errorf("inconsistent summary %+v", s)
+			}
+		}
+	}
+}
+
+func TestLoadGateDaemon(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	config := filepath.Join(t.TempDir(), "perflock.json")
+	if err := os.WriteFile(config, []byte(`{"loadGate": {"maxLoad": 1000000}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mustStartDaemon(t, socket, "-config="+config)
+
+	// Shared acquires aren't gated and can't set a maximum load.
+	if _, err := mustClient(t, socket).Acquire(ActionAcquire{Shared: true, MaxLoad: 1}, nil); err == nil {
+		t.Errorf("shared acquire with a maximum load succeeded")
+	}
+
+	// An exclusive acquire waits for the load to drop, which it
+	// does immediately with such a high threshold.
+	var gate float64
+	resp, err := mustClient(t, socket).Acquire(ActionAcquire{NonBlocking: true}, func(resp ActionAcquireResponse) {
+		gate = resp.LoadGate
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Acquired || len(resp.Warnings) != 0 {
+		t.Errorf("got %+v, want acquired without warnings", resp)
+	}
+	if gate != 1000000 {
+		t.Errorf("got load gate %v while waiting, want 1000000", gate)
+	}
+}
+
+func TestNested(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+	run := func(script string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, os.Args[0], "-governor=none", "/bin/sh", "-c", script)
+		cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock", "PERFLOCK_SOCKET="+socket, "PERFLOCK_TEST="+os.Args[0])
+		out, err := cmd.Output()
+		return string(out), err
+	}
+
+	// A nested exclusive perflock runs its command under the
+	// enclosing lock rather than waiting for it forever.
+	out, err := run(`echo $PERFLOCK $PERFLOCK_MODE; "$PERFLOCK_TEST" -governor=none /bin/echo inner`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 exclusive\ninner\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+
+	// With -reacquire, it waits for the lock, which is busy.
+	_, err = run(`"$PERFLOCK_TEST" -governor=none -reacquire -try /bin/true`)
+	if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != exitNotAcquired {
+		t.Errorf("nested -reacquire -try exited with %v, want status %d", err, exitNotAcquired)
+	}
+}
+
+func TestMarkerOnlyForCommand(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// Every iteration's command sees the marker, but -notify
+	// commands never do, even after the first iteration.
+	dir := t.TempDir()
+	cmdLog, notifyLog := filepath.Join(dir, "cmd.log"), filepath.Join(dir, "notify.log")
+	cmd := exec.Command(os.Args[0], "-socket="+socket, "-governor=none", "-count=2",
+		"-notify=echo $PERFLOCK_EVENT $PERFLOCK >> "+notifyLog,
+		"/bin/sh", "-c", "echo $PERFLOCK >> "+cmdLog)
+	cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	data, err := os.ReadFile(cmdLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "1\n1\n"; got != want {
+		t.Errorf("command saw PERFLOCK %q, want %q", got, want)
+	}
+	// The acquired notifications run in the background.
+	var lines []string
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(notifyLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines = strings.Fields(string(data)); len(lines) == 4 {
+			break
+		}
+	}
+	slices.Sort(lines)
+	if want := []string{"acquired", "acquired", "finished", "finished"}; !slices.Equal(lines, want) {
+		t.Errorf("-notify commands printed %q, want %q without PERFLOCK", lines, want)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// perfCounter is a counter measured by perf stat.
+type perfCounter struct {
+	Event string `json:"event"`
+
+	// Value is the counter's value, or empty if it wasn't counted or
+	// isn't supported.
+	Value string `json:"value"`
+	Unit  string `json:"unit,omitempty"`
+
+	// Running is the percentage of the time the counter was
+	// running. It's less than 100 if perf had to multiplex more
+	// counters than the hardware has.
+	Running float64 `json:"running"`
+}
+
+// perfStat runs a command under perf stat.
+type perfStat struct {
+	events string
+
+	// out is the file perf stat writes the counters to.
+	out string
+}
+
+// wrap returns cmd run under perf stat, counting events while it runs
+// on cpus, or anywhere if cpus is empty.
+func (p *perfStat) wrap(cmd []string, cpus cpuset.Set) ([]string, error) {
+	f, err := os.CreateTemp("", "perflock-perf-stat-")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	p.out = f.Name()
+	wrapped := []string{"perf", "stat", "-x", ",", "-o", p.out, "-e", p.events}
+	if cpus.Count() > 0 {
+		wrapped = append(wrapped, "-C", cpuset.String(&cpus))
+	}
+	return append(append(wrapped, "--"), cmd...), nil
+}
+
+// finish reads the counters, prints them to stderr, and, if envOut is
+// non-empty, writes env to it with the counters.
+func (p *perfStat) finish(env *envSnapshot, envOut string) {
+	f, err := os.Open(p.out)
+	if err == nil {
+		env.PerfStat, err = parsePerfStat(f)
+		f.Close()
+	}
+	os.Remove(p.out)
+	if err != nil {
+		log.Printf("warning: reading perf stat counters: %v", err)
+	}
+	for _, c := range env.PerfStat {
+		value := c.Value
+		if value == "" {
+			value = "<not counted>"
+		} else if c.Unit != "" {
+			value += " " + c.Unit
+		}
+		fmt.Fprintf(os.Stderr, "perflock: perf stat: %s %s", value, c.Event)
+		if c.Value != "" && c.Running < 100 {
+			fmt.Fprintf(os.Stderr, " (%.2f%% running)", c.Running)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if envOut != "" {
+		if err := writeEnv(envOut, *env); err != nil {
+			log.Printf("warning: writing environment snapshot: %v", err)
+		}
+	}
+}
+
+// parsePerfStat parses the output of perf stat -x ",". Each line is a
+// counter value, unit, event, run time, percentage running, and
+// optional metric value and unit.
+func parsePerfStat(r io.Reader) ([]perfCounter, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var counters []perfCounter
+	for _, fields := range records {
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("malformed perf stat line %q", strings.Join(fields, ","))
+		}
+		c := perfCounter{Event: fields[2], Unit: fields[1]}
+		if !strings.HasPrefix(fields[0], "<") {
+			c.Value = fields[0]
+			c.Running, _ = strconv.ParseFloat(fields[4], 64)
+		}
+		counters = append(counters, c)
+	}
+	return counters, nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePerfStat(t *testing.T) {
+	const out = `# started on Fri Oct 16 12:00:00 2026
+
+1234567,,cycles,1000000,100.00,,
+987654,,instructions,500000,50.00,0.80,insn per cycle
+12.50,msec,task-clock,12500000,100.00,0.981,CPUs utilized
+<not supported>,,cache-misses,0,100.00,,
+`
+	got, err := parsePerfStat(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []perfCounter{
+		{Event: "cycles", Value: "1234567", Running: 100},
+		{Event: "instructions", Value: "987654", Running: 50},
+		{Event: "task-clock", Value: "12.50", Unit: "msec", Running: 100},
+		{Event: "cache-misses"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := parsePerfStat(strings.NewReader("1234,cycles\n")); err == nil {
+		t.Errorf("parsing a short line succeeded")
+	}
+}
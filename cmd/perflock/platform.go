@@ -0,0 +1,67 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"runtime"
+)
+
+// unsupportedFlags lists, for each GOOS, the command flags that need
+// OS features that GOOS lacks, and the missing feature. The lock
+// itself works everywhere perflock builds. Flags that need the daemon
+// on Windows, which has none, are handled by runLocal.
+var unsupportedFlags = map[string]map[string]string{
+	"darwin": {
+		"cores":     "CPU affinity",
+		"cpus":      "CPU affinity",
+		"topology":  "CPU affinity",
+		"membind":   "NUMA memory policies",
+		"hugepages": "huge page reservations",
+		"mlock":     "cgroups",
+		"mem":       "cgroups",
+		"cpu-max":   "cgroups",
+		"perf-stat": "perf",
+		"no-swap":   "vm.swappiness",
+		"governor":  "CPU frequency scaling",
+	},
+	"freebsd": {
+		"membind":   "NUMA memory policies",
+		"hugepages": "huge page reservations",
+		"mlock":     "cgroups",
+		"mem":       "cgroups",
+		"cpu-max":   "cgroups",
+		"perf-stat": "perf",
+		"no-swap":   "vm.swappiness",
+		"governor":  "CPU frequency scaling",
+	},
+	"windows": {
+		"membind":   "NUMA memory policies",
+		"hugepages": "huge page reservations",
+		"mlock":     "cgroups",
+		"mem":       "cgroups",
+		"cpu-max":   "cgroups",
+		"perf-stat": "perf",
+		"no-swap":   "vm.swappiness",
+		"governor":  "CPU frequency scaling",
+	},
+}
+
+// checkPlatformFlags exits if a command flag that this platform
+// doesn't support is set. Where the CPU governor is unsupported, it
+// also turns off the default governor setting.
+func checkPlatformFlags(governor *governorFlag) {
+	unsupported := unsupportedFlags[runtime.GOOS]
+	flag.Visit(func(f *flag.Flag) {
+		what, ok := unsupported[f.Name]
+		if !ok || (f.Name == "governor" && governor.percent < 0) {
+			return
+		}
+		fatalf("-%s isn't supported on %s, which lacks %s", f.Name, runtime.GOOS, what)
+	})
+	if _, ok := unsupported["governor"]; ok {
+		governor.percent = -1
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup arranges for cmd to run in its own process group so
+// signals can be delivered to all of it. If perflock is in the
+// foreground of a terminal, the command's process group becomes the
+// foreground, so it receives terminal signals like Ctrl-C directly.
+// The returned function gives the terminal back to perflock once the
+// command has exited.
+func setProcessGroup(cmd *exec.Cmd) (restore func()) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	tty := int(os.Stdin.Fd())
+	fg, err := unix.IoctlGetInt(tty, unix.TIOCGPGRP)
+	if err != nil || fg != unix.Getpgrp() {
+		// Not a terminal, or we're not in its foreground.
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = tty
+	return func() {
+		// We're in the background now, so we'd get SIGTTOU for
+		// taking the terminal back.
+		signal.Ignore(syscall.SIGTTOU)
+		unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, unix.Getpgrp())
+	}
+}
+
+// forwardSignals forwards signals from sigs to process group pgid
+// until done is closed. If timeout is non-nil and receives before done
+// is closed, forwardSignals sends SIGTERM to the process group. If the
+// process group is still running grace after the first signal,
+// forwardSignals kills it. forwardSignals reports whether timeout
+// fired.
+func forwardSignals(pgid int, sigs <-chan os.Signal, grace time.Duration, timeout <-chan time.Time, done <-chan struct{}) (timedOut bool) {
+	var kill <-chan time.Time
+	for {
+		var sig os.Signal
+		select {
+		case sig = <-sigs:
+		case <-timeout:
+			log.Printf("command timed out; terminating it")
+			sig, timedOut = syscall.SIGTERM, true
+		case <-kill:
+			log.Printf("command still running %v after signal; killing it", grace)
+			syscall.Kill(-pgid, syscall.SIGKILL)
+			continue
+		case <-done:
+			return timedOut
+		}
+		syscall.Kill(-pgid, sig.(syscall.Signal))
+		if kill == nil {
+			kill = time.After(grace)
+		}
+	}
+}
+
+// dropPrivileges switches this process to run as user name.
+func dropPrivileges(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Setgroups(nil); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return err
+	}
+	return syscall.Setuid(uid)
+}
+
+// credential returns the credential to run a job as id.
+func credential(id identity) (*syscall.Credential, error) {
+	cred := &syscall.Credential{Uid: id.uid, Gid: id.gid}
+	u, err := user.LookupId(strconv.Itoa(int(id.uid)))
+	if err != nil {
+		return nil, err
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	for _, gid := range gids {
+		if g, err := strconv.Atoi(gid); err == nil {
+			cred.Groups = append(cred.Groups, uint32(g))
+		}
+	}
+	return cred, nil
+}
+
+// jobProcAttr returns the process attributes to run a batch job for
+// owner with: in its own process group, so cancelling it signals all
+// of it, and as owner.
+func jobProcAttr(owner identity) (*syscall.SysProcAttr, error) {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if int(owner.uid) != os.Getuid() {
+		cred, err := credential(owner)
+		if err != nil {
+			return nil, err
+		}
+		attr.Credential = cred
+	}
+	return attr, nil
+}
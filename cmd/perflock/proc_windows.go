@@ -0,0 +1,48 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup does nothing on Windows, where console signals
+// such as Ctrl-C already reach the command.
+func setProcessGroup(cmd *exec.Cmd) (restore func()) {
+	return func() {}
+}
+
+// forwardSignals terminates process pid if sigs or timeout receives
+// before done is closed. Windows can't deliver signals to another
+// process, so the command is killed rather than signaled, and grace
+// is not used. forwardSignals reports whether timeout fired.
+func forwardSignals(pid int, sigs <-chan os.Signal, grace time.Duration, timeout <-chan time.Time, done <-chan struct{}) (timedOut bool) {
+	for {
+		select {
+		case <-sigs:
+		case <-timeout:
+			log.Printf("command timed out; terminating it")
+			timedOut = true
+		case <-done:
+			return timedOut
+		}
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
+	}
+}
+
+func dropPrivileges(name string) error {
+	return errors.ErrUnsupported
+}
+
+func jobProcAttr(owner identity) (*syscall.SysProcAttr, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -4,26 +4,260 @@
 
 package main
 
-import "encoding/gob"
+import (
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
 
 type PerfLockAction struct {
 	Action interface{}
 }
 
-// ActionAcquire acquires the lock. The response is a boolean
-// indicating whether or not the lock was acquired (which may be false
-// for a non-blocking acquire).
+// ActionAcquire acquires the lock. The response is an
+// ActionAcquireResponse.
 type ActionAcquire struct {
 	Shared      bool
 	NonBlocking bool
 	Msg         string
+
+	// Cores, if non-zero, is the number of cores to reserve for
+	// this acquisition. The acquire waits until this many cores are
+	// not reserved by other acquisitions.
+	Cores int
+
+	// CoresPercent, if non-zero, reserves this percentage of the
+	// reservable cores the client process may run on, rounded down
+	// but at least one. The daemon resolves it to Cores when the
+	// acquire is enqueued. It can't be combined with Cores or CPUs.
+	CoresPercent int
+
+	// Topology constrains where the reserved cores may be in the
+	// CPU topology. It must be one of the Topology constants.
+	Topology string
+
+	// CPUs, if non-empty, is the specific set of cores to reserve.
+	// It can't be combined with Cores or Topology.
+	CPUs cpuset.Set
+
+	// Progress requests progress updates while waiting for the
+	// lock. These are sent as ActionAcquireResponses with Waiting
+	// set, before the final response.
+	Progress bool
+
+	// Reservation, if non-zero, is the ID of a reservation made on
+	// the same connection with ActionReserve. The acquire goes
+	// ahead of other waiting acquires, and isn't held back by the
+	// reservation.
+	Reservation int
+
+	// HugePages, if non-zero, is the number of huge pages to add to
+	// the pool while the lock is held. If the kernel can't allocate
+	// them, the acquire fails. It requires an exclusive lock, and
+	// may not exceed the daemon's MaxHugePages.
+	HugePages int
+
+	// LockMemory keeps up to the daemon's MaxLockedMemory of the
+	// memory of the client process and the children it starts from
+	// being reclaimed or swapped out while the lock is held. It
+	// requires an exclusive lock.
+	LockMemory bool
+
+	// NoSwap sets vm.swappiness to 0 while the lock is held. It
+	// requires an exclusive lock.
+	NoSwap bool
+
+	// MemoryMax, if non-zero, limits the memory, including page
+	// cache, that the client process and the children it starts may
+	// use while the lock is held, in bytes. It requires a shared
+	// lock.
+	MemoryMax int64
+
+	// CPUMax, if non-zero, limits the CPU time that the client
+	// process and the children it starts may use while the lock is
+	// held, as a percentage of one CPU. It requires a shared lock.
+	CPUMax int
+
+	// Monitor acquires the lock as a monitor, for lightweight
+	// observability agents. A monitor acquire is granted
+	// immediately, and neither waits for nor delays other acquires,
+	// but is listed in the queue so others can see it is running.
+	// It can't be combined with Shared, reservations of cores or
+	// huge pages, or resource settings.
+	Monitor bool
+
+	// MaxLoad, if non-zero, delays granting an exclusive lock until
+	// the host load not due to perflock drops below this many CPUs,
+	// overriding the daemon's load gate.
+	MaxLoad float64
+}
+
+// Topology constraints for ActionAcquire.
+const (
+	// TopologyAny allows reserving any cores.
+	TopologyAny = ""
+
+	// TopologySameL3 requires all reserved cores to share an L3
+	// cache.
+	TopologySameL3 = "same-l3"
+
+	// TopologySameSocket requires all reserved cores to be in the
+	// same physical package.
+	TopologySameSocket = "same-socket"
+)
+
+// ActionAcquireResponse is the response to ActionAcquire.
+type ActionAcquireResponse struct {
+	// Acquired indicates whether or not the lock was acquired
+	// (which may be false for a non-blocking acquire).
+	Acquired bool
+
+	// Err, if non-empty, is the reason the daemon refused the
+	// acquire.
+	Err string
+
+	// QueueFull indicates that the acquire was refused because too
+	// many acquisitions are already waiting.
+	QueueFull bool
+
+	// ShuttingDown indicates that the acquire was refused because
+	// the daemon is shutting down.
+	ShuttingDown bool
+
+	// Waiting indicates that this is a progress update for an
+	// acquire that is still waiting. Another response will follow.
+	Waiting bool
+
+	// Position is the number of acquisitions ahead of this one, if
+	// Waiting.
+	Position int
+
+	// ID identifies this acquisition for ActionPosition, if
+	// Waiting.
+	ID int
+
+	// ETA estimates how long until the lock is acquired, if
+	// Waiting, or is 0 if there's no estimate.
+	ETA time.Duration
+
+	// LoadGate, if Waiting and non-zero, indicates that the lock is
+	// held for this acquisition, but is waiting for the host load
+	// to drop below this many CPUs before it's granted.
+	LoadGate float64
+
+	// Cores is the set of cores reserved for this acquisition, if
+	// it requested cores.
+	Cores cpuset.Set
+
+	// Topology describes where Cores are in the CPU topology, if
+	// known.
+	Topology string
+
+	// Affinity is the set of cores the command should be
+	// restricted to, or empty if it is unrestricted. If cores were
+	// reserved, this is Cores.
+	Affinity cpuset.Set
+
+	// Warnings describes problems preparing the system for this
+	// acquisition, such as a failed hook.
+	Warnings []string
+
+	// Cancelled indicates that the acquire was cancelled by an
+	// ActionCancel.
+	Cancelled bool
+}
+
+// ActionCancel cancels a pending acquire. Unlike other actions, the
+// client may send it while waiting for an ActionAcquire. The daemon
+// removes the acquire from the queue and responds to it with an
+// ActionAcquireResponse with Cancelled set. If the lock was acquired
+// concurrently, the daemon ignores ActionCancel, and the client should
+// close the connection to release the lock.
+type ActionCancel struct {
 }
 
 // ActionList returns the list of current and pending lock
-// acquisitions as a []string.
+// acquisitions, followed by reservations, as a []ListEntry.
 type ActionList struct {
 }
 
+// ListEntry describes a lock acquisition or reservation.
+type ListEntry struct {
+	// ID identifies the acquisition or reservation.
+	ID int
+
+	// User is the user the acquisition or reservation is for.
+	User string
+
+	// Command is the command the acquisition or reservation is
+	// for.
+	Command string
+
+	// Enqueued is when the acquisition or reservation was made.
+	Enqueued time.Time
+
+	// Shared indicates a shared acquisition.
+	Shared bool
+
+	// Monitor indicates a monitor acquisition, which always holds
+	// the lock.
+	Monitor bool
+
+	// Held indicates that the acquisition holds the lock, rather
+	// than waiting for it.
+	Held bool
+
+	// Job indicates that the acquisition is for a batch job.
+	Job bool
+
+	// Cores, CPUs, and Topology are the cores the acquisition
+	// requested, as in ActionAcquire.
+	Cores    int
+	CPUs     cpuset.Set
+	Topology string
+
+	// Assigned is the set of cores reserved for the acquisition, if
+	// it holds the lock and requested cores.
+	Assigned cpuset.Set
+
+	// Reservation indicates that this is a reservation of the
+	// exclusive lock from Start to End, rather than an acquisition.
+	Reservation bool
+	Start, End  time.Time
+}
+
+// String formats e as a line of perflock -list output.
+func (e ListEntry) String() string {
+	s := fmt.Sprintf("%s\t%s\t%s", e.User, e.Enqueued.Format(time.Stamp), e.Command)
+	if e.Shared {
+		s += " [shared]"
+	}
+	if e.Monitor {
+		s += " [monitor]"
+	}
+	if e.CPUs.Count() > 0 {
+		s += fmt.Sprintf(" [CPUs %s]", cpuset.String(&e.CPUs))
+	} else if e.Cores > 0 {
+		s += fmt.Sprintf(" [%d cores", e.Cores)
+		if e.Topology != TopologyAny {
+			s += ", " + e.Topology
+		}
+		if e.Assigned.Count() > 0 {
+			s += ": " + cpuset.String(&e.Assigned)
+		}
+		s += "]"
+	}
+	if e.Job {
+		s += " [job]"
+	}
+	if e.Reservation {
+		s += fmt.Sprintf(" [reserved %s to %s]", e.Start.Format(time.Stamp), e.End.Format(time.Stamp))
+	}
+	return s
+}
+
 // ActionSetGovernor sets the CPU frequency of all CPUs. The caller
 // must hold the lock.
 type ActionSetGovernor struct {
@@ -32,8 +266,380 @@ type ActionSetGovernor struct {
 	Percent int
 }
 
+// ActionPlan reports what would happen if Acquire were performed now,
+// without acquiring anything. The response is an ActionPlanResponse.
+type ActionPlan struct {
+	Acquire ActionAcquire
+}
+
+// ActionPlanResponse is the response to ActionPlan.
+type ActionPlanResponse struct {
+	// Err, if non-empty, is the reason the daemon would refuse the
+	// acquire.
+	Err string
+
+	// Acquired indicates whether the lock could be acquired
+	// immediately. If so, Cores, Topology, and Affinity are what
+	// the acquire would get.
+	Acquired bool
+
+	// Ahead is the number of acquisitions that the acquire would
+	// wait behind if it couldn't be acquired immediately.
+	Ahead int
+
+	Cores    cpuset.Set
+	Topology string
+	Affinity cpuset.Set
+}
+
+// ActionQueryPower queries the daemon's ability to control CPU
+// frequency. The response is an ActionQueryPowerResponse.
+type ActionQueryPower struct {
+}
+
+// ActionQueryPowerResponse describes the CPU frequency scaling
+// capabilities of the host.
+type ActionQueryPowerResponse struct {
+	// Err, if non-empty, is why the daemon can't control CPU
+	// frequency. The remaining fields may still be filled in.
+	Err string
+
+	// Driver is the CPU frequency scaling driver, such as
+	// "intel_pstate".
+	Driver string
+
+	// Boost indicates whether CPU boost (turbo) can be controlled.
+	Boost bool
+
+	// Governors lists the available CPU frequency governors.
+	Governors []string
+
+	// Domains lists the frequency scaling domains of the host.
+	Domains []PowerDomain
+}
+
+// PowerDomain describes a single frequency scaling domain.
+type PowerDomain struct {
+	// CPUs lists the CPUs in this domain.
+	CPUs string
+
+	// Min and Max are the lowest and highest frequencies of this
+	// domain, in kHz.
+	Min, Max int
+
+	// Available lists the frequencies that can be set, in
+	// ascending order, or is nil if any frequency between Min and
+	// Max can be set.
+	Available []int
+}
+
+// ActionReserve reserves the exclusive lock for a future window of
+// time. Until the window ends, the daemon doesn't grant the lock to
+// other acquires expected to overlap it. The reservation lasts until
+// the window ends or the connection is closed. The response is an
+// ActionReserveResponse.
+type ActionReserve struct {
+	Start    time.Time
+	Duration time.Duration
+	Msg      string
+}
+
+// ActionReserveResponse is the response to ActionReserve.
+type ActionReserveResponse struct {
+	// Err, if non-empty, is why the reservation was refused.
+	Err string
+
+	// ID identifies the reservation for ActionAcquire.
+	ID int
+}
+
+// ActionSubmit submits a batch job, which the daemon runs once it
+// acquires the lock, without the client staying connected. The
+// response is an ActionSubmitResponse.
+type ActionSubmit struct {
+	// Args, Dir, and Env are the command to run, the directory to
+	// run it in, and its environment.
+	Args []string
+	Dir  string
+	Env  []string
+
+	// Acquire is how to acquire the lock for the job.
+	Acquire ActionAcquire
+
+	// Governor is the CPU governor percent to set while running an
+	// exclusive job, or -1 to leave it alone.
+	Governor int
+
+	// Warmup, if non-zero, is how long to keep the job's CPUs busy
+	// before running it, so their frequency and temperature settle.
+	// A shared job must reserve cores to warm up.
+	Warmup time.Duration
+
+	// After, if non-zero, is the ID of a job that must finish
+	// before this job is queued for the lock. If AfterOK is set and
+	// that job doesn't succeed, this job is cancelled.
+	After   int
+	AfterOK bool
+}
+
+// ActionSubmitResponse is the response to ActionSubmit.
+type ActionSubmitResponse struct {
+	// Err, if non-empty, is why the job was refused.
+	Err string
+
+	// QueueFull indicates that the job was refused because too many
+	// acquisitions are already waiting.
+	QueueFull bool
+
+	// ID identifies the job. It is also the ID of its acquisition
+	// for ActionPosition.
+	ID int
+
+	// Log is the file the job's output is written to.
+	Log string
+}
+
+// ActionJobs returns the daemon's batch jobs as a []JobInfo.
+type ActionJobs struct {
+}
+
+// JobInfo describes a batch job.
+type JobInfo struct {
+	ID      int
+	User    string
+	Command string
+
+	// State is one of the Job* constants.
+	State string
+
+	// Status is the command's exit status, if it finished.
+	Status int
+
+	Submitted, Started, Finished time.Time
+
+	// Log is the file the job's output is written to.
+	Log string
+
+	// After is the ID of the job this job is waiting for, or 0.
+	After int
+
+	// Usage is the command's resource usage, if it finished.
+	Usage *Usage
+
+	// Telemetry summarizes the CPU frequency and temperature while
+	// the job ran, if they were sampled.
+	Telemetry *Telemetry
+}
+
+// ActionWaitJob waits for a batch job to finish. The response is an
+// ActionWaitJobResponse.
+type ActionWaitJob struct {
+	ID int
+}
+
+// ActionWaitJobResponse is the response to ActionWaitJob.
+type ActionWaitJobResponse struct {
+	// Err, if non-empty, is why the job couldn't be waited for.
+	Err string
+
+	// Job is the finished job.
+	Job JobInfo
+}
+
+// ActionCancelJob cancels a batch job. If it's running, it is sent
+// SIGTERM. The response is a string error, which is empty on success.
+type ActionCancelJob struct {
+	ID int
+}
+
+// ActionEvict evicts another user's acquisition from the queue or the
+// lock. A waiting acquisition is refused. If the acquisition holds the
+// lock, its client is sent SIGTERM and the lock is released. A batch
+// job is cancelled as by ActionCancelJob. Only administrators may
+// evict acquisitions. The response is a string error, which is empty
+// on success.
+type ActionEvict struct {
+	ID int
+}
+
+// ActionPause stops the daemon from granting the lock to waiting
+// acquisitions if Paused is set, or lets it resume otherwise.
+// Acquisitions that hold the lock keep it, and new ones still queue.
+// Only administrators may pause the queue. The response is a string
+// error, which is empty on success.
+type ActionPause struct {
+	Paused bool
+}
+
+// ActionReload rereads the daemon's configuration file and applies its
+// policy, queue limits, backfilling, and governor hold time. Only
+// administrators may reload the configuration. The response is a
+// string error, which is empty on success.
+type ActionReload struct{}
+
+// ActionSetLogLevel sets the daemon's minimum log level to Level,
+// such as "debug". Only administrators may change it. The response is
+// a string error, which is empty on success.
+type ActionSetLogLevel struct {
+	Level string
+}
+
+// ActionDump reports the daemon's internal scheduling state, for
+// debugging. Only administrators may dump it. The response is an
+// ActionDumpResponse.
+type ActionDump struct{}
+
+// ActionDumpResponse is the response to ActionDump.
+type ActionDumpResponse struct {
+	// Err, if non-empty, is why the state couldn't be dumped.
+	Err string
+
+	// JSON is the state, encoded as JSON. Its format is not
+	// stable.
+	JSON []byte
+}
+
+// ActionPosition reports the state of a pending or current
+// acquisition, identified by the ID in its progress updates. The
+// response is an ActionPositionResponse.
+type ActionPosition struct {
+	ID int
+}
+
+// ActionPositionResponse is the response to ActionPosition.
+type ActionPositionResponse struct {
+	// Err, if non-empty, is why the acquisition couldn't be found.
+	Err string
+
+	// Acquired indicates that the acquisition holds the lock.
+	Acquired bool
+
+	// Position is the number of acquisitions ahead of this one, or
+	// -1 if Acquired.
+	Position int
+
+	// ETA estimates how long until the lock is acquired, or is 0 if
+	// there's no estimate.
+	ETA time.Duration
+
+	// Msg is the queue entry describing the acquisition.
+	Msg string
+
+	// Shared, Cores, Topology, and CPUs are the acquisition's
+	// request.
+	Shared   bool
+	Cores    int
+	Topology string
+	CPUs     cpuset.Set
+
+	// Free is the set of reservable cores that aren't currently
+	// reserved.
+	Free cpuset.Set
+}
+
+// ActionWatch streams the state of the lock. The daemon responds
+// with an ActionWatchResponse immediately and again each time the
+// lock queue changes, until the connection is closed. The client may
+// not send further actions.
+type ActionWatch struct {
+}
+
+// ActionWatchResponse is a response to ActionWatch.
+type ActionWatchResponse struct {
+	// List is the current and pending lock acquisitions, followed by
+	// reservations, as for ActionList.
+	List []ListEntry
+
+	// All is the set of cores commands may run on, and Reservable
+	// is the subset that can be reserved.
+	All, Reservable cpuset.Set
+
+	// Paused indicates that an administrator paused the queue with
+	// ActionPause.
+	Paused bool
+}
+
+// ActionStat returns statistics about the daemon. The response is an
+// ActionStatResponse.
+type ActionStat struct {
+}
+
+// ActionStatResponse is the response to ActionStat.
+type ActionStatResponse struct {
+	// Uptime is how long the daemon has been running.
+	Uptime time.Duration
+
+	// Acquisitions is the number of times the lock has been
+	// acquired.
+	Acquisitions int
+
+	// Held and Waiting are the number of acquisitions currently
+	// holding and waiting for the lock.
+	Held, Waiting int
+
+	// Wait and Hold summarize how long recent acquisitions waited
+	// for and held the lock.
+	Wait, Hold DurationStats
+
+	// GovernorErrors is the number of times setting or restoring
+	// the CPU governor failed.
+	GovernorErrors int
+}
+
+// DurationStats summarizes a set of durations.
+type DurationStats struct {
+	// N is the number of durations. If it is 0, the other fields
+	// are 0.
+	N int
+
+	Mean, P50, P90, P99 time.Duration
+}
+
+// ActionHistory returns the acquisitions that recently released the
+// lock. The response is a []HistoryEntry, oldest first.
+type ActionHistory struct {
+}
+
+// HistoryEntry describes an acquisition that released the lock.
+type HistoryEntry struct {
+	ID      int
+	User    string
+	Command string
+	Shared  bool
+
+	// Job indicates a batch job.
+	Job bool
+
+	// Cores is the set of cores reserved for the acquisition, if
+	// any.
+	Cores cpuset.Set
+
+	Acquired, Released time.Time
+
+	// Telemetry summarizes the CPU frequency and temperature while
+	// the acquisition held the lock, if they were sampled.
+	Telemetry *Telemetry
+}
+
 func init() {
 	gob.Register(ActionAcquire{})
 	gob.Register(ActionList{})
 	gob.Register(ActionSetGovernor{})
+	gob.Register(ActionQueryPower{})
+	gob.Register(ActionPlan{})
+	gob.Register(ActionStat{})
+	gob.Register(ActionPosition{})
+	gob.Register(ActionCancel{})
+	gob.Register(ActionReserve{})
+	gob.Register(ActionSubmit{})
+	gob.Register(ActionJobs{})
+	gob.Register(ActionCancelJob{})
+	gob.Register(ActionEvict{})
+	gob.Register(ActionPause{})
+	gob.Register(ActionReload{})
+	gob.Register(ActionWaitJob{})
+	gob.Register(ActionSetLogLevel{})
+	gob.Register(ActionDump{})
+	gob.Register(ActionWatch{})
+	gob.Register(ActionHistory{})
 }
@@ -0,0 +1,221 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"strings"
+	"sync"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/resctrl"
+)
+
+// resctrlConfig configures cache and memory bandwidth partitioning for
+// commands that reserve cores.
+type resctrlConfig struct {
+	// L3Ways is the number of L3 cache ways dedicated to each
+	// command's cores. No other CPU may allocate in them, so other
+	// tasks can't evict the command's data. Zero leaves the cache
+	// alone.
+	L3Ways int `json:"l3Ways"`
+
+	// MemBandwidth is the percentage of memory bandwidth set aside
+	// for each command's cores. Other CPUs are throttled to the
+	// rest. Zero leaves memory bandwidth alone.
+	MemBandwidth int `json:"memBandwidth"`
+}
+
+// resctrlPrefix prefixes the names of the daemon's resctrl groups.
+const resctrlPrefix = "perflock-"
+
+// theResctrl tracks the resctrl groups of commands holding cores.
+var theResctrl resctrlState
+
+type resctrlState struct {
+	sync.Mutex
+
+	// fs is the resctrl filesystem, or nil if partitioning is
+	// disabled.
+	fs  *resctrl.Resctrl
+	cfg resctrlConfig
+
+	// saved is the default group's schemata from before the daemon
+	// changed it, or nil if it is unchanged.
+	saved []string
+
+	groups map[*resctrlGroup]bool
+	nextID int
+}
+
+// resctrlGroup is a resctrl group dedicated to one command's cores.
+type resctrlGroup struct {
+	name string
+	ways uint64
+}
+
+// setupResctrl enables cache and memory bandwidth partitioning, and
+// removes any groups left over from a previous daemon.
+func setupResctrl(cfg resctrlConfig) error {
+	if cfg.L3Ways < 0 || cfg.MemBandwidth < 0 || cfg.MemBandwidth > 100 {
+		return fmt.Errorf("invalid resctrl configuration %+v", cfg)
+	}
+	fs, err := resctrl.Open()
+	if err != nil {
+		return err
+	}
+	if cfg.L3Ways > 0 {
+		if fs.Ways == 0 {
+			return fmt.Errorf("L3 cache allocation is not supported")
+		}
+		if cfg.L3Ways < fs.MinWays || cfg.L3Ways+fs.MinWays > bits.OnesCount64(fs.Ways) {
+			return fmt.Errorf("cannot dedicate %d of %d L3 ways (minimum %d per group)", cfg.L3Ways, bits.OnesCount64(fs.Ways), fs.MinWays)
+		}
+	}
+	if cfg.MemBandwidth > 0 && fs.MinBandwidth == 0 {
+		return fmt.Errorf("memory bandwidth allocation is not supported")
+	}
+	groups, err := fs.Groups()
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if strings.HasPrefix(g, resctrlPrefix) {
+			if err := fs.Remove(g); err != nil {
+				return err
+			}
+		}
+	}
+	r := &theResctrl
+	r.fs, r.cfg = fs, cfg
+	r.groups = make(map[*resctrlGroup]bool)
+	return nil
+}
+
+// partitionCores creates a resctrl group for cores, giving them their
+// own L3 ways and memory bandwidth. It returns nil if partitioning is
+// disabled.
+func partitionCores(cores cpuset.Set) (*resctrlGroup, error) {
+	r := &theResctrl
+	r.Lock()
+	defer r.Unlock()
+	if r.fs == nil {
+		return nil, nil
+	}
+	if r.saved == nil {
+		saved, err := r.fs.Schemata()
+		if err != nil {
+			return nil, err
+		}
+		r.saved = saved
+	}
+
+	g := &resctrlGroup{name: fmt.Sprintf("%s%d", resctrlPrefix, r.nextID)}
+	r.nextID++
+	var schemata []string
+	if r.cfg.L3Ways > 0 {
+		g.ways = r.allocWays()
+		if g.ways == 0 {
+			return nil, fmt.Errorf("no %d free L3 ways", r.cfg.L3Ways)
+		}
+		schemata = append(schemata, r.fs.L3(g.ways))
+	}
+	if r.cfg.MemBandwidth > 0 {
+		schemata = append(schemata, r.fs.MB(r.roundBandwidth(r.cfg.MemBandwidth)))
+	}
+	// Shrink the default group first, so the ways are never shared.
+	r.groups[g] = true
+	if err := r.updateDefault(); err != nil {
+		delete(r.groups, g)
+		r.updateDefault()
+		return nil, err
+	}
+	if err := r.fs.Create(g.name, cpuset.String(&cores), schemata); err != nil {
+		delete(r.groups, g)
+		r.updateDefault()
+		return nil, err
+	}
+	return g, nil
+}
+
+// release removes g, returning its cores, cache ways, and memory
+// bandwidth to the default group.
+func (g *resctrlGroup) release() {
+	r := &theResctrl
+	r.Lock()
+	defer r.Unlock()
+	if err := r.fs.Remove(g.name); err != nil {
+		slog.Error("removing resctrl group", "group", g.name, "err", err)
+	}
+	delete(r.groups, g)
+	if err := r.updateDefault(); err != nil {
+		slog.Error("restoring resctrl default group", "err", err)
+	}
+}
+
+// allocWays returns the highest run of cfg.L3Ways contiguous ways that
+// no group uses, or 0 if there is none. Ways are handed out from the
+// top, so the default group keeps a contiguous run at the bottom.
+// theResctrl must be locked.
+func (r *resctrlState) allocWays() uint64 {
+	used := r.usedWays()
+	run := uint64(1)<<r.cfg.L3Ways - 1
+	for shift := 64 - r.cfg.L3Ways; shift >= 0; shift-- {
+		if m := run << shift; m&r.fs.Ways == m && m&used == 0 {
+			// Leave the default group enough ways below.
+			if bits.OnesCount64(waysBelow(r.fs.Ways, used|m)) < r.fs.MinWays {
+				return 0
+			}
+			return m
+		}
+	}
+	return 0
+}
+
+func (r *resctrlState) usedWays() uint64 {
+	var used uint64
+	for g := range r.groups {
+		used |= g.ways
+	}
+	return used
+}
+
+// waysBelow returns the ways in all below the lowest way in used.
+func waysBelow(all, used uint64) uint64 {
+	return all & (used&-used - 1)
+}
+
+// roundBandwidth rounds percent to a bandwidth r.fs supports.
+func (r *resctrlState) roundBandwidth(percent int) int {
+	if gran := r.fs.BandwidthGran; gran > 1 {
+		percent -= percent % gran
+	}
+	return max(percent, r.fs.MinBandwidth)
+}
+
+// updateDefault restricts the default group to the ways below every
+// group's and to the memory bandwidth they leave, or restores its
+// saved schemata if there are no groups. theResctrl must be locked.
+func (r *resctrlState) updateDefault() error {
+	if len(r.groups) == 0 {
+		if r.saved == nil {
+			return nil
+		}
+		err := r.fs.SetDefault(r.saved)
+		r.saved = nil
+		return err
+	}
+	var schemata []string
+	if used := r.usedWays(); used != 0 {
+		schemata = append(schemata, r.fs.L3(waysBelow(r.fs.Ways, used)))
+	}
+	if r.cfg.MemBandwidth > 0 {
+		rest := 100 - len(r.groups)*r.cfg.MemBandwidth
+		schemata = append(schemata, r.fs.MB(r.roundBandwidth(rest)))
+	}
+	return r.fs.SetDefault(schemata)
+}
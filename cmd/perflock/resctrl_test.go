@@ -0,0 +1,93 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aclements/perflock/internal/cpuset"
+	"github.com/aclements/perflock/internal/resctrl"
+)
+
+func TestPartitionCores(t *testing.T) {
+	dir := t.TempDir()
+	for path, data := range map[string]string{
+		"schemata":               "L3:0=ff\nMB:0=100\n",
+		"info/L3/cbm_mask":       "ff",
+		"info/L3/min_cbm_bits":   "2",
+		"info/MB/min_bandwidth":  "10",
+		"info/MB/bandwidth_gran": "10",
+	} {
+		path = filepath.Join(dir, path)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := resctrl.OpenDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unlike the real resctrl, a group's directory isn't empty.
+	defer func(remove func(string) error) { resctrl.Remove = remove }(resctrl.Remove)
+	resctrl.Remove = os.RemoveAll
+	r := &theResctrl
+	r.fs, r.cfg, r.groups = fs, resctrlConfig{L3Ways: 3, MemBandwidth: 35}, make(map[*resctrlGroup]bool)
+	defer func() { r.fs = nil }()
+
+	defaultSchemata := func() string {
+		data, err := os.ReadFile(filepath.Join(dir, "schemata"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+	cores, _ := cpuset.Parse("2-3")
+
+	// Each group gets the highest free ways, and the default group
+	// keeps the ways below and the rest of the bandwidth.
+	g1, err := partitionCores(cores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g1.ways != 0xe0 {
+		t.Errorf("first group has ways %x, want e0", g1.ways)
+	}
+	g2, err := partitionCores(cores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g2.ways != 0x1c {
+		t.Errorf("second group has ways %x, want 1c", g2.ways)
+	}
+	if got, want := defaultSchemata(), "L3:0=3\nMB:0=30"; got != want {
+		t.Errorf("default schemata %q, want %q", got, want)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, g2.name, "schemata"))
+	if got, want := string(data), "L3:0=1c\nMB:0=30\n"; got != want {
+		t.Errorf("group schemata %q, want %q", got, want)
+	}
+
+	// A third group would leave the default group too few ways.
+	if _, err := partitionCores(cores); err == nil {
+		t.Errorf("third group succeeded")
+	}
+
+	// Releasing the groups restores the default group.
+	g1.release()
+	if got, want := defaultSchemata(), "L3:0=3\nMB:0=60"; got != want {
+		t.Errorf("default schemata %q, want %q", got, want)
+	}
+	g2.release()
+	if got, want := defaultSchemata(), "L3:0=ff\nMB:0=100"; got != want {
+		t.Errorf("default schemata %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, g2.name)); err == nil {
+		t.Errorf("group %s not removed", g2.name)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// A reservation sets the exclusive lock aside for one client during a
+// future window of time.
+type reservation struct {
+	id         int
+	start, end time.Time
+
+	// user and cmd are who and what the reservation is for, and
+	// made is when it was made.
+	user, cmd string
+	made      time.Time
+
+	// timer removes the reservation when it ends.
+	timer *time.Timer
+}
+
+// Reserve reserves the exclusive lock from start until start+d for
+// user to run cmd. Until the reservation ends,
+// the lock won't wake other lockers that are expected to still hold
+// the lock when it starts, based on how long their commands have held
+// it before. Reserve returns the reservation's ID, which an acquire
+// must give to be admitted during the reservation.
+func (l *PerfLock) Reserve(start time.Time, d time.Duration, user, cmd string) (int, error) {
+	if d <= 0 {
+		return 0, fmt.Errorf("reservation must have a positive duration")
+	}
+	end := start.Add(d)
+	if !end.After(time.Now()) {
+		return 0, fmt.Errorf("reservation ends in the past")
+	}
+	l.l.Lock()
+	defer l.l.Unlock()
+	for _, r := range l.reservations {
+		if start.Before(r.end) && r.start.Before(end) {
+			return 0, fmt.Errorf("overlaps reservation from %s to %s", r.start.Format(time.Stamp), r.end.Format(time.Stamp))
+		}
+	}
+	l.lastID++
+	r := &reservation{id: l.lastID, start: start, end: end, user: user, cmd: cmd, made: time.Now()}
+	r.timer = time.AfterFunc(time.Until(end), func() { l.Unreserve(r.id) })
+	l.reservations = append(l.reservations, r)
+	return r.id, nil
+}
+
+// Unreserve cancels reservation id, if it exists.
+func (l *PerfLock) Unreserve(id int) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	for i, r := range l.reservations {
+		if r.id == id {
+			r.timer.Stop()
+			l.reservations = append(l.reservations[:i:i], l.reservations[i+1:]...)
+			// Lockers held back by the reservation may be
+			// able to run.
+			l.setQ(l.q)
+			return
+		}
+	}
+}
+
+// reservedAgainst reports whether waking locker at time now would
+// overlap another client's reservation.
+func (l *PerfLock) reservedAgainst(locker *Locker, now time.Time) bool {
+	// If there's no history for the command, assume it's short.
+	est := l.holds[locker.cmd]
+	for _, r := range l.reservations {
+		if r.id != locker.reservation && now.Before(r.end) && now.Add(est).After(r.start) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReservation reports whether reservation id exists.
+func (l *PerfLock) hasReservation(id int) bool {
+	l.l.Lock()
+	defer l.l.Unlock()
+	for _, r := range l.reservations {
+		if r.id == id {
+			return true
+		}
+	}
+	return false
+}
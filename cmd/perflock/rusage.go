@@ -0,0 +1,54 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Usage is the resource usage of a finished command and its waited-for
+// descendants, as reported by wait4. Fields the OS doesn't report are
+// zero.
+type Usage struct {
+	// UserTime and SystemTime are the CPU time spent in user and
+	// kernel mode, in seconds.
+	UserTime   float64 `json:"userTime"`
+	SystemTime float64 `json:"systemTime"`
+
+	// MaxRSS is the largest resident set size, in bytes.
+	MaxRSS int64 `json:"maxRSS"`
+
+	VoluntarySwitches   int64 `json:"voluntarySwitches"`
+	InvoluntarySwitches int64 `json:"involuntarySwitches"`
+	MinorFaults         int64 `json:"minorFaults"`
+	MajorFaults         int64 `json:"majorFaults"`
+}
+
+// processUsage returns the resource usage of the process ps describes.
+func processUsage(ps *os.ProcessState) *Usage {
+	u := &Usage{
+		UserTime:   ps.UserTime().Seconds(),
+		SystemTime: ps.SystemTime().Seconds(),
+	}
+	sysUsage(ps, u)
+	return u
+}
+
+func (u *Usage) String() string {
+	return fmt.Sprintf("user %.3fs, sys %.3fs, max RSS %.1f MiB, %d voluntary and %d involuntary context switches, %d minor and %d major page faults",
+		u.UserTime, u.SystemTime, float64(u.MaxRSS)/(1<<20), u.VoluntarySwitches, u.InvoluntarySwitches, u.MinorFaults, u.MajorFaults)
+}
+
+// writeUsage writes u to w in format, which is "text" or "json".
+func writeUsage(w io.Writer, format string, u *Usage) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(u)
+	}
+	_, err := fmt.Fprintf(w, "perflock: %s\n", u)
+	return err
+}
@@ -0,0 +1,28 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// sysUsage fills in the fields of u beyond the CPU times.
+func sysUsage(ps *os.ProcessState, u *Usage) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+	u.MaxRSS = int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		// Everywhere but macOS reports KiB.
+		u.MaxRSS *= 1024
+	}
+	u.VoluntarySwitches, u.InvoluntarySwitches = int64(ru.Nvcsw), int64(ru.Nivcsw)
+	u.MinorFaults, u.MajorFaults = int64(ru.Minflt), int64(ru.Majflt)
+}
@@ -0,0 +1,11 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "os"
+
+// sysUsage fills in the fields of u beyond the CPU times. Windows only
+// reports CPU times.
+func sysUsage(ps *os.ProcessState, u *Usage) {}
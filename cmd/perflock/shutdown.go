@@ -0,0 +1,90 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownC is closed when the daemon starts shutting down. Servers
+// then refuse waiting acquires and disconnect their clients.
+var shutdownC = make(chan struct{})
+
+// errShuttingDown is the error sent to clients that are waiting for
+// the lock when the daemon shuts down.
+const errShuttingDown = "daemon is shutting down"
+
+// shutdownTimeout bounds how long the daemon waits for lock holders
+// and batch jobs to finish when shutting down, before restoring the
+// system settings anyway. Cancelled batch jobs get jobGrace to exit.
+const shutdownTimeout = jobGrace + 5*time.Second
+
+// waitForShutdown waits for SIGTERM or SIGINT and returns the signal.
+func waitForShutdown() os.Signal {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	return <-sigs
+}
+
+// shutdown cancels batch jobs, waits for clients to disconnect, and
+// restores any system settings the daemon changed, such as the CPU
+// governor. shutdownC must be closed and the daemon must have stopped
+// accepting connections.
+func shutdown() {
+	cancelJobs()
+
+	// Wait for servers to drop their lockers, which releases
+	// their settings.
+	timeout := time.After(shutdownTimeout)
+wait:
+	for {
+		changed := theLock.Changed()
+		if held, waiting := theLock.Counts(); held+waiting == 0 {
+			break
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			slog.Warn("timed out waiting for lock holders to exit")
+			break wait
+		}
+	}
+
+	// Restore anything still changed, including governor settings
+	// kept for governorHold.
+	exclusive.Lock()
+	if exclusive.holders > 0 {
+		exclusive.holders = 1
+		exclusive.Unlock()
+		exitExclusive()
+	} else {
+		exclusive.Unlock()
+	}
+	g := &theGovernor
+	g.Lock()
+	if g.restore != nil {
+		g.restore.Stop()
+		g.restore = nil
+	}
+	if g.saved != nil {
+		restoreGovernor()
+	}
+	g.Unlock()
+}
+
+// cancelJobs cancels all unfinished batch jobs.
+func cancelJobs() {
+	theJobs.Lock()
+	defer theJobs.Unlock()
+	for _, j := range theJobs.jobs {
+		if !j.finished() {
+			j.cancelOnce.Do(func() { close(j.cancel) })
+		}
+	}
+}
@@ -5,13 +5,45 @@
 package main
 
 import (
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
-func ignoreSignals() {
-	// Ignore SIGINT and SIGQUIT so they pass through to the
-	// child.
-	signal.Notify(make(chan os.Signal), os.Interrupt, syscall.SIGQUIT)
+// forwardedSignals are the signals perflock forwards to the command's
+// process group.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP}
+
+// cancelOnSignal cancels c's pending acquire if perflock receives one
+// of forwardedSignals or deadline receives before stop is called.
+// deadline may be nil. stop reports whether the acquire was cancelled,
+// and if so, whether it was because of deadline.
+func cancelOnSignal(c *Client, deadline <-chan time.Time) (stop func() (cancelled, expired bool)) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	type result struct{ cancelled, expired bool }
+	res := make(chan result, 1)
+	go func() {
+		var r result
+		select {
+		case _, ok := <-sigs:
+			r.cancelled = ok
+		case <-deadline:
+			r = result{true, true}
+		}
+		if r.cancelled {
+			if err := c.Cancel(); err != nil {
+				log.Print(err)
+			}
+		}
+		res <- r
+	}()
+	return func() (bool, bool) {
+		signal.Stop(sigs)
+		close(sigs)
+		r := <-res
+		return r.cancelled, r.expired
+	}
 }
@@ -0,0 +1,133 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// systemSocket is the socket of the system-wide daemon.
+const systemSocket = "/var/run/perflock.socket"
+
+// defaultSocket returns the socket path to use if -socket is not
+// given. $PERFLOCK_SOCKET takes precedence. Otherwise, a daemon
+// listens on the system socket if it can create it and on the
+// per-user socket if not (or if it is unprivileged), and a client
+// connects to whichever of these has a daemon listening, preferring
+// the system socket.
+func defaultSocket(daemon, unprivileged bool) string {
+	if path := os.Getenv("PERFLOCK_SOCKET"); path != "" {
+		return path
+	}
+	user := userSocket()
+	if user == "" {
+		return systemSocket
+	}
+	if daemon {
+		if !unprivileged && dirWritable(filepath.Dir(systemSocket)) {
+			return systemSocket
+		}
+		return user
+	}
+	for _, path := range []string{systemSocket, user} {
+		if daemonListening(path) {
+			return path
+		}
+	}
+	return systemSocket
+}
+
+// daemonListening reports whether a daemon may be listening on socket
+// path. A daemon that exited without removing its socket leaves a file
+// that refuses connections, so rather than check whether path exists,
+// this tries connecting. Errors other than there being no daemon, such
+// as lacking permission, are left for the client to report.
+func daemonListening(path string) bool {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return !errors.Is(err, syscall.ECONNREFUSED) && !errors.Is(err, syscall.ENOENT)
+	}
+	c.Close()
+	return true
+}
+
+// userSocket returns the per-user socket path, or "" if there is no
+// per-user runtime directory.
+func userSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "perflock.socket")
+}
+
+// isAbstractSocket reports whether path is in Linux's abstract
+// namespace for UNIX domain sockets (see unix(7)). These do not involve
+// the filesystem, and are world-connectable.
+func isAbstractSocket(path string) bool {
+	return runtime.GOOS == "linux" && len(path) > 1 && path[0] == '@'
+}
+
+// listenSocket listens on the UNIX domain socket path, replacing a
+// stale socket left by a daemon that didn't shut down cleanly. Anyone
+// may connect to it, unless the daemon is unprivileged.
+func listenSocket(path string) (net.Listener, error) {
+	if !isAbstractSocket(path) {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if !isAbstractSocket(path) {
+		perm := os.FileMode(0777)
+		if theConfig.Unprivileged {
+			perm = 0700
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// removeSocket removes the socket file path, unless it's abstract.
+func removeSocket(path string) {
+	if !isAbstractSocket(path) {
+		os.Remove(path)
+	}
+}
+
+// adminUID is the user that owns the admin socket. The daemon also
+// checks that clients of the admin socket are this user or root, in
+// case one connected before the socket's permissions were set.
+var adminUID int
+
+// listenAdmin listens on the admin socket path, which only the
+// daemon's user may connect to.
+func listenAdmin(path string) (net.Listener, error) {
+	if len(path) > 0 && path[0] == '@' {
+		// Anyone may connect to an abstract socket.
+		return nil, fmt.Errorf("admin socket %s must not be an abstract socket", path)
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	adminUID = os.Getuid()
+	return l, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSamples is the number of recent wait and hold times the daemon
+// keeps for statistics.
+const maxSamples = 1000
+
+// daemonStats collects statistics about the daemon for ActionStat.
+type daemonStats struct {
+	mu             sync.Mutex
+	start          time.Time
+	acquisitions   int
+	governorErrors int
+	waits, holds   samples
+}
+
+var theStats = daemonStats{start: time.Now()}
+
+// samples records the most recent maxSamples durations.
+type samples struct {
+	d    []time.Duration
+	next int
+}
+
+func (s *samples) add(d time.Duration) {
+	if len(s.d) < maxSamples {
+		s.d = append(s.d, d)
+		return
+	}
+	s.d[s.next] = d
+	s.next = (s.next + 1) % maxSamples
+}
+
+// summary summarizes the recorded durations.
+func (s *samples) summary() DurationStats {
+	if len(s.d) == 0 {
+		return DurationStats{}
+	}
+	sorted := slices.Clone(s.d)
+	slices.Sort(sorted)
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	pct := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return DurationStats{
+		N:    len(sorted),
+		Mean: sum / time.Duration(len(sorted)),
+		P50:  pct(50),
+		P90:  pct(90),
+		P99:  pct(99),
+	}
+}
+
+// acquired records that locker acquired the lock.
+func (st *daemonStats) acquired(locker *Locker) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.acquisitions++
+	st.waits.add(locker.wokeAt.Sub(locker.enqueued))
+}
+
+// released records that locker, which held the lock, released it.
+func (st *daemonStats) released(locker *Locker) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.holds.add(time.Since(locker.wokeAt))
+}
+
+// governorError records a failure to set or restore the CPU governor.
+func (st *daemonStats) governorError() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.governorErrors++
+}
+
+// stat returns the current statistics.
+func (st *daemonStats) stat() ActionStatResponse {
+	held, waiting := theLock.Counts()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return ActionStatResponse{
+		Uptime:         time.Since(st.start),
+		Acquisitions:   st.acquisitions,
+		Held:           held,
+		Waiting:        waiting,
+		Wait:           st.waits.summary(),
+		Hold:           st.holds.summary(),
+		GovernorErrors: st.governorErrors,
+	}
+}
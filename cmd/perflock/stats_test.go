@@ -0,0 +1,36 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamples(t *testing.T) {
+	var s samples
+	if got := s.summary(); got != (DurationStats{}) {
+		t.Errorf("empty summary: got %+v, want zero", got)
+	}
+
+	// Record 1s..1000s, then overwrite the oldest 100 with 0s.
+	for i := 1; i <= maxSamples; i++ {
+		s.add(time.Duration(i) * time.Second)
+	}
+	for i := 0; i < 100; i++ {
+		s.add(0)
+	}
+	got := s.summary()
+	want := DurationStats{
+		N:    maxSamples,
+		Mean: 495450 * time.Millisecond, // (101+...+1000)/1000
+		P50:  500 * time.Second,
+		P90:  900 * time.Second,
+		P99:  990 * time.Second,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"sync"
+
+	"github.com/aclements/perflock/internal/cpupower"
+)
+
+const swappinessPath = "/proc/sys/vm/swappiness"
+
+// swappiness tracks the commands that disabled swapping.
+var swappiness struct {
+	sync.Mutex
+	holders int
+
+	// saved is vm.swappiness from before the first holder set it
+	// to 0.
+	saved []byte
+}
+
+// disableSwap sets vm.swappiness to 0, so the kernel avoids swapping
+// out anonymous memory, until every caller has called enableSwap.
+func disableSwap() error {
+	if theConfig.Unprivileged {
+		return fmt.Errorf("changing vm.swappiness is disabled for unprivileged daemons")
+	}
+	s := &swappiness
+	s.Lock()
+	defer s.Unlock()
+	if s.holders == 0 {
+		saved, err := ioutil.ReadFile(swappinessPath)
+		if err != nil {
+			return err
+		}
+		if err := cpupower.WriteFile(swappinessPath, []byte("0")); err != nil {
+			return fmt.Errorf("setting vm.swappiness: %w", err)
+		}
+		s.saved = saved
+	}
+	s.holders++
+	return nil
+}
+
+// enableSwap undoes a call to disableSwap.
+func enableSwap() {
+	s := &swappiness
+	s.Lock()
+	defer s.Unlock()
+	s.holders--
+	if s.holders > 0 {
+		return
+	}
+	if err := cpupower.WriteFile(swappinessPath, s.saved); err != nil {
+		slog.Error("restoring vm.swappiness", "err", err)
+	}
+	s.saved = nil
+}
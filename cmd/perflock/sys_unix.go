@@ -0,0 +1,29 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// haveDaemon indicates that perflock uses a daemon on this system.
+// Otherwise, it coordinates through a localLock, as -fallback does
+// when the daemon isn't running.
+const haveDaemon = true
+
+// kernelVersion returns the name, release, and version of the
+// running kernel, or "" if they're unknown.
+func kernelVersion() string {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(uts.Sysname[:]) + " " + unix.ByteSliceToString(uts.Release[:]) + " " + unix.ByteSliceToString(uts.Version[:])
+}
+
+// dirWritable reports whether this process may create files in dir.
+func dirWritable(dir string) bool {
+	return unix.Access(dir, unix.W_OK) == nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// haveDaemon indicates that perflock uses a daemon on this system.
+// Windows has no way to identify the user on the other end of a
+// socket, so perflock coordinates through named mutexes instead.
+const haveDaemon = false
+
+// kernelVersion returns the Windows version.
+func kernelVersion() string {
+	v := windows.RtlGetVersion()
+	return fmt.Sprintf("Windows %d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber)
+}
+
+// dirWritable reports whether this process may create files in dir.
+// It's only used to pick the daemon's socket.
+func dirWritable(dir string) bool {
+	return false
+}
+
+// startDaemon returns errors.ErrUnsupported, since there is no daemon.
+func startDaemon(socket string) (*Client, error) {
+	return nil, errors.ErrUnsupported
+}
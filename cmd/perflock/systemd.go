@@ -0,0 +1,121 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// unitTimeout bounds how long stopping or starting a systemd unit may
+// take.
+const unitTimeout = time.Minute
+
+const (
+	systemdDest    = "org.freedesktop.systemd1"
+	systemdPath    = dbus.ObjectPath("/org/freedesktop/systemd1")
+	systemdManager = "org.freedesktop.systemd1.Manager"
+)
+
+// stopUnits stops those systemd units that are active and returns the
+// ones it stopped, even if it fails to stop others. It may be replaced
+// to stop units from a more privileged process.
+var stopUnits = func(units []string) ([]string, error) {
+	return doUnits(units, "StopUnit")
+}
+
+// startUnits starts the given systemd units. It may be replaced to
+// start units from a more privileged process.
+var startUnits = func(units []string) error {
+	_, err := doUnits(units, "StartUnit")
+	return err
+}
+
+// doUnits performs the systemd Manager method, StopUnit or StartUnit,
+// on units and waits for the resulting jobs to finish. When stopping,
+// it skips units that aren't active. It returns the units it operated
+// on successfully and the first error.
+func doUnits(units []string, method string) ([]string, error) {
+	if len(units) == 0 {
+		return nil, nil
+	}
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Watch for jobs finishing. systemd only sends JobRemoved to
+	// subscribed clients.
+	sigs := make(chan *dbus.Signal, 16)
+	conn.Signal(sigs)
+	if err := conn.AddMatchSignal(dbus.WithMatchObjectPath(systemdPath), dbus.WithMatchInterface(systemdManager), dbus.WithMatchMember("JobRemoved")); err != nil {
+		return nil, err
+	}
+	manager := conn.Object(systemdDest, systemdPath)
+	if err := manager.Call(systemdManager+".Subscribe", 0).Err; err != nil {
+		return nil, err
+	}
+
+	var done []string
+	var firstErr error
+	for _, unit := range units {
+		if method == "StopUnit" && !unitActive(conn, unit) {
+			continue
+		}
+		if err := doUnit(manager, sigs, unit, method); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		done = append(done, unit)
+	}
+	return done, firstErr
+}
+
+// unitActive reports whether unit is loaded and active.
+func unitActive(conn *dbus.Conn, unit string) bool {
+	var path dbus.ObjectPath
+	if err := conn.Object(systemdDest, systemdPath).Call(systemdManager+".GetUnit", 0, unit).Store(&path); err != nil {
+		// Not loaded.
+		return false
+	}
+	state, err := conn.Object(systemdDest, path).GetProperty("org.freedesktop.systemd1.Unit.ActiveState")
+	if err != nil {
+		return false
+	}
+	s, _ := state.Value().(string)
+	return s == "active" || s == "activating" || s == "reloading"
+}
+
+// doUnit performs method on unit and waits for its job to finish.
+func doUnit(manager dbus.BusObject, sigs <-chan *dbus.Signal, unit, method string) error {
+	var job dbus.ObjectPath
+	if err := manager.Call(systemdManager+"."+method, 0, unit, "replace").Store(&job); err != nil {
+		return fmt.Errorf("%s %s: %w", method, unit, err)
+	}
+	timeout := time.After(unitTimeout)
+	for {
+		select {
+		case sig, ok := <-sigs:
+			if !ok {
+				return fmt.Errorf("%s %s: D-Bus connection closed", method, unit)
+			}
+			// JobRemoved(u id, o job, s unit, s result)
+			if len(sig.Body) != 4 || sig.Body[1] != job {
+				continue
+			}
+			if result, _ := sig.Body[3].(string); result != "done" {
+				return fmt.Errorf("%s %s: job %s", method, unit, result)
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("%s %s: timed out", method, unit)
+		}
+	}
+}
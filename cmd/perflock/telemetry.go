@@ -0,0 +1,137 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// defaultTelemetryInterval is the default for
+// daemonConfig.TelemetryInterval.
+const defaultTelemetryInterval = time.Second
+
+// telemetryInterval is how often the daemon samples the CPU frequency
+// and temperature while the lock is held, or 0 not to.
+var telemetryInterval = defaultTelemetryInterval
+
+// Telemetry summarizes the CPU frequency and package temperature
+// sampled while an acquisition held the lock.
+type Telemetry struct {
+	// Freq summarizes the frequencies of the acquisition's CPUs, in
+	// GHz, over all CPUs and samples.
+	Freq Summary
+
+	// Temp summarizes the package temperature, in degrees Celsius.
+	Temp Summary
+}
+
+// Summary summarizes a series of samples.
+type Summary struct {
+	// N is the number of samples. If it is 0, the other fields are
+	// 0.
+	N int
+
+	Min, Mean, Max float64
+}
+
+// add adds sample x to s.
+func (s *Summary) add(x float64) {
+	if s.N == 0 {
+		s.Min, s.Max = x, x
+	}
+	s.Min, s.Max = math.Min(s.Min, x), math.Max(s.Max, x)
+	s.Mean += (x - s.Mean) / float64(s.N+1)
+	s.N++
+}
+
+// format formats s as min/mean/max with prec digits after the decimal
+// point.
+func (s Summary) format(prec int) string {
+	if s.N == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.*f/%.*f/%.*f", prec, s.Min, prec, s.Mean, prec, s.Max)
+}
+
+func (t *Telemetry) String() string {
+	return fmt.Sprintf("frequency %s GHz, temperature %s °C (min/avg/max)", t.Freq.format(2), t.Temp.format(1))
+}
+
+// packageTemperature returns the temperature of the hottest CPU
+// package in temps, or of the hottest sensor if none are CPU packages.
+func packageTemperature(temps []temperature) (float64, bool) {
+	hottest := func(pkg bool) (float64, bool) {
+		max, ok := 0.0, false
+		for _, t := range temps {
+			if pkg && !strings.HasSuffix(t.Zone, "pkg_temp") {
+				continue
+			}
+			if !ok || t.Celsius > max {
+				max, ok = t.Celsius, true
+			}
+		}
+		return max, ok
+	}
+	if c, ok := hottest(true); ok {
+		return c, true
+	}
+	return hottest(false)
+}
+
+// telemetrySampler samples the frequency of a set of CPUs and the
+// package temperature until stopped.
+type telemetrySampler struct {
+	stopC chan struct{}
+	done  chan struct{}
+	once  sync.Once
+	t     Telemetry
+}
+
+// startTelemetry starts sampling the frequency of cpus and the package
+// temperature every interval.
+func startTelemetry(cpus cpuset.Set, interval time.Duration) *telemetrySampler {
+	ts := &telemetrySampler{stopC: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(ts.done)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			ts.sample(&cpus)
+			select {
+			case <-tick.C:
+			case <-ts.stopC:
+				return
+			}
+		}
+	}()
+	return ts
+}
+
+func (ts *telemetrySampler) sample(cpus *cpuset.Set) {
+	for _, f := range readFrequencies(cpus) {
+		ts.t.Freq.add(float64(f) / 1e6)
+	}
+	if c, ok := packageTemperature(readTemperatures()); ok {
+		ts.t.Temp.add(c)
+	}
+}
+
+// stop stops sampling and returns the summary, or nil if nothing could
+// be sampled. It may be called more than once.
+func (ts *telemetrySampler) stop() *Telemetry {
+	ts.once.Do(func() { close(ts.stopC) })
+	<-ts.done
+	if ts.t.Freq.N == 0 && ts.t.Temp.N == 0 {
+		return nil
+	}
+	t := ts.t
+	return &t
+}
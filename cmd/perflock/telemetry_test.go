@@ -0,0 +1,39 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestSummary(t *testing.T) {
+	var s Summary
+	if got := s.format(1); got != "-" {
+		t.Errorf("empty summary formatted as %q, want -", got)
+	}
+	for _, x := range []float64{3, 1, 2, 6} {
+		s.add(x)
+	}
+	if want := (Summary{N: 4, Min: 1, Mean: 3, Max: 6}); s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+	if got, want := s.format(1), "1.0/3.0/6.0"; got != want {
+		t.Errorf("formatted as %q, want %q", got, want)
+	}
+}
+
+func TestPackageTemperature(t *testing.T) {
+	if _, ok := packageTemperature(nil); ok {
+		t.Errorf("package temperature with no sensors succeeded")
+	}
+	// Without package sensors, it's the hottest sensor.
+	temps := []temperature{{"acpitz", 50}, {"iwlwifi_1", 60}}
+	if got, _ := packageTemperature(temps); got != 60 {
+		t.Errorf("got %v without package sensors, want 60", got)
+	}
+	// Otherwise, it's the hottest package.
+	temps = append(temps, temperature{"x86_pkg_temp", 45}, temperature{"x86_pkg_temp", 55})
+	if got, _ := packageTemperature(temps); got != 55 {
+		t.Errorf("got %v with package sensors, want 55", got)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// temperature is the reading of a thermal sensor.
+type temperature struct {
+	// Zone is the kind of sensor, such as "x86_pkg_temp".
+	Zone string `json:"zone"`
+
+	Celsius float64 `json:"celsius"`
+}
+
+// thermalDir is where Linux reports thermal zones.
+var thermalDir = "/sys/class/thermal"
+
+// readTemperatures returns the current readings of the host's thermal
+// zones, or nil if they're unavailable.
+func readTemperatures() []temperature {
+	zones, _ := filepath.Glob(filepath.Join(thermalDir, "thermal_zone*"))
+	var temps []temperature
+	for _, zone := range zones {
+		typ, err := os.ReadFile(filepath.Join(zone, "type"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			continue
+		}
+		temps = append(temps, temperature{strings.TrimSpace(string(typ)), float64(milli) / 1000})
+	}
+	return temps
+}
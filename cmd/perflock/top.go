@@ -0,0 +1,184 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpupower"
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// topInterval is how often perflock top refreshes the CPU frequencies
+// and temperatures. It refreshes the queue whenever it changes.
+const topInterval = time.Second
+
+// topCPUsPerRow is the number of CPUs in each row of the core map.
+const topCPUsPerRow = 8
+
+// topState is what perflock top displays.
+type topState struct {
+	Time time.Time
+	Lock ActionWatchResponse
+
+	// Freqs is the current frequency of each CPU, in kHz, if known.
+	Freqs map[int]int
+
+	Temps []temperature
+}
+
+// isTop reports whether the command line args, which left cmd after
+// the flags, runs perflock top. Like ab, "top" alone is perflock's own
+// command, so "perflock top" shows the live view, while "perflock --
+// top" or "perflock top -d 1" runs top(1) under the lock.
+func isTop(args, cmd []string) bool {
+	return len(cmd) == 1 && cmd[0] == "top" && len(args) >= 2 && args[len(args)-2] != "--"
+}
+
+// runTop implements perflock top. It shows the lock queue, which
+// acquisitions hold which cores, and the CPU frequencies and
+// temperatures, refreshing them until interrupted.
+func runTop(c *Client) {
+	updates := make(chan ActionWatchResponse)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- c.Watch(func(resp ActionWatchResponse) bool {
+			updates <- resp
+			return true
+		})
+	}()
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt, syscall.SIGTERM)
+	tick := time.NewTicker(topInterval)
+	defer tick.Stop()
+
+	var st topState
+	haveLock := false
+	for {
+		select {
+		case st.Lock = <-updates:
+			haveLock = true
+		case <-tick.C:
+		case err := <-errC:
+			fatal(err)
+		case <-sigC:
+			return
+		}
+		if !haveLock {
+			continue
+		}
+		st.Time = time.Now()
+		st.Freqs = readFrequencies(&st.Lock.All)
+		st.Temps = readTemperatures()
+
+		// Clear the screen and draw the new state in one write,
+		// to avoid flicker.
+		var buf bytes.Buffer
+		buf.WriteString("\x1b[H\x1b[2J")
+		renderTop(&buf, &st)
+		os.Stdout.Write(buf.Bytes())
+	}
+}
+
+// readFrequencies returns the current frequency of each of cpus, in
+// kHz, omitting those that are unknown.
+func readFrequencies(cpus *cpuset.Set) map[int]int {
+	freqs := make(map[int]int)
+	for _, cpu := range cpuset.ToSlice(cpus) {
+		if f, err := cpupower.CurrentFrequency(cpu); err == nil {
+			freqs[cpu] = f
+		}
+	}
+	return freqs
+}
+
+// renderTop writes st to w.
+func renderTop(w io.Writer, st *topState) {
+	fmt.Fprintf(w, "perflock top - %s\n", st.Time.Format(time.TimeOnly))
+	if len(st.Temps) > 0 {
+		var temps []string
+		for _, t := range st.Temps {
+			temps = append(temps, fmt.Sprintf("%s %.1f°C", t.Zone, t.Celsius))
+		}
+		fmt.Fprintf(w, "temperatures: %s\n", strings.Join(temps, ", "))
+	}
+
+	// Label each acquisition that holds the lock, and mark the
+	// cores it holds. An exclusive acquisition without reserved
+	// cores holds all of them.
+	labels := make(map[int]byte)
+	marks := make(map[int]byte)
+	next := byte('A')
+	for _, e := range st.Lock.List {
+		if !e.Held || e.Monitor || e.Reservation {
+			continue
+		}
+		labels[e.ID] = next
+		if e.Assigned.Count() > 0 {
+			for _, cpu := range cpuset.ToSlice(&e.Assigned) {
+				marks[cpu] = next
+			}
+		} else if !e.Shared {
+			for _, cpu := range cpuset.ToSlice(&st.Lock.All) {
+				marks[cpu] = next
+			}
+		}
+		if next < 'Z' {
+			next++
+		}
+	}
+	fmt.Fprintf(w, "\ncores (. free, - not reservable, letter held by):\n")
+	cpus := cpuset.ToSlice(&st.Lock.All)
+	for i, cpu := range cpus {
+		mark, ok := marks[cpu]
+		if !ok {
+			mark = '.'
+			if !st.Lock.Reservable.IsSet(cpu) {
+				mark = '-'
+			}
+		}
+		freq := "    ?"
+		if f, ok := st.Freqs[cpu]; ok {
+			freq = fmt.Sprintf("%4.2fG", float64(f)/1e6)
+		}
+		sep := " "
+		if (i+1)%topCPUsPerRow == 0 || i == len(cpus)-1 {
+			sep = "\n"
+		}
+		fmt.Fprintf(w, "%4d %c %s%s", cpu, mark, freq, sep)
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "\tID\tUSER\tSTATE\tSINCE\tCOMMAND\n")
+	for _, e := range st.Lock.List {
+		label := ""
+		if l, ok := labels[e.ID]; ok {
+			label = string(l)
+		}
+		state := "waiting"
+		switch {
+		case e.Reservation:
+			state = "reserved"
+		case e.Monitor:
+			state = "monitor"
+		case e.Held && e.Shared:
+			state = "shared"
+		case e.Held:
+			state = "exclusive"
+		}
+		since := st.Time.Sub(e.Enqueued).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", label, e.ID, e.User, state, since, e.Command)
+	}
+	tw.Flush()
+}
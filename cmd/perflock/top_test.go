@@ -0,0 +1,137 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRenderTop(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	st := topState{
+		Time: now,
+		Lock: ActionWatchResponse{
+			List: []ListEntry{
+				{ID: 1, User: "alice", Command: "build", Enqueued: now.Add(-time.Minute), Shared: true, Held: true, Cores: 2, Assigned: coreSet(2, 3)},
+				{ID: 2, User: "bob", Command: "bench", Enqueued: now.Add(-10 * time.Second)},
+				{ID: 3, User: "carol", Command: "sampler", Enqueued: now, Held: true, Monitor: true},
+			},
+			All:        coreSet(0, 1, 2, 3),
+			Reservable: coreSet(1, 2, 3),
+		},
+		Freqs: map[int]int{0: 3100000, 2: 2900000},
+		Temps: []temperature{{"x86_pkg_temp", 52}},
+	}
+	var buf strings.Builder
+	renderTop(&buf, &st)
+	got := buf.String()
+	for _, want := range []string{
+		"temperatures: x86_pkg_temp 52.0°C\n",
+		"   0 - 3.10G    1 .     ?    2 A 2.90G    3 A     ?\n",
+		"A  1   alice  shared   1m0s   build\n",
+		"   2   bob    waiting  10s    bench\n",
+		"   3   carol  monitor  0s     sampler\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// Each change to the queue is streamed to the watcher.
+	updates := make(chan ActionWatchResponse)
+	go mustClient(t, socket).Watch(func(resp ActionWatchResponse) bool {
+		updates <- resp
+		return true
+	})
+	next := func() ActionWatchResponse {
+		t.Helper()
+		select {
+		case resp := <-updates:
+			return resp
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for a watch update")
+		}
+		panic("unreachable")
+	}
+	if resp := next(); len(resp.List) != 0 || resp.All.Count() == 0 {
+		t.Fatalf("first update %+v, want an empty queue and some cores", resp)
+	}
+	c := mustClient(t, socket)
+	if _, err := c.Acquire(ActionAcquire{Shared: true, Msg: "a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if resp := next(); len(resp.List) != 1 || resp.List[0].Command != "a" {
+		t.Fatalf("got update %+v after acquire, want a", resp)
+	}
+	c.Close()
+	if resp := next(); len(resp.List) != 0 {
+		t.Fatalf("got update %+v after release, want an empty queue", resp)
+	}
+}
+
+func TestTopCommand(t *testing.T) {
+	t.Parallel()
+
+	socket := socketName(t)
+	mustStartDaemon(t, socket)
+
+	// "perflock top" shows perflock's own view.
+	cmd := exec.Command(os.Args[0], "-socket="+socket, "top")
+	cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(out).ReadString('\n')
+	cmd.Process.Signal(syscall.SIGTERM)
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("perflock top: %v", err)
+	}
+	if !strings.Contains(line, "perflock top - ") {
+		t.Errorf("perflock top printed %q, want its view", line)
+	}
+
+	// "perflock -- top" and "perflock top" with arguments run the
+	// top command.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "top"), []byte("#!/bin/sh\necho top $*\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--", "top"}, "top\n"},
+		{[]string{"top", "-b"}, "top -b\n"},
+	}
+	for _, test := range tests {
+		cmd := exec.Command(os.Args[0], append([]string{"-socket=" + socket, "-governor=none"}, test.args...)...)
+		cmd.Env = append(os.Environ(), "GO_TEST_MODE=perflock", "PATH="+dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+		out, err := cmd.Output()
+		if err != nil {
+			t.Errorf("perflock %s: %v", strings.Join(test.args, " "), err)
+		}
+		if string(out) != test.want {
+			t.Errorf("perflock %s printed %q, want %q", strings.Join(test.args, " "), out, test.want)
+		}
+	}
+}
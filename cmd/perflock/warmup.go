@@ -0,0 +1,85 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// warmupSlice is roughly how long the warm-up loop runs between
+// checks of the clock.
+const warmupSlice = time.Millisecond
+
+// warmupSink keeps the compiler from optimizing away the warm-up
+// loop.
+var warmupSink atomic.Uint64
+
+// warmup keeps each CPU in cpus busy for d, so their frequency and
+// temperature reach a steady state before a benchmark starts. If it
+// can't run on a CPU, it still spins for d, but returns an error.
+func warmup(cpus *cpuset.Set, d time.Duration) error {
+	list := cpuset.ToSlice(cpus)
+	if len(list) == 0 {
+		return fmt.Errorf("no CPUs to warm up")
+	}
+	deadline := time.Now().Add(d)
+	errs := make([]error, len(list))
+	var wg sync.WaitGroup
+	for i, cpu := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Leave the thread locked so it exits with this
+			// goroutine rather than running others on this CPU.
+			runtime.LockOSThread()
+			var set cpuset.Set
+			set.Set(cpu)
+			if err := cpuset.SetAffinity(0, &set); err != nil {
+				errs[i] = fmt.Errorf("CPU %d: %w", cpu, err)
+			}
+			spin(deadline)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spin keeps the CPU busy until deadline. It calibrates how much work
+// takes about warmupSlice, so that reading the clock doesn't dominate
+// the loop.
+func spin(deadline time.Time) {
+	n := 1
+	for time.Now().Before(deadline) {
+		start := time.Now()
+		spinWork(n)
+		if time.Since(start) >= warmupSlice {
+			break
+		}
+		n *= 2
+	}
+	for time.Now().Before(deadline) {
+		spinWork(n)
+	}
+}
+
+// spinWork does n iterations of integer arithmetic.
+func spinWork(n int) {
+	x := warmupSink.Load()
+	for range n {
+		x = x*6364136223846793005 + 1442695040888963407
+	}
+	warmupSink.Store(x)
+}
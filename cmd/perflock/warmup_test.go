@@ -0,0 +1,36 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+func TestWarmup(t *testing.T) {
+	var none cpuset.Set
+	if err := warmup(&none, time.Millisecond); err == nil {
+		t.Errorf("warming up no CPUs succeeded")
+	}
+
+	cpus, err := cpuset.GetAffinity(0)
+	if err != nil {
+		t.Skip("affinity unsupported: ", err)
+	}
+	// Warm up only one CPU, so the test doesn't load the whole
+	// machine.
+	var one cpuset.Set
+	one.Set(cpuset.ToSlice(&cpus)[0])
+	const d = 50 * time.Millisecond
+	start := time.Now()
+	if err := warmup(&one, d); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < d || elapsed > d+time.Second {
+		t.Errorf("warm-up for %v took %v", d, elapsed)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cgroup places processes in Linux cgroup v2 control groups
+// and sets their resource controls.
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Hierarchy is a mounted cgroup v2 hierarchy. Groups are named by
+// their path relative to its root, such as "perflock/1".
+type Hierarchy struct {
+	dir string
+}
+
+// Open returns the cgroup v2 hierarchy mounted at /sys/fs/cgroup.
+func Open() (*Hierarchy, error) {
+	return OpenDir("/sys/fs/cgroup")
+}
+
+// OpenDir returns the cgroup v2 hierarchy mounted at dir.
+func OpenDir(dir string) (*Hierarchy, error) {
+	if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("no cgroup v2 hierarchy at %s: %w", dir, err)
+	}
+	return &Hierarchy{dir}, nil
+}
+
+// Controllers returns the controllers available to group, or to the
+// root of the hierarchy if group is "".
+func (h *Hierarchy) Controllers(group string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(h.dir, group, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// Enable creates group if it doesn't exist and enables controllers
+// for its children, and therefore for group and its ancestors.
+func (h *Hierarchy) Enable(group string, controllers ...string) error {
+	dir := filepath.Join(h.dir, group)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := Mkdir(dir); err != nil {
+			return err
+		}
+	}
+	avail, err := h.Controllers("")
+	if err != nil {
+		return err
+	}
+	var enable []string
+	for _, c := range controllers {
+		if !slices.Contains(avail, c) {
+			return fmt.Errorf("cgroup controller %s is not available", c)
+		}
+		enable = append(enable, "+"+c)
+	}
+	if len(enable) == 0 {
+		return nil
+	}
+	// Each ancestor must enable the controllers for its children, from
+	// the root down.
+	parts := strings.Split(filepath.Clean(group), string(filepath.Separator))
+	for i := 0; i <= len(parts); i++ {
+		path := filepath.Join(h.dir, filepath.Join(parts[:i]...), "cgroup.subtree_control")
+		if err := WriteFile(path, []byte(strings.Join(enable, " "))); err != nil {
+			return fmt.Errorf("enabling cgroup controllers: %w", err)
+		}
+	}
+	return nil
+}
+
+// Set writes the control files of group, such as "memory.max", in
+// order of file name.
+func (h *Hierarchy) Set(group string, settings map[string]string) error {
+	for _, file := range slices.Sorted(maps.Keys(settings)) {
+		if err := WriteFile(filepath.Join(h.dir, group, file), []byte(settings[file])); err != nil {
+			return fmt.Errorf("setting %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// Create creates group and writes its control files. Its parent must
+// have enabled the controllers of these files.
+func (h *Hierarchy) Create(group string, settings map[string]string) error {
+	dir := filepath.Join(h.dir, group)
+	if err := Mkdir(dir); err != nil {
+		return err
+	}
+	if err := h.Set(group, settings); err != nil {
+		Remove(dir)
+		return err
+	}
+	return nil
+}
+
+// AddProcess moves process pid, with all of its threads, to group.
+// Its future children start in group.
+func (h *Hierarchy) AddProcess(group string, pid int) error {
+	return WriteFile(filepath.Join(h.dir, group, "cgroup.procs"), []byte(fmt.Sprint(pid)))
+}
+
+// Populated reports whether group or any of its descendants contain
+// processes.
+func (h *Hierarchy) Populated(group string) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(h.dir, group, "cgroup.events"))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "populated "); ok {
+			return v != "0", nil
+		}
+	}
+	return false, fmt.Errorf("no populated field in %s cgroup.events", group)
+}
+
+// Remove removes group, which must have no processes or children.
+func (h *Hierarchy) Remove(group string) error {
+	return Remove(filepath.Join(h.dir, group))
+}
+
+// Groups returns the names of the children of group.
+func (h *Hierarchy) Groups(group string) ([]string, error) {
+	fs, err := ioutil.ReadDir(filepath.Join(h.dir, group))
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, f := range fs {
+		if f.IsDir() {
+			groups = append(groups, filepath.Join(group, f.Name()))
+		}
+	}
+	return groups, nil
+}
+
+// ProcessGroup returns the group of process pid, such as
+// "user.slice/user-1000.slice/session-1.scope", or "" if it is in the
+// root of the hierarchy.
+func ProcessGroup(pid int) (string, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	return parseProcCgroup(string(data))
+}
+
+// parseProcCgroup returns the cgroup v2 group in the contents of a
+// /proc/PID/cgroup file.
+func parseProcCgroup(data string) (string, error) {
+	for _, line := range strings.Split(data, "\n") {
+		if group, ok := strings.CutPrefix(line, "0::/"); ok {
+			return group, nil
+		}
+	}
+	return "", fmt.Errorf("process is not in a cgroup v2 group")
+}
+
+// WriteFile, Mkdir, and Remove modify the cgroup hierarchy. They may
+// be replaced to perform changes from a more privileged process.
+var (
+	WriteFile = func(path string, data []byte) error {
+		return ioutil.WriteFile(path, data, 0)
+	}
+	Mkdir = func(path string) error {
+		return os.Mkdir(path, 0755)
+	}
+	Remove = os.Remove
+)
@@ -0,0 +1,109 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenDir(dir); err == nil {
+		t.Fatalf("OpenDir of an empty directory succeeded")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpu memory pids\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	h, err := OpenDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The kernel creates cgroup.controllers in new groups.
+	Mkdir = func(path string) error {
+		if err := os.Mkdir(path, 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(path, "cgroup.controllers"), nil, 0666)
+	}
+	defer func() {
+		Mkdir = func(path string) error { return os.Mkdir(path, 0755) }
+	}()
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := h.Enable("perflock", "io"); err == nil || !strings.Contains(err.Error(), "io is not available") {
+		t.Errorf("enabling an unavailable controller: got %v", err)
+	}
+	if err := h.Enable("perflock", "memory", "cpu"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"cgroup.subtree_control", "perflock/cgroup.subtree_control"} {
+		if got := read(path); got != "+memory +cpu" {
+			t.Errorf("%s = %q, want %q", path, got, "+memory +cpu")
+		}
+	}
+	// Enabling them again is harmless.
+	if err := h.Enable("perflock", "memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Create("perflock/1", map[string]string{"memory.max": "8G", "cpu.max": "200000 100000"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("perflock/1/memory.max"); got != "8G" {
+		t.Errorf("memory.max = %q, want 8G", got)
+	}
+	if got := read("perflock/1/cpu.max"); got != "200000 100000" {
+		t.Errorf("cpu.max = %q, want %q", got, "200000 100000")
+	}
+	if err := h.AddProcess("perflock/1", 42); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("perflock/1/cgroup.procs"); got != "42" {
+		t.Errorf("cgroup.procs = %q, want 42", got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "perflock/1/cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := h.Populated("perflock/1"); err != nil || !p {
+		t.Errorf("Populated = %v, %v, want true", p, err)
+	}
+	groups, err := h.Groups("perflock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"perflock/1"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("Groups = %q, want %q", groups, want)
+	}
+}
+
+func TestParseProcCgroup(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{"0::/user.slice/user-1000.slice/session-1.scope\n", "user.slice/user-1000.slice/session-1.scope"},
+		{"0::/\n", ""},
+		{"12:memory:/user.slice\n0::/system.slice/cron.service\n", "system.slice/cron.service"},
+	}
+	for _, test := range tests {
+		got, err := parseProcCgroup(test.data)
+		if err != nil || got != test.want {
+			t.Errorf("parseProcCgroup(%q) = %q, %v, want %q", test.data, got, err, test.want)
+		}
+	}
+	if _, err := parseProcCgroup("12:memory:/user.slice\n"); err == nil {
+		t.Errorf("parseProcCgroup of a cgroup v1 file succeeded")
+	}
+}
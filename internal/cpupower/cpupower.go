@@ -6,25 +6,35 @@
 package cpupower
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
+	"strings"
 )
 
 // Domain is a frequency scaling domain. This may include more than
 // one CPU.
 type Domain struct {
 	path      string
+	cpus      string
 	min, max  int
 	available []int
 }
 
 var cpuRe = regexp.MustCompile(`cpu\d+$`)
 
-// Domains returns the frequency scaling domains of this host.
+// Domains returns the frequency scaling domains of this host. On
+// systems other than Linux, it returns an error wrapping
+// errors.ErrUnsupported.
 func Domains() ([]*Domain, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("CPU frequency scaling isn't supported on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+	}
 	dir := "/sys/devices/system/cpu"
 	fs, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -64,11 +74,77 @@ func Domains() ([]*Domain, error) {
 			return nil, err
 		}
 		sort.Ints(avail)
-		domains = append(domains, &Domain{pdir, min, max, avail})
+		cpus, err = ioutil.ReadFile(filepath.Join(pdir, "affected_cpus"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		domains = append(domains, &Domain{pdir, strings.TrimSpace(string(cpus)), min, max, avail})
 	}
 	return domains, nil
 }
 
+// CPUs returns the CPUs in this domain as a space-separated list, or
+// "" if unknown.
+func (d *Domain) CPUs() string {
+	return d.cpus
+}
+
+// Driver returns the name of the frequency scaling driver of this
+// domain, such as "intel_pstate" or "acpi-cpufreq".
+func (d *Domain) Driver() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.path, "scaling_driver"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Governors returns the frequency scaling governors available for this
+// domain.
+func (d *Domain) Governors() ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.path, "scaling_available_governors"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// HaveBoost reports whether this host's CPU boost (turbo) can be
+// controlled.
+func HaveBoost() bool {
+	for _, path := range []string{
+		"/sys/devices/system/cpu/cpufreq/boost",
+		"/sys/devices/system/cpu/intel_pstate/no_turbo",
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Boost reports whether this host's CPU boost (turbo) is enabled.
+func Boost() (bool, error) {
+	if noTurbo, err := readInt("/sys/devices/system/cpu/intel_pstate/no_turbo"); err == nil {
+		return noTurbo == 0, nil
+	}
+	boost, err := readInt("/sys/devices/system/cpu/cpufreq/boost")
+	if err != nil {
+		return false, err
+	}
+	return boost != 0, nil
+}
+
+// Governor returns the name of the current frequency scaling governor
+// of this domain.
+func (d *Domain) Governor() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.path, "scaling_governor"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // AvailableRange returns the available frequency range this CPU is
 // capable of and the set of available frequencies in ascending order
 // or nil if any frequency can be set.
@@ -105,3 +181,8 @@ func (d *Domain) SetRange(min, max int) error {
 	}
 	return err1
 }
+
+// CurrentFrequency returns the current frequency of CPU cpu, in kHz.
+func CurrentFrequency(cpu int) (int, error) {
+	return readInt(fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpufreq/scaling_cur_freq", cpu))
+}
@@ -19,8 +19,14 @@ func readInt(path string) (int, error) {
 	return strconv.Atoi(strings.TrimSpace(string(data)))
 }
 
+// WriteFile writes data to the sysfs file at path. It may be
+// replaced to perform writes from a more privileged process.
+var WriteFile = func(path string, data []byte) error {
+	return ioutil.WriteFile(path, data, 0)
+}
+
 func writeInt(path string, val int) error {
-	return ioutil.WriteFile(path, []byte(fmt.Sprintf("%d", val)), 0)
+	return WriteFile(path, []byte(fmt.Sprintf("%d", val)))
 }
 
 func readInts(path string) ([]int, error) {
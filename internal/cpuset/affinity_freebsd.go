@@ -0,0 +1,61 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build amd64 || arm64 || riscv64
+
+package cpuset
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuset_getaffinity and cpuset_setaffinity arguments, from
+// <sys/cpuset.h>.
+const (
+	cpuLevelWhich = 3 // CPU_LEVEL_WHICH: the actual mask of one object
+	cpuWhichTid   = 1 // CPU_WHICH_TID: id is a thread ID
+)
+
+// minSetWords is the size of the kernel's cpuset_t, in words. Older
+// kernels reject smaller masks.
+const minSetWords = 16
+
+// threadID returns the ID cpuset_*affinity uses for thread tid, where
+// -1 means the calling thread.
+func threadID(tid int) uintptr {
+	if tid == 0 {
+		return ^uintptr(0)
+	}
+	return uintptr(tid)
+}
+
+// GetAffinity returns the CPU affinity mask of thread tid, or of the
+// calling thread if tid is 0.
+func GetAffinity(tid int) (Set, error) {
+	for n := minSetWords; ; n *= 2 {
+		buf := make([]uint64, n)
+		_, _, errno := unix.RawSyscall6(unix.SYS_CPUSET_GETAFFINITY, cpuLevelWhich, cpuWhichTid, threadID(tid), uintptr(n*8), uintptr(unsafe.Pointer(&buf[0])), 0)
+		if errno == unix.ERANGE && n*64 < maxCPUs {
+			// The kernel's mask is larger than buf.
+			continue
+		} else if errno != 0 {
+			return Set{}, errno
+		}
+		return Set{buf}, nil
+	}
+}
+
+// SetAffinity sets the CPU affinity mask of thread tid, or of the
+// calling thread if tid is 0, to s.
+func SetAffinity(tid int, s *Set) error {
+	buf := make([]uint64, max(len(s.bits), minSetWords))
+	copy(buf, s.bits)
+	_, _, errno := unix.RawSyscall6(unix.SYS_CPUSET_SETAFFINITY, cpuLevelWhich, cpuWhichTid, threadID(tid), uintptr(len(buf)*8), uintptr(unsafe.Pointer(&buf[0])), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpuset
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// GetAffinity returns the CPU affinity mask of thread tid, or of the
+// calling thread if tid is 0.
+//
+// Unlike unix.SchedGetaffinity, GetAffinity works on machines with
+// more CPUs than fit in a unix.CPUSet.
+func GetAffinity(tid int) (Set, error) {
+	for n := 16; ; n *= 2 {
+		buf := make([]uint64, n)
+		size, _, errno := unix.RawSyscall(unix.SYS_SCHED_GETAFFINITY, uintptr(tid), uintptr(n*8), uintptr(unsafe.Pointer(&buf[0])))
+		if errno == unix.EINVAL && n*64 < maxCPUs {
+			// The kernel's mask is larger than buf.
+			continue
+		} else if errno != 0 {
+			return Set{}, errno
+		}
+		return Set{buf[:size/8]}, nil
+	}
+}
+
+// SetAffinity sets the CPU affinity mask of thread tid, or of the
+// calling thread if tid is 0, to s.
+func SetAffinity(tid int, s *Set) error {
+	buf := s.bits
+	if len(buf) == 0 {
+		// Let the kernel reject the empty mask.
+		buf = make([]uint64, 1)
+	}
+	_, _, errno := unix.RawSyscall(unix.SYS_SCHED_SETAFFINITY, uintptr(tid), uintptr(len(buf)*8), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !windows && !(freebsd && (amd64 || arm64 || riscv64))
+
+package cpuset
+
+import "errors"
+
+// GetAffinity returns errors.ErrUnsupported. This platform, such as
+// macOS, has no way to restrict threads to CPUs.
+func GetAffinity(tid int) (Set, error) {
+	return Set{}, errors.ErrUnsupported
+}
+
+// SetAffinity returns errors.ErrUnsupported.
+func SetAffinity(tid int, s *Set) error {
+	return errors.ErrUnsupported
+}
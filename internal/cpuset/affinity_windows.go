@@ -0,0 +1,56 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpuset
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                   = windows.NewLazySystemDLL("kernel32.dll")
+	procGetProcessAffinityMask = kernel32.NewProc("GetProcessAffinityMask")
+	procSetProcessAffinityMask = kernel32.NewProc("SetProcessAffinityMask")
+)
+
+// GetAffinity returns the CPU affinity mask of the calling process.
+// tid must be 0.
+//
+// On Windows, affinity is per process rather than per thread, and
+// only covers the first processor group of up to 64 CPUs.
+func GetAffinity(tid int) (Set, error) {
+	if tid != 0 {
+		return Set{}, fmt.Errorf("cannot get affinity of thread %d", tid)
+	}
+	var mask, sysMask uintptr
+	r, _, err := procGetProcessAffinityMask.Call(uintptr(windows.CurrentProcess()), uintptr(unsafe.Pointer(&mask)), uintptr(unsafe.Pointer(&sysMask)))
+	if r == 0 {
+		return Set{}, err
+	}
+	return Set{[]uint64{uint64(mask)}}, nil
+}
+
+// SetAffinity sets the CPU affinity mask of the calling process to s.
+// tid must be 0. Processes the caller starts afterwards inherit it.
+func SetAffinity(tid int, s *Set) error {
+	if tid != 0 {
+		return fmt.Errorf("cannot set affinity of thread %d", tid)
+	}
+	var mask uint64
+	for i, w := range s.bits {
+		if i > 0 && w != 0 {
+			return fmt.Errorf("CPU set %s exceeds the first processor group", String(s))
+		} else if i == 0 {
+			mask = w
+		}
+	}
+	r, _, err := procSetProcessAffinityMask.Call(uintptr(windows.CurrentProcess()), uintptr(mask))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
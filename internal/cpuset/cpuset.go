@@ -0,0 +1,255 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cpuset provides operations on sets of CPUs.
+package cpuset
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// maxCPUs bounds the CPU IDs a Set may contain, so a bad CPU list
+// can't allocate an enormous set.
+const maxCPUs = 1 << 20
+
+// Set is a set of CPUs. Unlike unix.CPUSet, a Set can contain any
+// number of CPUs. The zero value is an empty set.
+//
+// Sets are values: modifying a copy of a Set doesn't affect the
+// original. Sets must be compared with Equal rather than ==.
+type Set struct {
+	bits []uint64
+}
+
+// Set adds cpu to s.
+func (s *Set) Set(cpu int) {
+	if cpu < 0 || cpu >= maxCPUs {
+		panic(fmt.Sprintf("CPU %d out of range", cpu))
+	}
+	// s.bits may be shared with copies of s, so this can't modify
+	// it in place. To build a large set, use FromSlice or Parse,
+	// which allocate it once.
+	b := make([]uint64, max(len(s.bits), cpu/64+1))
+	copy(b, s.bits)
+	b[cpu/64] |= 1 << (cpu % 64)
+	s.bits = b
+}
+
+// Clear removes cpu from s.
+func (s *Set) Clear(cpu int) {
+	if !s.IsSet(cpu) {
+		return
+	}
+	b := make([]uint64, len(s.bits))
+	copy(b, s.bits)
+	b[cpu/64] &^= 1 << (cpu % 64)
+	s.bits = b
+}
+
+// IsSet reports whether cpu is in s.
+func (s *Set) IsSet(cpu int) bool {
+	return cpu >= 0 && cpu/64 < len(s.bits) && s.bits[cpu/64]&(1<<(cpu%64)) != 0
+}
+
+// Count returns the number of CPUs in s.
+func (s *Set) Count() int {
+	n := 0
+	for _, w := range s.bits {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// MarshalText encodes s in the Linux list format.
+func (s Set) MarshalText() ([]byte, error) {
+	return []byte(String(&s)), nil
+}
+
+// UnmarshalText decodes a CPU list in the Linux list format into s.
+func (s *Set) UnmarshalText(text []byte) error {
+	p, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*s = p
+	return nil
+}
+
+// GobEncode encodes s in the Linux list format.
+func (s Set) GobEncode() ([]byte, error) {
+	return s.MarshalText()
+}
+
+// GobDecode decodes a CPU list in the Linux list format into s.
+func (s *Set) GobDecode(data []byte) error {
+	return s.UnmarshalText(data)
+}
+
+// ToSlice returns the IDs of the CPUs in s in ascending order.
+func ToSlice(s *Set) []int {
+	var cpus []int
+	for i, w := range s.bits {
+		for w != 0 {
+			bit := bits.TrailingZeros64(w)
+			cpus = append(cpus, i*64+bit)
+			w &^= 1 << bit
+		}
+	}
+	return cpus
+}
+
+// FromSlice returns the set of CPUs in cpus.
+func FromSlice(cpus []int) (Set, error) {
+	top := -1
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= maxCPUs {
+			return Set{}, fmt.Errorf("CPU %d out of range", cpu)
+		}
+		top = max(top, cpu)
+	}
+	s := alloc(top)
+	for _, cpu := range cpus {
+		s.bits[cpu/64] |= 1 << (cpu % 64)
+	}
+	return s, nil
+}
+
+// alloc returns an empty set with room for CPUs up to top, which may
+// be -1 for none.
+func alloc(top int) Set {
+	if top < 0 {
+		return Set{}
+	}
+	return Set{make([]uint64, top/64+1)}
+}
+
+// addRange adds CPUs first through last to s, which must have room for
+// them.
+func (s *Set) addRange(first, last int) {
+	for cpu := first; cpu <= last; {
+		if cpu%64 == 0 && last-cpu >= 63 {
+			s.bits[cpu/64] = ^uint64(0)
+			cpu += 64
+			continue
+		}
+		s.bits[cpu/64] |= 1 << (cpu % 64)
+		cpu++
+	}
+}
+
+// Equal reports whether a and b contain the same CPUs.
+func Equal(a, b *Set) bool {
+	for i := 0; i < len(a.bits) || i < len(b.bits); i++ {
+		if word(a, i) != word(b, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// word returns the i'th word of s, which is 0 past its end.
+func word(s *Set, i int) uint64 {
+	if i < len(s.bits) {
+		return s.bits[i]
+	}
+	return 0
+}
+
+// combine returns the set whose i'th word is op applied to the i'th
+// words of a and b.
+func combine(a, b *Set, op func(x, y uint64) uint64) Set {
+	n := len(a.bits)
+	if len(b.bits) > n {
+		n = len(b.bits)
+	}
+	out := Set{make([]uint64, n)}
+	for i := range out.bits {
+		out.bits[i] = op(word(a, i), word(b, i))
+	}
+	return out
+}
+
+// Union returns the CPUs in either a or b.
+func Union(a, b *Set) Set {
+	return combine(a, b, func(x, y uint64) uint64 { return x | y })
+}
+
+// Intersect returns the CPUs in both a and b.
+func Intersect(a, b *Set) Set {
+	return combine(a, b, func(x, y uint64) uint64 { return x & y })
+}
+
+// Difference returns the CPUs in a that are not in b.
+func Difference(a, b *Set) Set {
+	return combine(a, b, func(x, y uint64) uint64 { return x &^ y })
+}
+
+// String returns the CPUs in s in the Linux list format. It is
+// shorthand for Format(ToSlice(s)).
+func String(s *Set) string {
+	return Format(ToSlice(s))
+}
+
+// Format formats cpus, which must be in ascending order, in the Linux
+// list format, such as "0-3,8,10-11". Consecutive CPUs are collapsed
+// into ranges. Format is the inverse of Parse.
+func Format(cpus []int) string {
+	var b strings.Builder
+	for i := 0; i < len(cpus); {
+		j := i + 1
+		for j < len(cpus) && cpus[j] == cpus[j-1]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		if j-i == 1 {
+			fmt.Fprintf(&b, "%d", cpus[i])
+		} else {
+			fmt.Fprintf(&b, "%d-%d", cpus[i], cpus[j-1])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// Parse parses a CPU list in the Linux list format, such as
+// "0-3,8,10-11".
+func Parse(list string) (Set, error) {
+	var s Set
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return s, nil
+	}
+	type cpuRange struct{ first, last int }
+	var ranges []cpuRange
+	top := -1
+	for _, r := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return s, fmt.Errorf("bad CPU list %q", list)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(hi)
+			if err != nil {
+				return s, fmt.Errorf("bad CPU list %q", list)
+			}
+		}
+		if first < 0 || last < first || last >= maxCPUs {
+			return s, fmt.Errorf("bad CPU range %q in %q", r, list)
+		}
+		ranges = append(ranges, cpuRange{first, last})
+		top = max(top, last)
+	}
+	s = alloc(top)
+	for _, r := range ranges {
+		s.addRange(r.first, r.last)
+	}
+	return s, nil
+}
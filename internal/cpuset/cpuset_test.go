@@ -0,0 +1,172 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpuset
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		cpus []int
+		want string
+	}{
+		{nil, ""},
+		{[]int{0}, "0"},
+		{[]int{0, 1}, "0-1"},
+		{[]int{0, 1, 2, 3, 8, 9, 10, 11}, "0-3,8-11"},
+		{[]int{1, 3, 5}, "1,3,5"},
+		{[]int{0, 2, 3, 4, 7}, "0,2-4,7"},
+		{[]int{1023, 1024, 2047}, "1023-1024,2047"},
+	} {
+		if got := Format(test.cpus); got != test.want {
+			t.Errorf("Format(%v) = %q, want %q", test.cpus, got, test.want)
+		}
+
+		// Round trip through a set.
+		s, err := FromSlice(test.cpus)
+		if err != nil {
+			t.Errorf("FromSlice(%v): %v", test.cpus, err)
+			continue
+		}
+		if got := String(&s); got != test.want {
+			t.Errorf("String(%v) = %q, want %q", test.cpus, got, test.want)
+		}
+		p, err := Parse(test.want)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.want, err)
+			continue
+		}
+		if !Equal(&p, &s) {
+			t.Errorf("Parse(%q) = %v, want %v", test.want, ToSlice(&p), test.cpus)
+		}
+		if got := ToSlice(&p); !reflect.DeepEqual(got, test.cpus) {
+			t.Errorf("ToSlice(Parse(%q)) = %v, want %v", test.want, got, test.cpus)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		list string
+		want []int
+	}{
+		{"0-3,8\n", []int{0, 1, 2, 3, 8}},
+		{"3,1", []int{1, 3}},
+		{"2-2", []int{2}},
+		{"62-65,1", []int{1, 62, 63, 64, 65}},
+		{"64-127,0-3,2-3", append([]int{0, 1, 2, 3}, seq(64, 127)...)},
+	} {
+		s, err := Parse(test.list)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.list, err)
+			continue
+		}
+		if got := ToSlice(&s); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %v, want %v", test.list, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"x", "1-", "3-1", "-1", "1,,2", "0-100000000"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func seq(first, last int) []int {
+	var cpus []int
+	for cpu := first; cpu <= last; cpu++ {
+		cpus = append(cpus, cpu)
+	}
+	return cpus
+}
+
+func TestLarge(t *testing.T) {
+	// Sets come from clients, so building even the largest ones
+	// must take time linear in their size.
+	all := fmt.Sprintf("0-%d", maxCPUs-1)
+	s, err := Parse(strings.Repeat(all+",", 1000) + all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Count(); got != maxCPUs {
+		t.Errorf("Parse(%q x 1001).Count() = %d, want %d", all, got, maxCPUs)
+	}
+	s, err = FromSlice(seq(0, maxCPUs-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Count(); got != maxCPUs {
+		t.Errorf("FromSlice(%s).Count() = %d, want %d", all, got, maxCPUs)
+	}
+}
+
+func TestFromSliceRange(t *testing.T) {
+	for _, cpu := range []int{-1, maxCPUs} {
+		if _, err := FromSlice([]int{cpu}); err == nil {
+			t.Errorf("FromSlice([%d]) succeeded, want error", cpu)
+		}
+	}
+}
+
+func TestSetOps(t *testing.T) {
+	a, _ := FromSlice([]int{0, 1, 2000})
+	b, _ := FromSlice([]int{1, 2})
+
+	// Modifying a copy doesn't modify the original.
+	c := a
+	c.Set(3)
+	c.Clear(0)
+	if got, want := String(&a), "0-1,2000"; got != want {
+		t.Errorf("after modifying copy, a = %q, want %q", got, want)
+	}
+	if got, want := String(&c), "1,3,2000"; got != want {
+		t.Errorf("c = %q, want %q", got, want)
+	}
+
+	for _, test := range []struct {
+		name string
+		s    Set
+		want string
+	}{
+		{"Union", Union(&a, &b), "0-2,2000"},
+		{"Intersect", Intersect(&a, &b), "1"},
+		{"Difference", Difference(&a, &b), "0,2000"},
+	} {
+		if got := String(&test.s); got != test.want {
+			t.Errorf("%s = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// Sets with different backing sizes are equal if they contain
+	// the same CPUs.
+	d := Difference(&a, &a)
+	if !Equal(&d, &Set{}) || d.Count() != 0 {
+		t.Errorf("empty difference %q not equal to empty set", String(&d))
+	}
+}
+
+func TestGob(t *testing.T) {
+	type msg struct{ CPUs Set }
+	in := msg{}
+	in.CPUs, _ = FromSlice([]int{0, 5, 6, 7, 4095})
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out msg
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(&in.CPUs, &out.CPUs) {
+		t.Errorf("gob round trip of %q = %q", String(&in.CPUs), String(&out.CPUs))
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cputopology reads the CPU topology of a Linux host.
+package cputopology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// Topology is the arrangement of CPUs on a host.
+type Topology struct {
+	// CPUs lists the CPUs of the host in ascending order of ID.
+	CPUs []CPU
+
+	// Isolated is the set of CPUs the kernel has isolated from
+	// general scheduling (isolcpus) or runs without timer ticks
+	// (nohz_full).
+	Isolated cpuset.Set
+}
+
+// CPU is a single logical CPU.
+type CPU struct {
+	ID int
+
+	// Package is the physical package (socket) ID of this CPU.
+	Package int
+
+	// Core identifies the physical core of this CPU. It is the
+	// lowest ID of this CPU's hardware thread siblings, including
+	// itself.
+	Core int
+
+	// L2 identifies the L2 cache of this CPU. It is the lowest ID of
+	// the CPUs sharing this CPU's L2 cache, or -1 if it has no L2.
+	L2 int
+
+	// L3 identifies the L3 cache of this CPU. It is the lowest ID of
+	// the CPUs sharing this CPU's L3 cache, or -1 if it has no L3.
+	L3 int
+
+	// Node is the NUMA node of this CPU, or -1 if unknown.
+	Node int
+}
+
+// Level is a level of the topology at which CPUs can be grouped.
+type Level int
+
+const (
+	// Package groups CPUs in the same physical package.
+	Package Level = iota
+
+	// L3 groups CPUs that share an L3 cache.
+	L3
+
+	// Core groups CPUs that are hardware threads of the same
+	// physical core.
+	Core
+
+	// Node groups CPUs in the same NUMA node.
+	Node
+
+	// L2 groups CPUs that share an L2 cache.
+	L2
+)
+
+var (
+	cpuRe  = regexp.MustCompile(`^cpu(\d+)$`)
+	nodeRe = regexp.MustCompile(`^node(\d+)$`)
+)
+
+// Read reads the topology of this host.
+func Read() (*Topology, error) {
+	t, err := ReadDir("/sys/devices/system/cpu")
+	if err != nil {
+		return nil, err
+	}
+	// Older kernels don't report nohz_full CPUs in sysfs.
+	if cmdline, err := ioutil.ReadFile("/proc/cmdline"); err == nil {
+		for _, arg := range strings.Fields(string(cmdline)) {
+			if list, ok := strings.CutPrefix(arg, "nohz_full="); ok {
+				if nohz, err := cpuset.Parse(list); err == nil {
+					t.Isolated = cpuset.Union(&t.Isolated, &nohz)
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// ReadDir reads the topology from dir, which has the layout of
+// /sys/devices/system/cpu.
+func ReadDir(dir string) (*Topology, error) {
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var t Topology
+	for _, f := range fs {
+		m := cpuRe.FindStringSubmatch(f.Name())
+		if m == nil || !f.IsDir() {
+			continue
+		}
+		cdir := filepath.Join(dir, f.Name())
+		if _, err := os.Stat(filepath.Join(cdir, "topology")); os.IsNotExist(err) {
+			// Offline CPU.
+			continue
+		}
+		cpu := CPU{L2: -1, L3: -1, Node: -1}
+		cpu.ID, _ = strconv.Atoi(m[1])
+		cpu.Package, err = readInt(filepath.Join(cdir, "topology", "physical_package_id"))
+		if err != nil {
+			return nil, err
+		}
+		cpu.Core, err = readCore(cdir, cpu.ID)
+		if err != nil {
+			return nil, err
+		}
+		cpu.L2, err = readCache(cdir, 2)
+		if err != nil {
+			return nil, err
+		}
+		cpu.L3, err = readCache(cdir, 3)
+		if err != nil {
+			return nil, err
+		}
+		cpu.Node, err = readNode(cdir)
+		if err != nil {
+			return nil, err
+		}
+		t.CPUs = append(t.CPUs, cpu)
+	}
+	sort.Slice(t.CPUs, func(i, j int) bool { return t.CPUs[i].ID < t.CPUs[j].ID })
+
+	for _, name := range []string{"isolated", "nohz_full"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		// nohz_full reads "(null)" if it is disabled.
+		if strings.TrimSpace(string(data)) == "(null)" {
+			continue
+		}
+		cpus, err := cpuset.Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		t.Isolated = cpuset.Union(&t.Isolated, &cpus)
+	}
+	return &t, nil
+}
+
+func readCore(cdir string, id int) (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(cdir, "topology", "thread_siblings_list"))
+	if os.IsNotExist(err) {
+		return id, nil
+	} else if err != nil {
+		return -1, err
+	}
+	siblings, err := cpuset.Parse(string(data))
+	if err != nil {
+		return -1, err
+	}
+	if cpus := cpuset.ToSlice(&siblings); len(cpus) > 0 {
+		return cpus[0], nil
+	}
+	return id, nil
+}
+
+// readCache returns the lowest ID of the CPUs sharing the cache at the
+// given level with the CPU in cdir, or -1 if it has no such cache.
+func readCache(cdir string, want int) (int, error) {
+	caches, err := filepath.Glob(filepath.Join(cdir, "cache", "index*"))
+	if err != nil {
+		return -1, err
+	}
+	for _, cache := range caches {
+		level, err := readInt(filepath.Join(cache, "level"))
+		if err != nil {
+			return -1, err
+		}
+		if level != want {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(cache, "shared_cpu_list"))
+		if err != nil {
+			return -1, err
+		}
+		shared, err := cpuset.Parse(string(data))
+		if err != nil {
+			return -1, err
+		}
+		if cpus := cpuset.ToSlice(&shared); len(cpus) > 0 {
+			return cpus[0], nil
+		}
+	}
+	return -1, nil
+}
+
+// readNode returns the NUMA node of the CPU in cdir, or -1 if the
+// kernel doesn't report one.
+func readNode(cdir string) (int, error) {
+	fs, err := ioutil.ReadDir(cdir)
+	if err != nil {
+		return -1, err
+	}
+	for _, f := range fs {
+		if m := nodeRe.FindStringSubmatch(f.Name()); m != nil {
+			return strconv.Atoi(m[1])
+		}
+	}
+	return -1, nil
+}
+
+// Groups returns the sets of CPUs that share the given level of the
+// topology, in ascending order of their lowest CPU. CPUs that aren't
+// part of any group at that level are omitted.
+func (t *Topology) Groups(level Level) []cpuset.Set {
+	var keys []int
+	groups := make(map[int]*cpuset.Set)
+	for _, cpu := range t.CPUs {
+		var key int
+		switch level {
+		case Package:
+			key = cpu.Package
+		case L3:
+			key = cpu.L3
+		case Core:
+			key = cpu.Core
+		case Node:
+			key = cpu.Node
+		case L2:
+			key = cpu.L2
+		}
+		if key < 0 {
+			continue
+		}
+		g := groups[key]
+		if g == nil {
+			g = new(cpuset.Set)
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.Set(cpu.ID)
+	}
+	out := make([]cpuset.Set, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, *groups[key])
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return cpuset.ToSlice(&out[i])[0] < cpuset.ToSlice(&out[j])[0]
+	})
+	return out
+}
+
+// Describe returns a description of where the CPUs in s are in the
+// topology, such as "package 0, L3 0,8". On hosts with more than one
+// NUMA node, this includes the nodes, such as "package 0, L3 0, node 0".
+func (t *Topology) Describe(s *cpuset.Set) string {
+	var pkgs, l3s, nodes []string
+	seenPkg, seenL3, seenNode := make(map[int]bool), make(map[int]bool), make(map[int]bool)
+	for _, cpu := range t.CPUs {
+		if !s.IsSet(cpu.ID) {
+			continue
+		}
+		if !seenPkg[cpu.Package] {
+			seenPkg[cpu.Package] = true
+			pkgs = append(pkgs, strconv.Itoa(cpu.Package))
+		}
+		if cpu.L3 >= 0 && !seenL3[cpu.L3] {
+			seenL3[cpu.L3] = true
+			l3s = append(l3s, strconv.Itoa(cpu.L3))
+		}
+		if cpu.Node >= 0 && !seenNode[cpu.Node] {
+			seenNode[cpu.Node] = true
+			nodes = append(nodes, strconv.Itoa(cpu.Node))
+		}
+	}
+	desc := fmt.Sprintf("package %s", strings.Join(pkgs, ","))
+	if len(l3s) > 0 {
+		desc += fmt.Sprintf(", L3 %s", strings.Join(l3s, ","))
+	}
+	if len(t.Groups(Node)) > 1 {
+		desc += fmt.Sprintf(", node %s", strings.Join(nodes, ","))
+	}
+	return desc
+}
+
+func readInt(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
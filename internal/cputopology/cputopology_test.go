@@ -0,0 +1,92 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cputopology
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aclements/perflock/internal/cpuset"
+)
+
+// writeSysfs creates a fake /sys/devices/system/cpu in dir with two
+// packages, each with two physical cores of two threads. Each
+// package is its own NUMA node and L3 cache, and each physical core
+// has its own L2. CPUs are numbered like Linux numbers them, with
+// the second threads of all cores after the first. CPU 8 is offline.
+func writeSysfs(t *testing.T, dir string) {
+	write := func(path, data string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for cpu := 0; cpu < 8; cpu++ {
+		core, pkg := cpu%4, cpu%4/2
+		c := fmt.Sprintf("cpu%d", cpu)
+		write(c+"/topology/physical_package_id", fmt.Sprint(pkg))
+		write(c+"/topology/thread_siblings_list", fmt.Sprintf("%d,%d", core, core+4))
+		write(c+"/cache/index0/level", "1")
+		write(c+"/cache/index0/shared_cpu_list", fmt.Sprintf("%d,%d", core, core+4))
+		write(c+"/cache/index2/level", "2")
+		write(c+"/cache/index2/shared_cpu_list", fmt.Sprintf("%d,%d", core, core+4))
+		write(c+"/cache/index3/level", "3")
+		write(c+"/cache/index3/shared_cpu_list", fmt.Sprintf("%d-%d,%d-%d", 2*pkg, 2*pkg+1, 2*pkg+4, 2*pkg+5))
+		write(c+fmt.Sprintf("/node%d/cpulist", pkg), "")
+	}
+	write("cpu8/online", "0")
+	write("isolated", "3,7")
+	write("nohz_full", "(null)")
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeSysfs(t, dir)
+	topo, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(topo.CPUs) != 8 {
+		t.Fatalf("want 8 online CPUs, got %d", len(topo.CPUs))
+	}
+	want := CPU{ID: 6, Package: 1, Core: 2, L2: 2, L3: 2, Node: 1}
+	if got := topo.CPUs[6]; got != want {
+		t.Errorf("CPU 6 is %+v, want %+v", got, want)
+	}
+	if got := cpuset.String(&topo.Isolated); got != "3,7" {
+		t.Errorf("isolated CPUs are %q, want %q", got, "3,7")
+	}
+
+	for _, test := range []struct {
+		level Level
+		want  []string
+	}{
+		{Package, []string{"0-1,4-5", "2-3,6-7"}},
+		{Node, []string{"0-1,4-5", "2-3,6-7"}},
+		{L3, []string{"0-1,4-5", "2-3,6-7"}},
+		{L2, []string{"0,4", "1,5", "2,6", "3,7"}},
+		{Core, []string{"0,4", "1,5", "2,6", "3,7"}},
+	} {
+		var got []string
+		for _, g := range topo.Groups(test.level) {
+			got = append(got, cpuset.String(&g))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Groups(%d) = %v, want %v", test.level, got, test.want)
+		}
+	}
+
+	s, _ := cpuset.Parse("1,2")
+	if got, want := topo.Describe(&s), "package 0,1, L3 0,2, node 0,1"; got != want {
+		t.Errorf("Describe(1,2) = %q, want %q", got, want)
+	}
+}
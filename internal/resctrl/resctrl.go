@@ -0,0 +1,237 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package resctrl partitions the L3 cache and memory bandwidth among
+// CPUs using the Linux resctrl filesystem, which exposes Intel RDT and
+// AMD PQoS.
+package resctrl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resctrl is a mounted resctrl filesystem.
+type Resctrl struct {
+	dir string
+
+	// Ways is the bitmask of all L3 cache ways, or 0 if the L3
+	// cache can't be partitioned.
+	Ways uint64
+
+	// MinWays is the fewest contiguous ways a group may use.
+	MinWays int
+
+	// L3IDs lists the IDs of the L3 cache domains.
+	L3IDs []int
+
+	// MinBandwidth is the lowest memory bandwidth percentage a
+	// group may be throttled to, or 0 if memory bandwidth can't be
+	// partitioned. Percentages are rounded down to a multiple of
+	// BandwidthGran.
+	MinBandwidth, BandwidthGran int
+
+	// MBIDs lists the IDs of the memory bandwidth domains.
+	MBIDs []int
+}
+
+// Open returns the resctrl filesystem mounted at /sys/fs/resctrl.
+func Open() (*Resctrl, error) {
+	return OpenDir("/sys/fs/resctrl")
+}
+
+// OpenDir returns the resctrl filesystem mounted at dir.
+func OpenDir(dir string) (*Resctrl, error) {
+	r := &Resctrl{dir: dir}
+	schemata, err := r.readSchemata("")
+	if err != nil {
+		return nil, err
+	}
+	if ids := schemata["L3"]; ids != nil {
+		mask, err := readString(filepath.Join(dir, "info/L3/cbm_mask"))
+		if err != nil {
+			return nil, err
+		}
+		if r.Ways, err = strconv.ParseUint(mask, 16, 64); err != nil {
+			return nil, fmt.Errorf("parsing L3 cbm_mask: %w", err)
+		}
+		if r.MinWays, err = readInt(filepath.Join(dir, "info/L3/min_cbm_bits")); err != nil {
+			return nil, err
+		}
+		r.L3IDs = sortedIDs(ids)
+	}
+	if ids := schemata["MB"]; ids != nil {
+		if r.MinBandwidth, err = readInt(filepath.Join(dir, "info/MB/min_bandwidth")); err != nil {
+			return nil, err
+		}
+		if r.BandwidthGran, err = readInt(filepath.Join(dir, "info/MB/bandwidth_gran")); err != nil {
+			return nil, err
+		}
+		r.MBIDs = sortedIDs(ids)
+	}
+	if r.Ways == 0 && r.MinBandwidth == 0 {
+		return nil, fmt.Errorf("resctrl at %s supports neither L3 nor memory bandwidth allocation", dir)
+	}
+	return r, nil
+}
+
+// readSchemata returns the schemata of group, or of the default
+// group if group is "", as a map from resource name to domain ID to
+// value.
+func (r *Resctrl) readSchemata(group string) (map[string]map[int]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, group, "schemata"))
+	if err != nil {
+		return nil, err
+	}
+	schemata := make(map[string]map[int]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		name, domains, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		vals := make(map[int]string)
+		for _, d := range strings.Split(domains, ";") {
+			id, val, ok := strings.Cut(d, "=")
+			n, err := strconv.Atoi(id)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("malformed schemata line %q", line)
+			}
+			vals[n] = val
+		}
+		schemata[name] = vals
+	}
+	return schemata, nil
+}
+
+// Schemata returns the L3 and MB lines of the default group's
+// schemata, to restore later with SetDefault.
+func (r *Resctrl) Schemata() ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, "schemata"))
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "L3:") || strings.HasPrefix(line, "MB:") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// L3 returns a schemata line allocating the ways in mask in every L3
+// domain.
+func (r *Resctrl) L3(mask uint64) string {
+	return line("L3", r.L3IDs, strconv.FormatUint(mask, 16))
+}
+
+// MB returns a schemata line throttling memory bandwidth to percent
+// in every memory bandwidth domain.
+func (r *Resctrl) MB(percent int) string {
+	return line("MB", r.MBIDs, strconv.Itoa(percent))
+}
+
+func line(name string, ids []int, val string) string {
+	var b strings.Builder
+	b.WriteString(name + ":")
+	for i, id := range ids {
+		if i > 0 {
+			b.WriteString(";")
+		}
+		fmt.Fprintf(&b, "%d=%s", id, val)
+	}
+	return b.String()
+}
+
+// SetDefault sets schemata lines of the default group, which holds
+// every CPU not assigned to another group.
+func (r *Resctrl) SetDefault(schemata []string) error {
+	return WriteFile(filepath.Join(r.dir, "schemata"), []byte(strings.Join(schemata, "\n")+"\n"))
+}
+
+// Create creates group name, moves cpus (in the Linux list format)
+// to it, and sets its schemata lines.
+func (r *Resctrl) Create(name, cpus string, schemata []string) error {
+	dir := filepath.Join(r.dir, name)
+	if err := Mkdir(dir); err != nil {
+		return err
+	}
+	err := WriteFile(filepath.Join(dir, "cpus_list"), []byte(cpus))
+	if err == nil && len(schemata) > 0 {
+		err = WriteFile(filepath.Join(dir, "schemata"), []byte(strings.Join(schemata, "\n")+"\n"))
+	}
+	if err != nil {
+		Remove(dir)
+		return err
+	}
+	return nil
+}
+
+// Remove removes group name, returning its CPUs to the default group.
+func (r *Resctrl) Remove(name string) error {
+	return Remove(filepath.Join(r.dir, name))
+}
+
+// Groups returns the names of the groups other than the default
+// group.
+func (r *Resctrl) Groups() ([]string, error) {
+	fs, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, f := range fs {
+		switch f.Name() {
+		case "info", "mon_groups", "mon_data":
+			continue
+		}
+		if f.IsDir() {
+			groups = append(groups, f.Name())
+		}
+	}
+	return groups, nil
+}
+
+// WriteFile, Mkdir, and Remove modify the resctrl filesystem. They
+// may be replaced to perform changes from a more privileged process.
+var (
+	WriteFile = func(path string, data []byte) error {
+		return ioutil.WriteFile(path, data, 0)
+	}
+	Mkdir = func(path string) error {
+		return os.Mkdir(path, 0755)
+	}
+	Remove = os.Remove
+)
+
+func sortedIDs(m map[int]string) []int {
+	var ids []int
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func readString(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func readInt(path string) (int, error) {
+	s, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
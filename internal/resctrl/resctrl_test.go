@@ -0,0 +1,88 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resctrl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeResctrl creates a fake resctrl filesystem in dir with two L3
+// domains of 11 ways and memory bandwidth allocation.
+func writeResctrl(t *testing.T, dir string) {
+	write := func(path, data string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("schemata", "    L3:0=7ff;1=7ff\n    MB:0=100;1=100\n")
+	write("info/L3/cbm_mask", "7ff\n")
+	write("info/L3/min_cbm_bits", "1\n")
+	write("info/MB/min_bandwidth", "10\n")
+	write("info/MB/bandwidth_gran", "10\n")
+	write("mon_groups/.keep", "")
+	write("other/schemata", "")
+}
+
+func TestOpenDir(t *testing.T) {
+	dir := t.TempDir()
+	writeResctrl(t, dir)
+	r, err := OpenDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Resctrl{dir: dir, Ways: 0x7ff, MinWays: 1, L3IDs: []int{0, 1}, MinBandwidth: 10, BandwidthGran: 10, MBIDs: []int{0, 1}}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("OpenDir = %+v, want %+v", r, want)
+	}
+
+	if got, want := r.L3(0x700), "L3:0=700;1=700"; got != want {
+		t.Errorf("L3 = %q, want %q", got, want)
+	}
+	if got, want := r.MB(50), "MB:0=50;1=50"; got != want {
+		t.Errorf("MB = %q, want %q", got, want)
+	}
+	schemata, err := r.Schemata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"L3:0=7ff;1=7ff", "MB:0=100;1=100"}; !reflect.DeepEqual(schemata, want) {
+		t.Errorf("Schemata = %q, want %q", schemata, want)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	writeResctrl(t, dir)
+	r, err := OpenDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create("g", "2-3", []string{r.L3(0x600)}); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{"cpus_list": "2-3", "schemata": "L3:0=600;1=600\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, "g", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+	groups, err := r.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"g", "other"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("Groups = %q, want %q", groups, want)
+	}
+}
@@ -0,0 +1,1716 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: perflock.proto
+
+package perflockpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LockRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Action:
+	//
+	//	*LockRequest_Acquire
+	//	*LockRequest_SetGovernor
+	Action        isLockRequest_Action `protobuf_oneof:"action"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockRequest) Reset() {
+	*x = LockRequest{}
+	mi := &file_perflock_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockRequest) ProtoMessage() {}
+
+func (x *LockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockRequest.ProtoReflect.Descriptor instead.
+func (*LockRequest) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LockRequest) GetAction() isLockRequest_Action {
+	if x != nil {
+		return x.Action
+	}
+	return nil
+}
+
+func (x *LockRequest) GetAcquire() *Acquire {
+	if x != nil {
+		if x, ok := x.Action.(*LockRequest_Acquire); ok {
+			return x.Acquire
+		}
+	}
+	return nil
+}
+
+func (x *LockRequest) GetSetGovernor() *SetGovernor {
+	if x != nil {
+		if x, ok := x.Action.(*LockRequest_SetGovernor); ok {
+			return x.SetGovernor
+		}
+	}
+	return nil
+}
+
+type isLockRequest_Action interface {
+	isLockRequest_Action()
+}
+
+type LockRequest_Acquire struct {
+	Acquire *Acquire `protobuf:"bytes,1,opt,name=acquire,proto3,oneof"`
+}
+
+type LockRequest_SetGovernor struct {
+	SetGovernor *SetGovernor `protobuf:"bytes,2,opt,name=set_governor,json=setGovernor,proto3,oneof"`
+}
+
+func (*LockRequest_Acquire) isLockRequest_Action() {}
+
+func (*LockRequest_SetGovernor) isLockRequest_Action() {}
+
+type Acquire struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Shared      bool                   `protobuf:"varint,1,opt,name=shared,proto3" json:"shared,omitempty"`
+	NonBlocking bool                   `protobuf:"varint,2,opt,name=non_blocking,json=nonBlocking,proto3" json:"non_blocking,omitempty"`
+	Msg         string                 `protobuf:"bytes,3,opt,name=msg,proto3" json:"msg,omitempty"`
+	// Cores, if non-zero, is the number of cores to reserve.
+	Cores int32 `protobuf:"varint,4,opt,name=cores,proto3" json:"cores,omitempty"`
+	// Topology constrains where the reserved cores may be in the CPU
+	// topology: "" for anywhere, "same-l3" for cores sharing an L3
+	// cache, or "same-socket" for cores in one physical package.
+	Topology string `protobuf:"bytes,5,opt,name=topology,proto3" json:"topology,omitempty"`
+	// Cpus, if non-empty, lists the specific CPUs to reserve. It can't
+	// be combined with cores or topology.
+	Cpus []int32 `protobuf:"varint,6,rep,packed,name=cpus,proto3" json:"cpus,omitempty"`
+	// HugePages, if non-zero, is the number of huge pages to add to
+	// the pool while the lock is held. It requires an exclusive lock,
+	// and may not exceed the daemon's maxHugePages.
+	HugePages int32 `protobuf:"varint,7,opt,name=huge_pages,json=hugePages,proto3" json:"huge_pages,omitempty"`
+	// NoSwap sets vm.swappiness to 0 while the lock is held. It
+	// requires an exclusive lock.
+	NoSwap bool `protobuf:"varint,8,opt,name=no_swap,json=noSwap,proto3" json:"no_swap,omitempty"`
+	// Monitor acquires the lock as a monitor, which is granted
+	// immediately and neither waits for nor delays other acquisitions.
+	// It can't be combined with shared or any reservation.
+	Monitor bool `protobuf:"varint,9,opt,name=monitor,proto3" json:"monitor,omitempty"`
+	// MaxLoad, if non-zero, delays granting an exclusive lock until the
+	// host load not due to perflock drops below this many CPUs.
+	MaxLoad float64 `protobuf:"fixed64,10,opt,name=max_load,json=maxLoad,proto3" json:"max_load,omitempty"`
+	// CoresPercent, if non-zero, reserves this percentage of the
+	// reservable cores, rounded down but at least one. It can't be
+	// combined with cores or cpus.
+	CoresPercent int32 `protobuf:"varint,11,opt,name=cores_percent,json=coresPercent,proto3" json:"cores_percent,omitempty"`
+	// LockMemory keeps up to the daemon's maxLockedMemory of the memory
+	// of the client process and the children it starts from being
+	// reclaimed or swapped out while the lock is held. It requires an
+	// exclusive lock.
+	LockMemory bool `protobuf:"varint,12,opt,name=lock_memory,json=lockMemory,proto3" json:"lock_memory,omitempty"`
+	// MemoryMax, if non-zero, limits the memory, including page cache,
+	// that the client process and the children it starts may use while
+	// the lock is held, in bytes. It requires a shared lock.
+	MemoryMax int64 `protobuf:"varint,13,opt,name=memory_max,json=memoryMax,proto3" json:"memory_max,omitempty"`
+	// CpuMax, if non-zero, limits the CPU time that the client process
+	// and the children it starts may use while the lock is held, as a
+	// percentage of one CPU. It requires a shared lock.
+	CpuMax        int32 `protobuf:"varint,14,opt,name=cpu_max,json=cpuMax,proto3" json:"cpu_max,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Acquire) Reset() {
+	*x = Acquire{}
+	mi := &file_perflock_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Acquire) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Acquire) ProtoMessage() {}
+
+func (x *Acquire) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Acquire.ProtoReflect.Descriptor instead.
+func (*Acquire) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Acquire) GetShared() bool {
+	if x != nil {
+		return x.Shared
+	}
+	return false
+}
+
+func (x *Acquire) GetNonBlocking() bool {
+	if x != nil {
+		return x.NonBlocking
+	}
+	return false
+}
+
+func (x *Acquire) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+func (x *Acquire) GetCores() int32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *Acquire) GetTopology() string {
+	if x != nil {
+		return x.Topology
+	}
+	return ""
+}
+
+func (x *Acquire) GetCpus() []int32 {
+	if x != nil {
+		return x.Cpus
+	}
+	return nil
+}
+
+func (x *Acquire) GetHugePages() int32 {
+	if x != nil {
+		return x.HugePages
+	}
+	return 0
+}
+
+func (x *Acquire) GetNoSwap() bool {
+	if x != nil {
+		return x.NoSwap
+	}
+	return false
+}
+
+func (x *Acquire) GetMonitor() bool {
+	if x != nil {
+		return x.Monitor
+	}
+	return false
+}
+
+func (x *Acquire) GetMaxLoad() float64 {
+	if x != nil {
+		return x.MaxLoad
+	}
+	return 0
+}
+
+func (x *Acquire) GetCoresPercent() int32 {
+	if x != nil {
+		return x.CoresPercent
+	}
+	return 0
+}
+
+func (x *Acquire) GetLockMemory() bool {
+	if x != nil {
+		return x.LockMemory
+	}
+	return false
+}
+
+func (x *Acquire) GetMemoryMax() int64 {
+	if x != nil {
+		return x.MemoryMax
+	}
+	return 0
+}
+
+func (x *Acquire) GetCpuMax() int32 {
+	if x != nil {
+		return x.CpuMax
+	}
+	return 0
+}
+
+type SetGovernor struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Percent indicates the percent to set the CPU governor to
+	// between the lowest and highest available frequencies.
+	Percent       int32 `protobuf:"varint,1,opt,name=percent,proto3" json:"percent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetGovernor) Reset() {
+	*x = SetGovernor{}
+	mi := &file_perflock_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetGovernor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetGovernor) ProtoMessage() {}
+
+func (x *SetGovernor) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetGovernor.ProtoReflect.Descriptor instead.
+func (*SetGovernor) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetGovernor) GetPercent() int32 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+type LockResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Response:
+	//
+	//	*LockResponse_Queued
+	//	*LockResponse_Acquired
+	//	*LockResponse_NotAcquired
+	//	*LockResponse_GovernorSet
+	Response      isLockResponse_Response `protobuf_oneof:"response"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockResponse) Reset() {
+	*x = LockResponse{}
+	mi := &file_perflock_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockResponse) ProtoMessage() {}
+
+func (x *LockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockResponse.ProtoReflect.Descriptor instead.
+func (*LockResponse) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LockResponse) GetResponse() isLockResponse_Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *LockResponse) GetQueued() *Queued {
+	if x != nil {
+		if x, ok := x.Response.(*LockResponse_Queued); ok {
+			return x.Queued
+		}
+	}
+	return nil
+}
+
+func (x *LockResponse) GetAcquired() *Acquired {
+	if x != nil {
+		if x, ok := x.Response.(*LockResponse_Acquired); ok {
+			return x.Acquired
+		}
+	}
+	return nil
+}
+
+func (x *LockResponse) GetNotAcquired() *NotAcquired {
+	if x != nil {
+		if x, ok := x.Response.(*LockResponse_NotAcquired); ok {
+			return x.NotAcquired
+		}
+	}
+	return nil
+}
+
+func (x *LockResponse) GetGovernorSet() *GovernorSet {
+	if x != nil {
+		if x, ok := x.Response.(*LockResponse_GovernorSet); ok {
+			return x.GovernorSet
+		}
+	}
+	return nil
+}
+
+type isLockResponse_Response interface {
+	isLockResponse_Response()
+}
+
+type LockResponse_Queued struct {
+	Queued *Queued `protobuf:"bytes,1,opt,name=queued,proto3,oneof"`
+}
+
+type LockResponse_Acquired struct {
+	Acquired *Acquired `protobuf:"bytes,2,opt,name=acquired,proto3,oneof"`
+}
+
+type LockResponse_NotAcquired struct {
+	NotAcquired *NotAcquired `protobuf:"bytes,3,opt,name=not_acquired,json=notAcquired,proto3,oneof"`
+}
+
+type LockResponse_GovernorSet struct {
+	GovernorSet *GovernorSet `protobuf:"bytes,4,opt,name=governor_set,json=governorSet,proto3,oneof"`
+}
+
+func (*LockResponse_Queued) isLockResponse_Response() {}
+
+func (*LockResponse_Acquired) isLockResponse_Response() {}
+
+func (*LockResponse_NotAcquired) isLockResponse_Response() {}
+
+func (*LockResponse_GovernorSet) isLockResponse_Response() {}
+
+type Queued struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Position is the number of acquisitions ahead of this one in
+	// the queue.
+	Position int32 `protobuf:"varint,1,opt,name=position,proto3" json:"position,omitempty"`
+	// EtaSeconds estimates how long until the lock is acquired, based
+	// on how long earlier runs of the commands ahead held it, or is 0
+	// if there's no estimate.
+	EtaSeconds int64 `protobuf:"varint,2,opt,name=eta_seconds,json=etaSeconds,proto3" json:"eta_seconds,omitempty"`
+	// Id identifies this acquisition for Position.
+	Id            int64 `protobuf:"varint,3,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Queued) Reset() {
+	*x = Queued{}
+	mi := &file_perflock_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Queued) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Queued) ProtoMessage() {}
+
+func (x *Queued) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Queued.ProtoReflect.Descriptor instead.
+func (*Queued) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Queued) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *Queued) GetEtaSeconds() int64 {
+	if x != nil {
+		return x.EtaSeconds
+	}
+	return 0
+}
+
+func (x *Queued) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type Acquired struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Cores lists the CPUs reserved for this acquisition, if it
+	// requested cores.
+	Cores []int32 `protobuf:"varint,1,rep,packed,name=cores,proto3" json:"cores,omitempty"`
+	// Topology describes where the reserved cores are in the CPU
+	// topology, if known.
+	Topology string `protobuf:"bytes,2,opt,name=topology,proto3" json:"topology,omitempty"`
+	// Affinity lists the CPUs the caller's command should be
+	// restricted to, or is empty if it is unrestricted.
+	Affinity []int32 `protobuf:"varint,3,rep,packed,name=affinity,proto3" json:"affinity,omitempty"`
+	// Warnings describes problems preparing the system for this
+	// acquisition, such as a failed hook.
+	Warnings      []string `protobuf:"bytes,4,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Acquired) Reset() {
+	*x = Acquired{}
+	mi := &file_perflock_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Acquired) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Acquired) ProtoMessage() {}
+
+func (x *Acquired) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Acquired.ProtoReflect.Descriptor instead.
+func (*Acquired) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Acquired) GetCores() []int32 {
+	if x != nil {
+		return x.Cores
+	}
+	return nil
+}
+
+func (x *Acquired) GetTopology() string {
+	if x != nil {
+		return x.Topology
+	}
+	return ""
+}
+
+func (x *Acquired) GetAffinity() []int32 {
+	if x != nil {
+		return x.Affinity
+	}
+	return nil
+}
+
+func (x *Acquired) GetWarnings() []string {
+	if x != nil {
+		return x.Warnings
+	}
+	return nil
+}
+
+// NotAcquired is returned for a non-blocking acquire that could not
+// take the lock immediately.
+type NotAcquired struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NotAcquired) Reset() {
+	*x = NotAcquired{}
+	mi := &file_perflock_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NotAcquired) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NotAcquired) ProtoMessage() {}
+
+func (x *NotAcquired) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NotAcquired.ProtoReflect.Descriptor instead.
+func (*NotAcquired) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{6}
+}
+
+type GovernorSet struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Error is empty if the governor was set successfully.
+	Error         string `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GovernorSet) Reset() {
+	*x = GovernorSet{}
+	mi := &file_perflock_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GovernorSet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GovernorSet) ProtoMessage() {}
+
+func (x *GovernorSet) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GovernorSet.ProtoReflect.Descriptor instead.
+func (*GovernorSet) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GovernorSet) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_perflock_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{8}
+}
+
+type ListResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Entries describes each acquisition and reservation as a line of
+	// perflock -list output.
+	Entries []string `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	// Items describes the same acquisitions and reservations as
+	// Entries, in structured form.
+	Items         []*ListEntry `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_perflock_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListResponse) GetEntries() []string {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *ListResponse) GetItems() []*ListEntry {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type ListEntry struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Id identifies the acquisition or reservation.
+	Id      int64  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	User    string `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Command string `protobuf:"bytes,3,opt,name=command,proto3" json:"command,omitempty"`
+	// EnqueuedUnix is when the acquisition or reservation was made, in
+	// seconds since the Unix epoch.
+	EnqueuedUnix int64 `protobuf:"varint,4,opt,name=enqueued_unix,json=enqueuedUnix,proto3" json:"enqueued_unix,omitempty"`
+	// Shared indicates a shared acquisition.
+	Shared bool `protobuf:"varint,5,opt,name=shared,proto3" json:"shared,omitempty"`
+	// Held indicates that the acquisition holds the lock, rather than
+	// waiting for it.
+	Held bool `protobuf:"varint,6,opt,name=held,proto3" json:"held,omitempty"`
+	// Job indicates that the acquisition is for a batch job.
+	Job bool `protobuf:"varint,7,opt,name=job,proto3" json:"job,omitempty"`
+	// Cores, topology, and cpus are the acquisition's request.
+	Cores    int32   `protobuf:"varint,8,opt,name=cores,proto3" json:"cores,omitempty"`
+	Topology string  `protobuf:"bytes,9,opt,name=topology,proto3" json:"topology,omitempty"`
+	Cpus     []int32 `protobuf:"varint,10,rep,packed,name=cpus,proto3" json:"cpus,omitempty"`
+	// Reservation indicates that this is a reservation of the exclusive
+	// lock from start_unix to end_unix, rather than an acquisition.
+	Reservation bool  `protobuf:"varint,11,opt,name=reservation,proto3" json:"reservation,omitempty"`
+	StartUnix   int64 `protobuf:"varint,12,opt,name=start_unix,json=startUnix,proto3" json:"start_unix,omitempty"`
+	EndUnix     int64 `protobuf:"varint,13,opt,name=end_unix,json=endUnix,proto3" json:"end_unix,omitempty"`
+	// Monitor indicates a monitor acquisition, which always holds the
+	// lock.
+	Monitor bool `protobuf:"varint,14,opt,name=monitor,proto3" json:"monitor,omitempty"`
+	// Assigned lists the CPUs reserved for the acquisition, if it holds
+	// the lock and requested cores.
+	Assigned      []int32 `protobuf:"varint,15,rep,packed,name=assigned,proto3" json:"assigned,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEntry) Reset() {
+	*x = ListEntry{}
+	mi := &file_perflock_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEntry) ProtoMessage() {}
+
+func (x *ListEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEntry.ProtoReflect.Descriptor instead.
+func (*ListEntry) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ListEntry) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *ListEntry) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ListEntry) GetEnqueuedUnix() int64 {
+	if x != nil {
+		return x.EnqueuedUnix
+	}
+	return 0
+}
+
+func (x *ListEntry) GetShared() bool {
+	if x != nil {
+		return x.Shared
+	}
+	return false
+}
+
+func (x *ListEntry) GetHeld() bool {
+	if x != nil {
+		return x.Held
+	}
+	return false
+}
+
+func (x *ListEntry) GetJob() bool {
+	if x != nil {
+		return x.Job
+	}
+	return false
+}
+
+func (x *ListEntry) GetCores() int32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *ListEntry) GetTopology() string {
+	if x != nil {
+		return x.Topology
+	}
+	return ""
+}
+
+func (x *ListEntry) GetCpus() []int32 {
+	if x != nil {
+		return x.Cpus
+	}
+	return nil
+}
+
+func (x *ListEntry) GetReservation() bool {
+	if x != nil {
+		return x.Reservation
+	}
+	return false
+}
+
+func (x *ListEntry) GetStartUnix() int64 {
+	if x != nil {
+		return x.StartUnix
+	}
+	return 0
+}
+
+func (x *ListEntry) GetEndUnix() int64 {
+	if x != nil {
+		return x.EndUnix
+	}
+	return 0
+}
+
+func (x *ListEntry) GetMonitor() bool {
+	if x != nil {
+		return x.Monitor
+	}
+	return false
+}
+
+func (x *ListEntry) GetAssigned() []int32 {
+	if x != nil {
+		return x.Assigned
+	}
+	return nil
+}
+
+type QueryPowerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryPowerRequest) Reset() {
+	*x = QueryPowerRequest{}
+	mi := &file_perflock_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryPowerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryPowerRequest) ProtoMessage() {}
+
+func (x *QueryPowerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryPowerRequest.ProtoReflect.Descriptor instead.
+func (*QueryPowerRequest) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{11}
+}
+
+type QueryPowerResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Error, if non-empty, is why the daemon can't control CPU
+	// frequency.
+	Error string `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	// Driver is the CPU frequency scaling driver.
+	Driver string `protobuf:"bytes,2,opt,name=driver,proto3" json:"driver,omitempty"`
+	// Boost indicates whether CPU boost (turbo) can be controlled.
+	Boost bool `protobuf:"varint,3,opt,name=boost,proto3" json:"boost,omitempty"`
+	// Governors lists the available CPU frequency governors.
+	Governors     []string       `protobuf:"bytes,4,rep,name=governors,proto3" json:"governors,omitempty"`
+	Domains       []*PowerDomain `protobuf:"bytes,5,rep,name=domains,proto3" json:"domains,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryPowerResponse) Reset() {
+	*x = QueryPowerResponse{}
+	mi := &file_perflock_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryPowerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryPowerResponse) ProtoMessage() {}
+
+func (x *QueryPowerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryPowerResponse.ProtoReflect.Descriptor instead.
+func (*QueryPowerResponse) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *QueryPowerResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *QueryPowerResponse) GetDriver() string {
+	if x != nil {
+		return x.Driver
+	}
+	return ""
+}
+
+func (x *QueryPowerResponse) GetBoost() bool {
+	if x != nil {
+		return x.Boost
+	}
+	return false
+}
+
+func (x *QueryPowerResponse) GetGovernors() []string {
+	if x != nil {
+		return x.Governors
+	}
+	return nil
+}
+
+func (x *QueryPowerResponse) GetDomains() []*PowerDomain {
+	if x != nil {
+		return x.Domains
+	}
+	return nil
+}
+
+// PowerDomain is a single frequency scaling domain.
+type PowerDomain struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Cpus lists the CPUs in this domain.
+	Cpus string `protobuf:"bytes,1,opt,name=cpus,proto3" json:"cpus,omitempty"`
+	// Min and max are the lowest and highest frequencies, in kHz.
+	Min int32 `protobuf:"varint,2,opt,name=min,proto3" json:"min,omitempty"`
+	Max int32 `protobuf:"varint,3,opt,name=max,proto3" json:"max,omitempty"`
+	// Available lists the frequencies that can be set, or is empty if
+	// any frequency between min and max can be set.
+	Available     []int32 `protobuf:"varint,4,rep,packed,name=available,proto3" json:"available,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PowerDomain) Reset() {
+	*x = PowerDomain{}
+	mi := &file_perflock_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PowerDomain) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PowerDomain) ProtoMessage() {}
+
+func (x *PowerDomain) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PowerDomain.ProtoReflect.Descriptor instead.
+func (*PowerDomain) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *PowerDomain) GetCpus() string {
+	if x != nil {
+		return x.Cpus
+	}
+	return ""
+}
+
+func (x *PowerDomain) GetMin() int32 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *PowerDomain) GetMax() int32 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *PowerDomain) GetAvailable() []int32 {
+	if x != nil {
+		return x.Available
+	}
+	return nil
+}
+
+type PositionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PositionRequest) Reset() {
+	*x = PositionRequest{}
+	mi := &file_perflock_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PositionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PositionRequest) ProtoMessage() {}
+
+func (x *PositionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PositionRequest.ProtoReflect.Descriptor instead.
+func (*PositionRequest) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PositionRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type PositionResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Acquired indicates that the acquisition holds the lock.
+	Acquired bool `protobuf:"varint,1,opt,name=acquired,proto3" json:"acquired,omitempty"`
+	// Position is the number of acquisitions ahead of this one, or -1
+	// if it is acquired.
+	Position int32 `protobuf:"varint,2,opt,name=position,proto3" json:"position,omitempty"`
+	// EtaSeconds estimates how long until the lock is acquired, or is
+	// 0 if there's no estimate.
+	EtaSeconds int64 `protobuf:"varint,3,opt,name=eta_seconds,json=etaSeconds,proto3" json:"eta_seconds,omitempty"`
+	// Msg is the queue entry describing the acquisition.
+	Msg string `protobuf:"bytes,4,opt,name=msg,proto3" json:"msg,omitempty"`
+	// Shared, cores, topology, and cpus are the acquisition's request.
+	Shared   bool    `protobuf:"varint,5,opt,name=shared,proto3" json:"shared,omitempty"`
+	Cores    int32   `protobuf:"varint,6,opt,name=cores,proto3" json:"cores,omitempty"`
+	Topology string  `protobuf:"bytes,7,opt,name=topology,proto3" json:"topology,omitempty"`
+	Cpus     []int32 `protobuf:"varint,8,rep,packed,name=cpus,proto3" json:"cpus,omitempty"`
+	// Free lists the reservable CPUs that aren't currently reserved.
+	Free          []int32 `protobuf:"varint,9,rep,packed,name=free,proto3" json:"free,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PositionResponse) Reset() {
+	*x = PositionResponse{}
+	mi := &file_perflock_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PositionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PositionResponse) ProtoMessage() {}
+
+func (x *PositionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PositionResponse.ProtoReflect.Descriptor instead.
+func (*PositionResponse) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *PositionResponse) GetAcquired() bool {
+	if x != nil {
+		return x.Acquired
+	}
+	return false
+}
+
+func (x *PositionResponse) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *PositionResponse) GetEtaSeconds() int64 {
+	if x != nil {
+		return x.EtaSeconds
+	}
+	return 0
+}
+
+func (x *PositionResponse) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+func (x *PositionResponse) GetShared() bool {
+	if x != nil {
+		return x.Shared
+	}
+	return false
+}
+
+func (x *PositionResponse) GetCores() int32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *PositionResponse) GetTopology() string {
+	if x != nil {
+		return x.Topology
+	}
+	return ""
+}
+
+func (x *PositionResponse) GetCpus() []int32 {
+	if x != nil {
+		return x.Cpus
+	}
+	return nil
+}
+
+func (x *PositionResponse) GetFree() []int32 {
+	if x != nil {
+		return x.Free
+	}
+	return nil
+}
+
+type StatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatRequest) Reset() {
+	*x = StatRequest{}
+	mi := &file_perflock_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatRequest) ProtoMessage() {}
+
+func (x *StatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatRequest.ProtoReflect.Descriptor instead.
+func (*StatRequest) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{16}
+}
+
+type StatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UptimeSeconds float64                `protobuf:"fixed64,1,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	// Acquisitions is the number of times the lock has been acquired.
+	Acquisitions int64 `protobuf:"varint,2,opt,name=acquisitions,proto3" json:"acquisitions,omitempty"`
+	// Held and waiting are the number of acquisitions currently
+	// holding and waiting for the lock.
+	Held    int32 `protobuf:"varint,3,opt,name=held,proto3" json:"held,omitempty"`
+	Waiting int32 `protobuf:"varint,4,opt,name=waiting,proto3" json:"waiting,omitempty"`
+	// Wait and hold summarize how long recent acquisitions waited for
+	// and held the lock.
+	Wait *DurationStats `protobuf:"bytes,5,opt,name=wait,proto3" json:"wait,omitempty"`
+	Hold *DurationStats `protobuf:"bytes,6,opt,name=hold,proto3" json:"hold,omitempty"`
+	// Governor_errors is the number of times setting or restoring the
+	// CPU governor failed.
+	GovernorErrors int64 `protobuf:"varint,7,opt,name=governor_errors,json=governorErrors,proto3" json:"governor_errors,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *StatResponse) Reset() {
+	*x = StatResponse{}
+	mi := &file_perflock_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatResponse) ProtoMessage() {}
+
+func (x *StatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatResponse.ProtoReflect.Descriptor instead.
+func (*StatResponse) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *StatResponse) GetUptimeSeconds() float64 {
+	if x != nil {
+		return x.UptimeSeconds
+	}
+	return 0
+}
+
+func (x *StatResponse) GetAcquisitions() int64 {
+	if x != nil {
+		return x.Acquisitions
+	}
+	return 0
+}
+
+func (x *StatResponse) GetHeld() int32 {
+	if x != nil {
+		return x.Held
+	}
+	return 0
+}
+
+func (x *StatResponse) GetWaiting() int32 {
+	if x != nil {
+		return x.Waiting
+	}
+	return 0
+}
+
+func (x *StatResponse) GetWait() *DurationStats {
+	if x != nil {
+		return x.Wait
+	}
+	return nil
+}
+
+func (x *StatResponse) GetHold() *DurationStats {
+	if x != nil {
+		return x.Hold
+	}
+	return nil
+}
+
+func (x *StatResponse) GetGovernorErrors() int64 {
+	if x != nil {
+		return x.GovernorErrors
+	}
+	return 0
+}
+
+// DurationStats summarizes a set of durations.
+type DurationStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	N             int32                  `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	MeanSeconds   float64                `protobuf:"fixed64,2,opt,name=mean_seconds,json=meanSeconds,proto3" json:"mean_seconds,omitempty"`
+	P50Seconds    float64                `protobuf:"fixed64,3,opt,name=p50_seconds,json=p50Seconds,proto3" json:"p50_seconds,omitempty"`
+	P90Seconds    float64                `protobuf:"fixed64,4,opt,name=p90_seconds,json=p90Seconds,proto3" json:"p90_seconds,omitempty"`
+	P99Seconds    float64                `protobuf:"fixed64,5,opt,name=p99_seconds,json=p99Seconds,proto3" json:"p99_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DurationStats) Reset() {
+	*x = DurationStats{}
+	mi := &file_perflock_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DurationStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DurationStats) ProtoMessage() {}
+
+func (x *DurationStats) ProtoReflect() protoreflect.Message {
+	mi := &file_perflock_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DurationStats.ProtoReflect.Descriptor instead.
+func (*DurationStats) Descriptor() ([]byte, []int) {
+	return file_perflock_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DurationStats) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+func (x *DurationStats) GetMeanSeconds() float64 {
+	if x != nil {
+		return x.MeanSeconds
+	}
+	return 0
+}
+
+func (x *DurationStats) GetP50Seconds() float64 {
+	if x != nil {
+		return x.P50Seconds
+	}
+	return 0
+}
+
+func (x *DurationStats) GetP90Seconds() float64 {
+	if x != nil {
+		return x.P90Seconds
+	}
+	return 0
+}
+
+func (x *DurationStats) GetP99Seconds() float64 {
+	if x != nil {
+		return x.P99Seconds
+	}
+	return 0
+}
+
+var File_perflock_proto protoreflect.FileDescriptor
+
+const file_perflock_proto_rawDesc = "" +
+	"\n" +
+	"\x0eperflock.proto\x12\bperflock\"\x82\x01\n" +
+	"\vLockRequest\x12-\n" +
+	"\aacquire\x18\x01 \x01(\v2\x11.perflock.AcquireH\x00R\aacquire\x12:\n" +
+	"\fset_governor\x18\x02 \x01(\v2\x15.perflock.SetGovernorH\x00R\vsetGovernorB\b\n" +
+	"\x06action\"\x87\x03\n" +
+	"\aAcquire\x12\x16\n" +
+	"\x06shared\x18\x01 \x01(\bR\x06shared\x12!\n" +
+	"\fnon_blocking\x18\x02 \x01(\bR\vnonBlocking\x12\x10\n" +
+	"\x03msg\x18\x03 \x01(\tR\x03msg\x12\x14\n" +
+	"\x05cores\x18\x04 \x01(\x05R\x05cores\x12\x1a\n" +
+	"\btopology\x18\x05 \x01(\tR\btopology\x12\x12\n" +
+	"\x04cpus\x18\x06 \x03(\x05R\x04cpus\x12\x1d\n" +
+	"\n" +
+	"huge_pages\x18\a \x01(\x05R\thugePages\x12\x17\n" +
+	"\ano_swap\x18\b \x01(\bR\x06noSwap\x12\x18\n" +
+	"\amonitor\x18\t \x01(\bR\amonitor\x12\x19\n" +
+	"\bmax_load\x18\n" +
+	" \x01(\x01R\amaxLoad\x12#\n" +
+	"\rcores_percent\x18\v \x01(\x05R\fcoresPercent\x12\x1f\n" +
+	"\vlock_memory\x18\f \x01(\bR\n" +
+	"lockMemory\x12\x1d\n" +
+	"\n" +
+	"memory_max\x18\r \x01(\x03R\tmemoryMax\x12\x17\n" +
+	"\acpu_max\x18\x0e \x01(\x05R\x06cpuMax\"'\n" +
+	"\vSetGovernor\x12\x18\n" +
+	"\apercent\x18\x01 \x01(\x05R\apercent\"\xf0\x01\n" +
+	"\fLockResponse\x12*\n" +
+	"\x06queued\x18\x01 \x01(\v2\x10.perflock.QueuedH\x00R\x06queued\x120\n" +
+	"\bacquired\x18\x02 \x01(\v2\x12.perflock.AcquiredH\x00R\bacquired\x12:\n" +
+	"\fnot_acquired\x18\x03 \x01(\v2\x15.perflock.NotAcquiredH\x00R\vnotAcquired\x12:\n" +
+	"\fgovernor_set\x18\x04 \x01(\v2\x15.perflock.GovernorSetH\x00R\vgovernorSetB\n" +
+	"\n" +
+	"\bresponse\"U\n" +
+	"\x06Queued\x12\x1a\n" +
+	"\bposition\x18\x01 \x01(\x05R\bposition\x12\x1f\n" +
+	"\veta_seconds\x18\x02 \x01(\x03R\n" +
+	"etaSeconds\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\x03R\x02id\"t\n" +
+	"\bAcquired\x12\x14\n" +
+	"\x05cores\x18\x01 \x03(\x05R\x05cores\x12\x1a\n" +
+	"\btopology\x18\x02 \x01(\tR\btopology\x12\x1a\n" +
+	"\baffinity\x18\x03 \x03(\x05R\baffinity\x12\x1a\n" +
+	"\bwarnings\x18\x04 \x03(\tR\bwarnings\"\r\n" +
+	"\vNotAcquired\"#\n" +
+	"\vGovernorSet\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\"\r\n" +
+	"\vListRequest\"S\n" +
+	"\fListResponse\x12\x18\n" +
+	"\aentries\x18\x01 \x03(\tR\aentries\x12)\n" +
+	"\x05items\x18\x02 \x03(\v2\x13.perflock.ListEntryR\x05items\"\x84\x03\n" +
+	"\tListEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x18\n" +
+	"\acommand\x18\x03 \x01(\tR\acommand\x12#\n" +
+	"\renqueued_unix\x18\x04 \x01(\x03R\fenqueuedUnix\x12\x16\n" +
+	"\x06shared\x18\x05 \x01(\bR\x06shared\x12\x12\n" +
+	"\x04held\x18\x06 \x01(\bR\x04held\x12\x10\n" +
+	"\x03job\x18\a \x01(\bR\x03job\x12\x14\n" +
+	"\x05cores\x18\b \x01(\x05R\x05cores\x12\x1a\n" +
+	"\btopology\x18\t \x01(\tR\btopology\x12\x12\n" +
+	"\x04cpus\x18\n" +
+	" \x03(\x05R\x04cpus\x12 \n" +
+	"\vreservation\x18\v \x01(\bR\vreservation\x12\x1d\n" +
+	"\n" +
+	"start_unix\x18\f \x01(\x03R\tstartUnix\x12\x19\n" +
+	"\bend_unix\x18\r \x01(\x03R\aendUnix\x12\x18\n" +
+	"\amonitor\x18\x0e \x01(\bR\amonitor\x12\x1a\n" +
+	"\bassigned\x18\x0f \x03(\x05R\bassigned\"\x13\n" +
+	"\x11QueryPowerRequest\"\xa7\x01\n" +
+	"\x12QueryPowerResponse\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x12\x16\n" +
+	"\x06driver\x18\x02 \x01(\tR\x06driver\x12\x14\n" +
+	"\x05boost\x18\x03 \x01(\bR\x05boost\x12\x1c\n" +
+	"\tgovernors\x18\x04 \x03(\tR\tgovernors\x12/\n" +
+	"\adomains\x18\x05 \x03(\v2\x15.perflock.PowerDomainR\adomains\"c\n" +
+	"\vPowerDomain\x12\x12\n" +
+	"\x04cpus\x18\x01 \x01(\tR\x04cpus\x12\x10\n" +
+	"\x03min\x18\x02 \x01(\x05R\x03min\x12\x10\n" +
+	"\x03max\x18\x03 \x01(\x05R\x03max\x12\x1c\n" +
+	"\tavailable\x18\x04 \x03(\x05R\tavailable\"!\n" +
+	"\x0fPositionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\xef\x01\n" +
+	"\x10PositionResponse\x12\x1a\n" +
+	"\bacquired\x18\x01 \x01(\bR\bacquired\x12\x1a\n" +
+	"\bposition\x18\x02 \x01(\x05R\bposition\x12\x1f\n" +
+	"\veta_seconds\x18\x03 \x01(\x03R\n" +
+	"etaSeconds\x12\x10\n" +
+	"\x03msg\x18\x04 \x01(\tR\x03msg\x12\x16\n" +
+	"\x06shared\x18\x05 \x01(\bR\x06shared\x12\x14\n" +
+	"\x05cores\x18\x06 \x01(\x05R\x05cores\x12\x1a\n" +
+	"\btopology\x18\a \x01(\tR\btopology\x12\x12\n" +
+	"\x04cpus\x18\b \x03(\x05R\x04cpus\x12\x12\n" +
+	"\x04free\x18\t \x03(\x05R\x04free\"\r\n" +
+	"\vStatRequest\"\x8a\x02\n" +
+	"\fStatResponse\x12%\n" +
+	"\x0euptime_seconds\x18\x01 \x01(\x01R\ruptimeSeconds\x12\"\n" +
+	"\facquisitions\x18\x02 \x01(\x03R\facquisitions\x12\x12\n" +
+	"\x04held\x18\x03 \x01(\x05R\x04held\x12\x18\n" +
+	"\awaiting\x18\x04 \x01(\x05R\awaiting\x12+\n" +
+	"\x04wait\x18\x05 \x01(\v2\x17.perflock.DurationStatsR\x04wait\x12+\n" +
+	"\x04hold\x18\x06 \x01(\v2\x17.perflock.DurationStatsR\x04hold\x12'\n" +
+	"\x0fgovernor_errors\x18\a \x01(\x03R\x0egovernorErrors\"\xa3\x01\n" +
+	"\rDurationStats\x12\f\n" +
+	"\x01n\x18\x01 \x01(\x05R\x01n\x12!\n" +
+	"\fmean_seconds\x18\x02 \x01(\x01R\vmeanSeconds\x12\x1f\n" +
+	"\vp50_seconds\x18\x03 \x01(\x01R\n" +
+	"p50Seconds\x12\x1f\n" +
+	"\vp90_seconds\x18\x04 \x01(\x01R\n" +
+	"p90Seconds\x12\x1f\n" +
+	"\vp99_seconds\x18\x05 \x01(\x01R\n" +
+	"p99Seconds2\xfd\x02\n" +
+	"\bPerfLock\x129\n" +
+	"\x04Lock\x12\x15.perflock.LockRequest\x1a\x16.perflock.LockResponse(\x010\x01\x125\n" +
+	"\x04List\x12\x15.perflock.ListRequest\x1a\x16.perflock.ListResponse\x12<\n" +
+	"\tSubscribe\x12\x15.perflock.ListRequest\x1a\x16.perflock.ListResponse0\x01\x12G\n" +
+	"\n" +
+	"QueryPower\x12\x1b.perflock.QueryPowerRequest\x1a\x1c.perflock.QueryPowerResponse\x12A\n" +
+	"\bPosition\x12\x19.perflock.PositionRequest\x1a\x1a.perflock.PositionResponse\x125\n" +
+	"\x04Stat\x12\x15.perflock.StatRequest\x1a\x16.perflock.StatResponseB*Z(github.com/aclements/perflock/perflockpbb\x06proto3"
+
+var (
+	file_perflock_proto_rawDescOnce sync.Once
+	file_perflock_proto_rawDescData []byte
+)
+
+func file_perflock_proto_rawDescGZIP() []byte {
+	file_perflock_proto_rawDescOnce.Do(func() {
+		file_perflock_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_perflock_proto_rawDesc), len(file_perflock_proto_rawDesc)))
+	})
+	return file_perflock_proto_rawDescData
+}
+
+var file_perflock_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_perflock_proto_goTypes = []any{
+	(*LockRequest)(nil),        // 0: perflock.LockRequest
+	(*Acquire)(nil),            // 1: perflock.Acquire
+	(*SetGovernor)(nil),        // 2: perflock.SetGovernor
+	(*LockResponse)(nil),       // 3: perflock.LockResponse
+	(*Queued)(nil),             // 4: perflock.Queued
+	(*Acquired)(nil),           // 5: perflock.Acquired
+	(*NotAcquired)(nil),        // 6: perflock.NotAcquired
+	(*GovernorSet)(nil),        // 7: perflock.GovernorSet
+	(*ListRequest)(nil),        // 8: perflock.ListRequest
+	(*ListResponse)(nil),       // 9: perflock.ListResponse
+	(*ListEntry)(nil),          // 10: perflock.ListEntry
+	(*QueryPowerRequest)(nil),  // 11: perflock.QueryPowerRequest
+	(*QueryPowerResponse)(nil), // 12: perflock.QueryPowerResponse
+	(*PowerDomain)(nil),        // 13: perflock.PowerDomain
+	(*PositionRequest)(nil),    // 14: perflock.PositionRequest
+	(*PositionResponse)(nil),   // 15: perflock.PositionResponse
+	(*StatRequest)(nil),        // 16: perflock.StatRequest
+	(*StatResponse)(nil),       // 17: perflock.StatResponse
+	(*DurationStats)(nil),      // 18: perflock.DurationStats
+}
+var file_perflock_proto_depIdxs = []int32{
+	1,  // 0: perflock.LockRequest.acquire:type_name -> perflock.Acquire
+	2,  // 1: perflock.LockRequest.set_governor:type_name -> perflock.SetGovernor
+	4,  // 2: perflock.LockResponse.queued:type_name -> perflock.Queued
+	5,  // 3: perflock.LockResponse.acquired:type_name -> perflock.Acquired
+	6,  // 4: perflock.LockResponse.not_acquired:type_name -> perflock.NotAcquired
+	7,  // 5: perflock.LockResponse.governor_set:type_name -> perflock.GovernorSet
+	10, // 6: perflock.ListResponse.items:type_name -> perflock.ListEntry
+	13, // 7: perflock.QueryPowerResponse.domains:type_name -> perflock.PowerDomain
+	18, // 8: perflock.StatResponse.wait:type_name -> perflock.DurationStats
+	18, // 9: perflock.StatResponse.hold:type_name -> perflock.DurationStats
+	0,  // 10: perflock.PerfLock.Lock:input_type -> perflock.LockRequest
+	8,  // 11: perflock.PerfLock.List:input_type -> perflock.ListRequest
+	8,  // 12: perflock.PerfLock.Subscribe:input_type -> perflock.ListRequest
+	11, // 13: perflock.PerfLock.QueryPower:input_type -> perflock.QueryPowerRequest
+	14, // 14: perflock.PerfLock.Position:input_type -> perflock.PositionRequest
+	16, // 15: perflock.PerfLock.Stat:input_type -> perflock.StatRequest
+	3,  // 16: perflock.PerfLock.Lock:output_type -> perflock.LockResponse
+	9,  // 17: perflock.PerfLock.List:output_type -> perflock.ListResponse
+	9,  // 18: perflock.PerfLock.Subscribe:output_type -> perflock.ListResponse
+	12, // 19: perflock.PerfLock.QueryPower:output_type -> perflock.QueryPowerResponse
+	15, // 20: perflock.PerfLock.Position:output_type -> perflock.PositionResponse
+	17, // 21: perflock.PerfLock.Stat:output_type -> perflock.StatResponse
+	16, // [16:22] is the sub-list for method output_type
+	10, // [10:16] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_perflock_proto_init() }
+func file_perflock_proto_init() {
+	if File_perflock_proto != nil {
+		return
+	}
+	file_perflock_proto_msgTypes[0].OneofWrappers = []any{
+		(*LockRequest_Acquire)(nil),
+		(*LockRequest_SetGovernor)(nil),
+	}
+	file_perflock_proto_msgTypes[3].OneofWrappers = []any{
+		(*LockResponse_Queued)(nil),
+		(*LockResponse_Acquired)(nil),
+		(*LockResponse_NotAcquired)(nil),
+		(*LockResponse_GovernorSet)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_perflock_proto_rawDesc), len(file_perflock_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_perflock_proto_goTypes,
+		DependencyIndexes: file_perflock_proto_depIdxs,
+		MessageInfos:      file_perflock_proto_msgTypes,
+	}.Build()
+	File_perflock_proto = out.File
+	file_perflock_proto_goTypes = nil
+	file_perflock_proto_depIdxs = nil
+}
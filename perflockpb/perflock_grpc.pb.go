@@ -0,0 +1,347 @@
+// Copyright 2026 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: perflock.proto
+
+package perflockpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PerfLock_Lock_FullMethodName       = "/perflock.PerfLock/Lock"
+	PerfLock_List_FullMethodName       = "/perflock.PerfLock/List"
+	PerfLock_Subscribe_FullMethodName  = "/perflock.PerfLock/Subscribe"
+	PerfLock_QueryPower_FullMethodName = "/perflock.PerfLock/QueryPower"
+	PerfLock_Position_FullMethodName   = "/perflock.PerfLock/Position"
+	PerfLock_Stat_FullMethodName       = "/perflock.PerfLock/Stat"
+)
+
+// PerfLockClient is the client API for PerfLock service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PerfLock is the gRPC interface to the perflock daemon. It exposes
+// the same operations as the daemon's UNIX domain socket protocol.
+type PerfLockClient interface {
+	// Lock acquires the lock and holds it for the lifetime of the
+	// stream. The first request must be an Acquire. While waiting,
+	// the server streams Queued responses as the caller's position in
+	// the queue changes and periodically as its ETA changes, followed by a single Acquired or NotAcquired
+	// response. Once the lock is held, the caller may send
+	// SetGovernor requests. Closing the stream releases the lock.
+	Lock(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LockRequest, LockResponse], error)
+	// List returns the current and pending lock acquisitions.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Subscribe streams the current and pending lock acquisitions
+	// every time they change, starting with the current state.
+	Subscribe(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListResponse], error)
+	// QueryPower returns the CPU frequency scaling capabilities of the
+	// host.
+	QueryPower(ctx context.Context, in *QueryPowerRequest, opts ...grpc.CallOption) (*QueryPowerResponse, error)
+	// Position returns the state of a pending or current acquisition,
+	// identified by the id in its Queued responses.
+	Position(ctx context.Context, in *PositionRequest, opts ...grpc.CallOption) (*PositionResponse, error)
+	// Stat returns statistics about the daemon.
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error)
+}
+
+type perfLockClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPerfLockClient(cc grpc.ClientConnInterface) PerfLockClient {
+	return &perfLockClient{cc}
+}
+
+func (c *perfLockClient) Lock(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LockRequest, LockResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PerfLock_ServiceDesc.Streams[0], PerfLock_Lock_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LockRequest, LockResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PerfLock_LockClient = grpc.BidiStreamingClient[LockRequest, LockResponse]
+
+func (c *perfLockClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, PerfLock_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *perfLockClient) Subscribe(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PerfLock_ServiceDesc.Streams[1], PerfLock_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, ListResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PerfLock_SubscribeClient = grpc.ServerStreamingClient[ListResponse]
+
+func (c *perfLockClient) QueryPower(ctx context.Context, in *QueryPowerRequest, opts ...grpc.CallOption) (*QueryPowerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryPowerResponse)
+	err := c.cc.Invoke(ctx, PerfLock_QueryPower_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *perfLockClient) Position(ctx context.Context, in *PositionRequest, opts ...grpc.CallOption) (*PositionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PositionResponse)
+	err := c.cc.Invoke(ctx, PerfLock_Position_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *perfLockClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatResponse)
+	err := c.cc.Invoke(ctx, PerfLock_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PerfLockServer is the server API for PerfLock service.
+// All implementations must embed UnimplementedPerfLockServer
+// for forward compatibility.
+//
+// PerfLock is the gRPC interface to the perflock daemon. It exposes
+// the same operations as the daemon's UNIX domain socket protocol.
+type PerfLockServer interface {
+	// Lock acquires the lock and holds it for the lifetime of the
+	// stream. The first request must be an Acquire. While waiting,
+	// the server streams Queued responses as the caller's position in
+	// the queue changes and periodically as its ETA changes, followed by a single Acquired or NotAcquired
+	// response. Once the lock is held, the caller may send
+	// SetGovernor requests. Closing the stream releases the lock.
+	Lock(grpc.BidiStreamingServer[LockRequest, LockResponse]) error
+	// List returns the current and pending lock acquisitions.
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Subscribe streams the current and pending lock acquisitions
+	// every time they change, starting with the current state.
+	Subscribe(*ListRequest, grpc.ServerStreamingServer[ListResponse]) error
+	// QueryPower returns the CPU frequency scaling capabilities of the
+	// host.
+	QueryPower(context.Context, *QueryPowerRequest) (*QueryPowerResponse, error)
+	// Position returns the state of a pending or current acquisition,
+	// identified by the id in its Queued responses.
+	Position(context.Context, *PositionRequest) (*PositionResponse, error)
+	// Stat returns statistics about the daemon.
+	Stat(context.Context, *StatRequest) (*StatResponse, error)
+	mustEmbedUnimplementedPerfLockServer()
+}
+
+// UnimplementedPerfLockServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPerfLockServer struct{}
+
+func (UnimplementedPerfLockServer) Lock(grpc.BidiStreamingServer[LockRequest, LockResponse]) error {
+	return status.Error(codes.Unimplemented, "method Lock not implemented")
+}
+func (UnimplementedPerfLockServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedPerfLockServer) Subscribe(*ListRequest, grpc.ServerStreamingServer[ListResponse]) error {
+	return status.Error(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedPerfLockServer) QueryPower(context.Context, *QueryPowerRequest) (*QueryPowerResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method QueryPower not implemented")
+}
+func (UnimplementedPerfLockServer) Position(context.Context, *PositionRequest) (*PositionResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Position not implemented")
+}
+func (UnimplementedPerfLockServer) Stat(context.Context, *StatRequest) (*StatResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedPerfLockServer) mustEmbedUnimplementedPerfLockServer() {}
+func (UnimplementedPerfLockServer) testEmbeddedByValue()                  {}
+
+// UnsafePerfLockServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PerfLockServer will
+// result in compilation errors.
+type UnsafePerfLockServer interface {
+	mustEmbedUnimplementedPerfLockServer()
+}
+
+func RegisterPerfLockServer(s grpc.ServiceRegistrar, srv PerfLockServer) {
+	// If the following call panics, it indicates UnimplementedPerfLockServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PerfLock_ServiceDesc, srv)
+}
+
+func _PerfLock_Lock_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PerfLockServer).Lock(&grpc.GenericServerStream[LockRequest, LockResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PerfLock_LockServer = grpc.BidiStreamingServer[LockRequest, LockResponse]
+
+func _PerfLock_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PerfLockServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PerfLock_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PerfLockServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PerfLock_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PerfLockServer).Subscribe(m, &grpc.GenericServerStream[ListRequest, ListResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PerfLock_SubscribeServer = grpc.ServerStreamingServer[ListResponse]
+
+func _PerfLock_QueryPower_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryPowerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PerfLockServer).QueryPower(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PerfLock_QueryPower_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PerfLockServer).QueryPower(ctx, req.(*QueryPowerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PerfLock_Position_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PositionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PerfLockServer).Position(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PerfLock_Position_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PerfLockServer).Position(ctx, req.(*PositionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PerfLock_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PerfLockServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PerfLock_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PerfLockServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PerfLock_ServiceDesc is the grpc.ServiceDesc for PerfLock service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PerfLock_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "perflock.PerfLock",
+	HandlerType: (*PerfLockServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _PerfLock_List_Handler,
+		},
+		{
+			MethodName: "QueryPower",
+			Handler:    _PerfLock_QueryPower_Handler,
+		},
+		{
+			MethodName: "Position",
+			Handler:    _PerfLock_Position_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _PerfLock_Stat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Lock",
+			Handler:       _PerfLock_Lock_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _PerfLock_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "perflock.proto",
+}